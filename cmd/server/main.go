@@ -48,7 +48,10 @@ func main() {
 	defer database.Close()
 
 	// Initialize router
-	router := api.NewRouter(database)
+	router, err := api.NewRouter(database)
+	if err != nil {
+		log.Fatalf("Failed to start: %v", err)
+	}
 
 	// Start the server
 	port := os.Getenv("PORT")
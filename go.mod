@@ -3,11 +3,18 @@ module zesty-sips-api
 go 1.20
 
 require (
-    github.com/gorilla/mux v1.8.0
-    github.com/lib/pq v1.10.9
-    github.com/joho/godotenv v1.5.1
-    github.com/dgrijalva/jwt-go v3.2.0+incompatible
-    golang.org/x/crypto v0.12.0
-    github.com/go-playground/validator/v10 v10.14.1
-    github.com/stretchr/testify v1.8.4
-)
\ No newline at end of file
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/go-playground/validator/v10 v10.14.1
+	github.com/gorilla/mux v1.8.0
+	github.com/joho/godotenv v1.5.1
+	github.com/lib/pq v1.10.9
+	github.com/stretchr/testify v1.8.4
+	golang.org/x/crypto v0.12.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
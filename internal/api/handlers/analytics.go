@@ -42,6 +42,72 @@ func (h *AnalyticsHandler) GetSalesReport(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(report)
 }
 
+func (h *AnalyticsHandler) GetTaxReport(w http.ResponseWriter, r *http.Request) {
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	start, err := time.Parse("2006-01-02", r.URL.Query().Get("start_date"))
+	if err != nil {
+		http.Error(w, "Invalid start date format", http.StatusBadRequest)
+		return
+	}
+
+	end, err := time.Parse("2006-01-02", r.URL.Query().Get("end_date"))
+	if err != nil {
+		http.Error(w, "Invalid end date format", http.StatusBadRequest)
+		return
+	}
+
+	storeID, err := queryInt64(r, "store_id")
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.AnalyticsService.GetTaxReport(start, end, storeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *AnalyticsHandler) GetTipReport(w http.ResponseWriter, r *http.Request) {
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	start, err := time.Parse("2006-01-02", r.URL.Query().Get("start_date"))
+	if err != nil {
+		http.Error(w, "Invalid start date format", http.StatusBadRequest)
+		return
+	}
+
+	end, err := time.Parse("2006-01-02", r.URL.Query().Get("end_date"))
+	if err != nil {
+		http.Error(w, "Invalid end date format", http.StatusBadRequest)
+		return
+	}
+
+	storeID, err := queryInt64(r, "store_id")
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.AnalyticsService.GetTipReport(start, end, storeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
 func (h *AnalyticsHandler) GetTopProducts(w http.ResponseWriter, r *http.Request) {
 	limitStr := r.URL.Query().Get("limit")
 	limit, err := strconv.Atoi(limitStr)
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/internal/services"
+)
+
+// CartHandler serves the signed-in customer's cart. Every response carries
+// the cart's version as an ETag, and changes sent with If-Match fail with
+// 412 when another device changed the cart first.
+type CartHandler struct {
+	CartService *services.CartService
+}
+
+func NewCartHandler(cartService *services.CartService) *CartHandler {
+	return &CartHandler{CartService: cartService}
+}
+
+// writeCartError reports a failed cart change or checkout.
+func writeCartError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrVersionConflict):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, services.ErrSlotFull), errors.Is(err, services.ErrInsufficientStock):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrNoDeliveryZone):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, services.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeCart(w http.ResponseWriter, cart *models.Cart) {
+	setETag(w, cart.Version)
+	json.NewEncoder(w).Encode(cart)
+}
+
+func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	cart, err := h.CartService.GetCart(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCart(w, cart)
+}
+
+func (h *CartHandler) UpdateCart(w http.ResponseWriter, r *http.Request) {
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
+
+	var details models.Cart
+	if err := json.NewDecoder(r.Body).Decode(&details); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	cart, err := h.CartService.UpdateCart(userID, &details, expectedVersion)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeCart(w, cart)
+}
+
+func (h *CartHandler) ClearCart(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	if err := h.CartService.ClearCart(userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CartHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
+
+	var item models.CartItem
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	cart, err := h.CartService.AddItem(userID, &item, expectedVersion)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeCart(w, cart)
+}
+
+func (h *CartHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemID, err := strconv.ParseInt(vars["itemId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid cart item ID", http.StatusBadRequest)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
+
+	var request struct {
+		Quantity int `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	cart, err := h.CartService.UpdateItem(userID, itemID, request.Quantity, expectedVersion)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeCart(w, cart)
+}
+
+func (h *CartHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemID, err := strconv.ParseInt(vars["itemId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid cart item ID", http.StatusBadRequest)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	cart, err := h.CartService.RemoveItem(userID, itemID, expectedVersion)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeCart(w, cart)
+}
+
+// Checkout places the cart as an order and returns the order.
+func (h *CartHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	order, err := h.CartService.Checkout(userID, expectedVersion)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	setETag(w, order.Version)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
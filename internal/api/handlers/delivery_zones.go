@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/internal/services"
+)
+
+type DeliveryZoneHandler struct {
+	DeliveryZoneService *services.DeliveryZoneService
+}
+
+func NewDeliveryZoneHandler(deliveryZoneService *services.DeliveryZoneService) *DeliveryZoneHandler {
+	return &DeliveryZoneHandler{DeliveryZoneService: deliveryZoneService}
+}
+
+func (h *DeliveryZoneHandler) CreateZone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	storeID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var zone models.DeliveryZone
+	if err := json.NewDecoder(r.Body).Decode(&zone); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	zone.StoreID = storeID
+
+	if err := h.DeliveryZoneService.CreateZone(&zone); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(zone)
+}
+
+func (h *DeliveryZoneHandler) ListZones(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	storeID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	zones, err := h.DeliveryZoneService.ListZones(storeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(zones)
+}
+
+func (h *DeliveryZoneHandler) GetZone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery zone ID", http.StatusBadRequest)
+		return
+	}
+
+	zone, err := h.DeliveryZoneService.GetZone(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(zone)
+}
+
+func (h *DeliveryZoneHandler) UpdateZone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery zone ID", http.StatusBadRequest)
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var zone models.DeliveryZone
+	if err := json.NewDecoder(r.Body).Decode(&zone); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	zone.ID = id
+
+	if err := h.DeliveryZoneService.UpdateZone(&zone); err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(zone)
+}
+
+func (h *DeliveryZoneHandler) DeleteZone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery zone ID", http.StatusBadRequest)
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if err := h.DeliveryZoneService.DeleteZone(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CheckDelivery tells a customer whether the store delivers to the
+// "postcode" or "lat"/"lng" in the query, and on what terms.
+func (h *DeliveryZoneHandler) CheckDelivery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	storeID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	var location *models.GeoPoint
+	query := r.URL.Query()
+	if query.Get("lat") != "" || query.Get("lng") != "" {
+		lat, err1 := strconv.ParseFloat(query.Get("lat"), 64)
+		lng, err2 := strconv.ParseFloat(query.Get("lng"), 64)
+		if err1 != nil || err2 != nil {
+			http.Error(w, "Invalid lat or lng", http.StatusBadRequest)
+			return
+		}
+		location = &models.GeoPoint{Lat: lat, Lng: lng}
+	}
+
+	zone, _, err := h.DeliveryZoneService.FindZone(storeID, query.Get("postcode"), location)
+	if errors.Is(err, services.ErrNoDeliveryZone) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"delivers": false})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"delivers": true, "zone": zone})
+}
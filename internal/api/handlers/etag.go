@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hratsch/zesty-sips-api/internal/services"
+)
+
+// setETag exposes a row version as a strong ETag.
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", `"`+strconv.Itoa(version)+`"`)
+}
+
+// errIfMatchList is returned for an If-Match header listing more than one
+// version. A row has only one current version and updates are conditional
+// on a single one, so such a request is refused with 412 and the client
+// should retry with the ETag it last read.
+var errIfMatchList = fmt.Errorf("If-Match lists more than one version: %w", services.ErrVersionConflict)
+
+// ifMatchVersion reads the version a client expects to be modifying from the
+// If-Match header. It returns 0 when the header is absent or "*", which
+// means the update should not be conditional. If-Match uses strong
+// comparison (RFC 9110), so weak W/ tags are rejected. A comma-separated
+// list is accepted as long as every tag in it names the same version.
+func ifMatchVersion(r *http.Request) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	version := 0
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if strings.HasPrefix(tag, "W/") {
+			return 0, errors.New("If-Match requires a strong ETag")
+		}
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			return 0, errors.New("invalid If-Match header")
+		}
+		v, err := strconv.Atoi(tag[1 : len(tag)-1])
+		if err != nil || v <= 0 {
+			return 0, errors.New("invalid If-Match header")
+		}
+		if version != 0 && v != version {
+			return 0, errIfMatchList
+		}
+		version = v
+	}
+	if version == 0 {
+		return 0, errors.New("invalid If-Match header")
+	}
+	return version, nil
+}
+
+// writeIfMatchError maps an error from ifMatchVersion to a response: 412
+// for a precondition that cannot hold, 400 for a malformed header.
+func writeIfMatchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrVersionConflict) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// writeUpdateError maps errors from versioned updates to a response,
+// using 412 when the client's If-Match version is stale.
+func writeUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrVersionConflict):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, services.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hratsch/zesty-sips-api/internal/services"
+)
+
+type InventoryHandler struct {
+	InventoryService *services.InventoryService
+}
+
+func NewInventoryHandler(inventoryService *services.InventoryService) *InventoryHandler {
+	return &InventoryHandler{InventoryService: inventoryService}
+}
+
+// queryInt64 parses an optional integer query parameter, returning 0 when
+// it is absent.
+func queryInt64(r *http.Request, name string) (int64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func (h *InventoryHandler) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	storeID, err := queryInt64(r, "store_id")
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+	productID, err := queryInt64(r, "product_id")
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	alerts, err := h.InventoryService.ListAlerts(storeID, productID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(alerts)
+}
+
+func (h *InventoryHandler) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var request struct {
+		StoreID        int64  `json:"store_id"`
+		ProductID      int64  `json:"product_id"`
+		QuantityChange int    `json:"quantity_change"`
+		Reason         string `json:"reason"`
+		Note           string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	movement, err := h.InventoryService.AdjustStock(services.StockChange{
+		StoreID:   request.StoreID,
+		ProductID: request.ProductID,
+		Reason:    request.Reason,
+		ActorID:   userID,
+		Note:      request.Note,
+	}, request.QuantityChange)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(movement)
+}
+
+func (h *InventoryHandler) ListMovements(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	storeID, err := queryInt64(r, "store_id")
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt64(r, "limit")
+	if err != nil || limit < 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	movements, err := h.InventoryService.ListMovements(storeID, productID, int(limit))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(movements)
+}
+
+func (h *InventoryHandler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	storeID, err := queryInt64(r, "store_id")
+	if err != nil || storeID == 0 {
+		http.Error(w, "store_id is required", http.StatusBadRequest)
+		return
+	}
+
+	reconciliation, err := h.InventoryService.Reconcile(storeID, productID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(reconciliation)
+}
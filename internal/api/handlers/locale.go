@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+// preferredLanguages returns the languages the client asked for, most
+// preferred first: the lang query parameter if given, then the
+// Accept-Language header. Responses built from them vary by that header.
+func preferredLanguages(w http.ResponseWriter, r *http.Request) []string {
+	w.Header().Add("Vary", "Accept-Language")
+
+	var langs []string
+	if lang := models.NormalizeLocale(r.URL.Query().Get("lang")); lang != "" {
+		langs = append(langs, lang)
+	}
+	return append(langs, models.ParseAcceptLanguage(r.Header.Get("Accept-Language"))...)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment, so that
+// proxies do not close it.
+const sseKeepAlive = 15 * time.Second
+
+// catchUpPageSize is how many missed events are read at a time when a
+// stream resumes from a cursor.
+const catchUpPageSize = 200
+
+// eventCursor returns the ID of the last event a client saw, from the
+// Last-Event-ID header browsers send when reconnecting or the cursor query
+// parameter. It is zero for a new stream.
+func eventCursor(r *http.Request) (int64, error) {
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("cursor")
+	}
+	if cursor == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(cursor, 10, 64)
+}
+
+// startEventStream sends the headers for a Server-Sent Events response.
+func startEventStream(w http.ResponseWriter) *http.ResponseController {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	fmt.Fprintf(w, "retry: 3000\n\n")
+	rc.Flush()
+	return rc
+}
+
+// writeEvent writes an order event in Server-Sent Events format, with its
+// ID as the cursor to resume from.
+func writeEvent(w io.Writer, event models.OrderEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// StreamStoreOrders pushes a store's new orders and status changes to
+// kitchen displays as Server-Sent Events. A client that reconnects with
+// Last-Event-ID, or the cursor parameter, first gets the events it missed;
+// a new stream starts from now. Staff only.
+func (h *OrderHandler) StreamStoreOrders(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	storeID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	cursor, err := eventCursor(r)
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	// Subscribe before catching up so that nothing committed in between is
+	// missed
+	events, unsubscribe := h.OrderService.Events.Subscribe(storeID)
+	defer unsubscribe()
+
+	var missed func(after int64) ([]models.OrderEvent, error)
+	if cursor > 0 {
+		missed = func(after int64) ([]models.OrderEvent, error) {
+			return h.OrderService.ListStoreEvents(storeID, after, catchUpPageSize)
+		}
+	}
+	streamEvents(w, r, events, cursor, missed)
+}
+
+// StreamOrderEvents pushes an order's status changes to its customer as
+// Server-Sent Events; staff may follow any order. A new stream starts with
+// the order's history so far, so the first event gives its current status;
+// one resumed with Last-Event-ID or the cursor parameter gets what it
+// missed.
+func (h *OrderHandler) StreamOrderEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := eventCursor(r)
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.OrderService.GetOrder(orderID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !canViewOrder(r, order) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	events, unsubscribe := h.OrderService.Events.SubscribeOrder(orderID)
+	defer unsubscribe()
+
+	streamEvents(w, r, events, cursor, func(after int64) ([]models.OrderEvent, error) {
+		return h.OrderService.ListOrderEvents(orderID, after)
+	})
+}
+
+// streamEvents writes an event stream: first the events after cursor that
+// missed returns, read a page at a time until a short page, then live
+// events until the client goes away. Events that turn up in both are only
+// sent once. missed may be nil to send live events only.
+func streamEvents(w http.ResponseWriter, r *http.Request, events <-chan models.OrderEvent, cursor int64,
+	missed func(after int64) ([]models.OrderEvent, error)) {
+	rc := startEventStream(w)
+
+	sent := make(map[int64]bool)
+	for missed != nil {
+		page, err := missed(cursor)
+		if err != nil {
+			log.Printf("Failed to catch up order events: %v", err)
+			return
+		}
+		for _, event := range page {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			sent[event.ID] = true
+			cursor = event.ID
+		}
+		if len(page) < catchUpPageSize {
+			break
+		}
+	}
+	rc.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// Dropped for falling behind; the client reconnects and
+				// catches up from its last event
+				return
+			}
+			if sent[event.ID] {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			rc.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
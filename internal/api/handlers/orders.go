@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hratsch/zesty-sips-api/internal/models"
@@ -30,14 +34,47 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	order.UserID = userID
 
 	if err := h.OrderService.CreateOrder(&order); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, services.ErrSlotFull), errors.Is(err, services.ErrInsufficientStock):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, services.ErrNoDeliveryZone):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, services.ErrInvalid), errors.Is(err, services.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
+	setETag(w, order.Version)
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(order)
 }
 
+// QuoteOrder prices an order from the catalog without placing it, so
+// clients can show the same total that CreateOrder will charge.
+func (h *OrderHandler) QuoteOrder(w http.ResponseWriter, r *http.Request) {
+	var order models.Order
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	order.UserID = r.Context().Value("userID").(int64)
+
+	if err := h.OrderService.QuoteOrder(&order); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalid), errors.Is(err, services.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(order)
+}
+
 func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
@@ -52,13 +89,13 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if the order belongs to the authenticated user
-	userID := r.Context().Value("userID").(int64)
-	if order.UserID != userID {
+	// Customers can only see their own orders
+	if !canViewOrder(r, order) {
 		http.Error(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
 
+	setETag(w, order.Version)
 	json.NewEncoder(w).Encode(order)
 }
 
@@ -74,6 +111,74 @@ func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(orders)
 }
 
+// ListAllOrders lists every customer's orders for staff, newest first and a
+// page at a time. Filters: status (comma-separated), order_type, store_id,
+// customer_id and start_date/end_date (YYYY-MM-DD, both inclusive). Pass
+// the next_cursor of one page as cursor to get the next.
+func (h *OrderHandler) ListAllOrders(w http.ResponseWriter, r *http.Request) {
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := services.OrderFilter{OrderType: q.Get("order_type")}
+	if status := q.Get("status"); status != "" {
+		filter.Statuses = strings.Split(status, ",")
+	}
+
+	var err error
+	if filter.StoreID, err = queryInt64(r, "store_id"); err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+	if filter.UserID, err = queryInt64(r, "customer_id"); err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+	if filter.Cursor, err = queryInt64(r, "cursor"); err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt64(r, "limit")
+	if err != nil || limit < 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	filter.Limit = int(limit)
+
+	if v := q.Get("start_date"); v != "" {
+		start, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "Invalid start date format", http.StatusBadRequest)
+			return
+		}
+		filter.From = &start
+	}
+	if v := q.Get("end_date"); v != "" {
+		end, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "Invalid end date format", http.StatusBadRequest)
+			return
+		}
+		end = end.AddDate(0, 0, 1)
+		filter.To = &end
+	}
+
+	page, err := h.OrderService.ListAllOrders(filter)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
 func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
@@ -82,6 +187,12 @@ func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
+
 	var statusUpdate struct {
 		Status string `json:"status"`
 	}
@@ -90,11 +201,15 @@ func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.OrderService.UpdateOrderStatus(id, statusUpdate.Status); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	userID := r.Context().Value("userID").(int64)
+	role, _ := r.Context().Value("userRole").(string)
+	version, err := h.OrderService.UpdateOrderStatus(id, statusUpdate.Status, userID, role, expectedVersion)
+	if err != nil {
+		writeStatusError(w, err)
 		return
 	}
 
+	setETag(w, version)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -106,12 +221,99 @@ func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.OrderService.CancelOrder(orderID)
+	userID := r.Context().Value("userID").(int64)
+	role, _ := r.Context().Value("userRole").(string)
+	err = h.OrderService.CancelOrder(orderID, userID, role)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeStatusError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Order cancelled successfully"})
 }
+
+// CancelOrderItem cancels some or all of one line of an order and returns
+// the refund recorded for it. An empty body cancels the whole line.
+func (h *OrderHandler) CancelOrderItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+	itemID, err := strconv.ParseInt(vars["itemId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order item ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Quantity int `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Quantity < 0 {
+		http.Error(w, "quantity cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	role, _ := r.Context().Value("userRole").(string)
+	refund, err := h.OrderService.CancelOrderItem(orderID, itemID, request.Quantity, userID, role)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(refund)
+}
+
+func (h *OrderHandler) GetStatusHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.OrderService.GetOrder(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !canViewOrder(r, order) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	history, err := h.OrderService.GetStatusHistory(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(history)
+}
+
+// canViewOrder reports whether the authenticated user may see an order:
+// customers see their own orders, staff, drivers and admins see any.
+func canViewOrder(r *http.Request, order *models.Order) bool {
+	userID := r.Context().Value("userID").(int64)
+	role, _ := r.Context().Value("userRole").(string)
+	return order.UserID == userID || (role != "" && role != models.RoleCustomer)
+}
+
+// writeStatusError maps errors from order status changes to a response.
+func writeStatusError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrInvalidTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		writeUpdateError(w, err)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/hratsch/zesty-sips-api/internal/services"
+)
+
+// decodeMergePatch reads an RFC 7386 merge patch document from the request
+// body. It writes an error response and returns false if the request is not
+// a JSON object sent as application/merge-patch+json or application/json.
+func decodeMergePatch(w http.ResponseWriter, r *http.Request) (map[string]json.RawMessage, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		http.Error(w, "Content-Type must be application/merge-patch+json", http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		http.Error(w, "Merge patch must be a JSON object", http.StatusBadRequest)
+		return nil, false
+	}
+	return patch, true
+}
+
+// writePatchError reports field validation failures as 422 with a JSON body
+// naming each field, and defers to writeUpdateError for everything else.
+func writePatchError(w http.ResponseWriter, err error) {
+	var fieldErrors services.FieldErrors
+	if errors.As(err, &fieldErrors) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]services.FieldErrors{"errors": fieldErrors})
+		return
+	}
+	writeUpdateError(w, err)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hratsch/zesty-sips-api/internal/payments"
+	"github.com/hratsch/zesty-sips-api/internal/services"
+)
+
+type PaymentHandler struct {
+	PaymentService *services.PaymentService
+	OrderService   *services.OrderService
+}
+
+func NewPaymentHandler(paymentService *services.PaymentService, orderService *services.OrderService) *PaymentHandler {
+	return &PaymentHandler{PaymentService: paymentService, OrderService: orderService}
+}
+
+// AuthorizePayment pays for a pending order with the payment method in
+// token. A declined payment is returned with 402 Payment Required.
+func (h *PaymentHandler) AuthorizePayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	role, _ := r.Context().Value("userRole").(string)
+	payment, err := h.PaymentService.AuthorizeOrder(orderID, userID, role, request.Token)
+	if errors.Is(err, services.ErrPaymentDeclined) {
+		w.WriteHeader(http.StatusPaymentRequired)
+		json.NewEncoder(w).Encode(payment)
+		return
+	}
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (h *PaymentHandler) ListPayments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.OrderService.GetOrder(orderID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !canViewOrder(r, order) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	list, err := h.PaymentService.ListPayments(orderID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(list)
+}
+
+// CapturePayment takes the money held for an order ahead of completion.
+func (h *PaymentHandler) CapturePayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	payment, err := h.PaymentService.CaptureOrder(orderID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if payment == nil {
+		http.Error(w, "order has no authorized payment", http.StatusConflict)
+		return
+	}
+
+	json.NewEncoder(w).Encode(payment)
+}
+
+// SettleRefunds retries paying back an order's outstanding refunds.
+func (h *PaymentHandler) SettleRefunds(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if err := h.PaymentService.SettleRefunds(orderID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	list, err := h.PaymentService.ListPayments(orderID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(list)
+}
+
+// Webhook receives payment updates from the provider named in the path.
+func (h *PaymentHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["provider"] != h.PaymentService.Provider.Name() {
+		http.Error(w, "Unknown payment provider", http.StatusNotFound)
+		return
+	}
+
+	err := h.PaymentService.HandleWebhook(r)
+	if errors.Is(err, payments.ErrInvalidSignature) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
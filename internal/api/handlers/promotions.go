@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/hratsch/zesty-sips-api/internal/models"
 	"github.com/hratsch/zesty-sips-api/internal/services"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
 )
 
 type PromotionHandler struct {
@@ -19,6 +21,11 @@ func NewPromotionHandler(promotionService *services.PromotionService) *Promotion
 }
 
 func (h *PromotionHandler) CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
 	var promotion models.Promotion
 	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -30,6 +37,7 @@ func (h *PromotionHandler) CreatePromotion(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	setETag(w, promotion.Version)
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(promotion)
 }
@@ -48,6 +56,7 @@ func (h *PromotionHandler) GetPromotion(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	setETag(w, promotion.Version)
 	json.NewEncoder(w).Encode(promotion)
 }
 
@@ -68,6 +77,16 @@ func (h *PromotionHandler) UpdatePromotion(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
 		return
 	}
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
 
 	var promotion models.Promotion
 	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
@@ -76,11 +95,45 @@ func (h *PromotionHandler) UpdatePromotion(w http.ResponseWriter, r *http.Reques
 	}
 	promotion.ID = id
 
-	if err := h.PromotionService.UpdatePromotion(&promotion); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.PromotionService.UpdatePromotion(&promotion, expectedVersion); err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+
+	setETag(w, promotion.Version)
+	json.NewEncoder(w).Encode(promotion)
+}
+
+func (h *PromotionHandler) PatchPromotion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
+
+	patch, ok := decodeMergePatch(w, r)
+	if !ok {
 		return
 	}
 
+	promotion, err := h.PromotionService.PatchPromotion(id, patch, expectedVersion)
+	if err != nil {
+		writePatchError(w, err)
+		return
+	}
+
+	setETag(w, promotion.Version)
 	json.NewEncoder(w).Encode(promotion)
 }
 
@@ -91,9 +144,18 @@ func (h *PromotionHandler) DeletePromotion(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
 		return
 	}
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
 
 	if err := h.PromotionService.DeletePromotion(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, services.ErrInUse):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -102,8 +164,8 @@ func (h *PromotionHandler) DeletePromotion(w http.ResponseWriter, r *http.Reques
 
 func (h *PromotionHandler) ApplyPromotion(w http.ResponseWriter, r *http.Request) {
 	var request struct {
-		Code        string  `json:"code"`
-		TotalAmount float64 `json:"total_amount"`
+		Code        string      `json:"code"`
+		TotalAmount money.Money `json:"total_amount"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -118,11 +180,11 @@ func (h *PromotionHandler) ApplyPromotion(w http.ResponseWriter, r *http.Request
 	}
 
 	response := struct {
-		DiscountAmount float64 `json:"discount_amount"`
-		FinalAmount    float64 `json:"final_amount"`
+		DiscountAmount money.Money `json:"discount_amount"`
+		FinalAmount    money.Money `json:"final_amount"`
 	}{
 		DiscountAmount: discountAmount,
-		FinalAmount:    request.TotalAmount - discountAmount,
+		FinalAmount:    request.TotalAmount.Sub(discountAmount),
 	}
 
 	json.NewEncoder(w).Encode(response)
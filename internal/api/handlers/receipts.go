@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hratsch/zesty-sips-api/internal/receipts"
+	"github.com/hratsch/zesty-sips-api/internal/services"
+)
+
+type ReceiptHandler struct {
+	ReceiptService *services.ReceiptService
+	OrderService   *services.OrderService
+}
+
+func NewReceiptHandler(receiptService *services.ReceiptService, orderService *services.OrderService) *ReceiptHandler {
+	return &ReceiptHandler{ReceiptService: receiptService, OrderService: orderService}
+}
+
+// GetReceipt returns an order's receipt as HTML, or as plain text or a PDF
+// with format=text or format=pdf.
+func (h *ReceiptHandler) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	render := receipts.RenderHTML
+	contentType := "text/html; charset=utf-8"
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "html":
+	case "text":
+		render = receipts.RenderText
+		contentType = "text/plain; charset=utf-8"
+	case "pdf":
+		render = receipts.RenderPDF
+		contentType = "application/pdf"
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=receipt-%d.pdf", orderID))
+	default:
+		http.Error(w, "format must be html, text or pdf", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.OrderService.GetOrder(orderID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !canViewOrder(r, order) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	receipt, err := h.ReceiptService.BuildReceipt(order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	render(w, receipt)
+}
+
+// EmailReceipt sends an order's receipt to the customer's email address.
+func (h *ReceiptHandler) EmailReceipt(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.OrderService.GetOrder(orderID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !canViewOrder(r, order) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	to, err := h.ReceiptService.EmailReceipt(order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Receipt sent to " + to})
+}
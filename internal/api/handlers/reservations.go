@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/internal/services"
+)
+
+type ReservationHandler struct {
+	ReservationService *services.ReservationService
+}
+
+func NewReservationHandler(reservationService *services.ReservationService) *ReservationHandler {
+	return &ReservationHandler{ReservationService: reservationService}
+}
+
+func (h *ReservationHandler) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	var reservation models.Reservation
+	if err := json.NewDecoder(r.Body).Decode(&reservation); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reservation.UserID = r.Context().Value("userID").(int64)
+
+	if err := h.ReservationService.CreateReservation(&reservation); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInsufficientStock), errors.Is(err, services.ErrTooManyReservations):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, services.ErrInvalid), errors.Is(err, services.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reservation)
+}
+
+func (h *ReservationHandler) GetReservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	reservation, err := h.ReservationService.GetReservation(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	if reservation.UserID != userID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	json.NewEncoder(w).Encode(reservation)
+}
+
+func (h *ReservationHandler) ReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	if err := h.ReservationService.ReleaseReservation(id, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+func isAdmin(r *http.Request) bool {
+	role, _ := r.Context().Value("userRole").(string)
+	return role == models.RoleAdmin
+}
+
+func isStaffOrAdmin(r *http.Request) bool {
+	role, _ := r.Context().Value("userRole").(string)
+	return role == models.RoleStaff || role == models.RoleAdmin
+}
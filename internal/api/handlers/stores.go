@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/internal/services"
+)
+
+type StoreHandler struct {
+	StoreService *services.StoreService
+}
+
+func NewStoreHandler(storeService *services.StoreService) *StoreHandler {
+	return &StoreHandler{StoreService: storeService}
+}
+
+func (h *StoreHandler) CreateStore(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var store models.Store
+	if err := json.NewDecoder(r.Body).Decode(&store); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.StoreService.CreateStore(&store); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(store)
+}
+
+func (h *StoreHandler) GetStore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	store, err := h.StoreService.GetStore(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(store)
+}
+
+func (h *StoreHandler) ListStores(w http.ResponseWriter, r *http.Request) {
+	stores, err := h.StoreService.ListStores()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(stores)
+}
+
+func (h *StoreHandler) UpdateStore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var store models.Store
+	if err := json.NewDecoder(r.Body).Decode(&store); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	store.ID = id
+
+	if err := h.StoreService.UpdateStore(&store); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(store)
+}
+
+func (h *StoreHandler) DeleteStore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if err := h.StoreService.DeleteStore(id); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInUse):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *StoreHandler) ListStoreProducts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	includeUnavailable := r.URL.Query().Get("include_unavailable") == "true"
+
+	langs := preferredLanguages(w, r)
+
+	products, err := h.StoreService.ListStoreProducts(id, includeUnavailable, langs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(products)
+}
+
+func (h *StoreHandler) SetStoreProduct(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	storeID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+	productID, err := strconv.ParseInt(vars["productId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	if !isStaffOrAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var storeProduct models.StoreProduct
+	if err := json.NewDecoder(r.Body).Decode(&storeProduct); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	storeProduct.StoreID = storeID
+	storeProduct.ProductID = productID
+
+	userID := r.Context().Value("userID").(int64)
+	if err := h.StoreService.SetStoreProduct(&storeProduct, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(storeProduct)
+}
+
+// ListSlots returns the store's pickup and delivery time slots for the day
+// in the "date" query parameter, or today.
+func (h *StoreHandler) ListSlots(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	slots, err := h.StoreService.ListSlots(id, r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(slots)
+}
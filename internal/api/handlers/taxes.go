@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/internal/services"
+)
+
+type TaxHandler struct {
+	TaxService *services.TaxService
+}
+
+func NewTaxHandler(taxService *services.TaxService) *TaxHandler {
+	return &TaxHandler{TaxService: taxService}
+}
+
+func (h *TaxHandler) ListRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.TaxService.ListRates(r.URL.Query().Get("jurisdiction"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rates)
+}
+
+func (h *TaxHandler) CreateRate(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var rate models.TaxRate
+	if err := json.NewDecoder(r.Body).Decode(&rate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.TaxService.CreateRate(&rate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rate)
+}
+
+func (h *TaxHandler) UpdateRate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tax rate ID", http.StatusBadRequest)
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var rate models.TaxRate
+	if err := json.NewDecoder(r.Body).Decode(&rate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rate.ID = id
+
+	if err := h.TaxService.UpdateRate(&rate); err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rate)
+}
+
+func (h *TaxHandler) DeleteRate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tax rate ID", http.StatusBadRequest)
+		return
+	}
+	if !isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if err := h.TaxService.DeleteRate(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
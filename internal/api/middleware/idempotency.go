@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+// IdempotencyKeyHeader is the request header clients use to make a POST
+// safe to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodySize   = 1 << 20
+)
+
+// IdempotencyStore keeps the requests made with idempotency keys and their
+// responses.
+type IdempotencyStore interface {
+	// Claim records record as started. If the user has already used the key
+	// it leaves the store unchanged and returns the earlier record.
+	Claim(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	// Complete saves the response to a claimed request.
+	Complete(record *models.IdempotencyRecord) error
+	// Release forgets a claimed request so it can be tried again.
+	Release(userID int64, key string) error
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotency makes requests that carry an Idempotency-Key header safe to
+// retry. The first request with a key runs normally and its response is
+// stored; a retry with the same key and body gets that response replayed
+// without running the handler again. Reusing a key for a different request
+// is rejected with 422, and a retry that arrives while the first request is
+// still running gets 409. Server errors are not stored so the request can be
+// retried for real. Requests without the header are passed straight through.
+//
+// It must run after Auth, since keys belong to the signed-in user.
+func Idempotency(store IdempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodySize+1))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(body) > maxIdempotentBodySize {
+				http.Error(w, "Request body is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			sum := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\n"), body...))
+			record := &models.IdempotencyRecord{
+				UserID:      r.Context().Value("userID").(int64),
+				Key:         key,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				Fingerprint: hex.EncodeToString(sum[:]),
+			}
+
+			existing, err := store.Claim(record)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != record.Fingerprint:
+					http.Error(w, "Idempotency-Key has already been used for a different request", http.StatusUnprocessableEntity)
+				case !existing.Completed():
+					http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+				default:
+					for name, values := range existing.Header {
+						w.Header()[name] = values
+					}
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(existing.StatusCode)
+					w.Write(existing.Body)
+				}
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			completed := false
+			defer func() {
+				if !completed {
+					if err := store.Release(record.UserID, key); err != nil {
+						log.Printf("Failed to release idempotency key %q: %v", key, err)
+					}
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			if recorder.status >= http.StatusInternalServerError {
+				return
+			}
+
+			record.StatusCode = recorder.status
+			record.Header = w.Header().Clone()
+			record.Body = recorder.body.Bytes()
+			if err := store.Complete(record); err != nil {
+				log.Printf("Failed to save response for idempotency key %q: %v", key, err)
+				return
+			}
+			completed = true
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/api/middleware"
+	"zesty-sips-api/internal/models"
+)
+
+type memoryIdempotencyStore struct {
+	records map[string]*models.IdempotencyRecord
+}
+
+func (s *memoryIdempotencyStore) Claim(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	if existing, ok := s.records[record.Key]; ok {
+		return existing, nil
+	}
+	copy := *record
+	s.records[record.Key] = &copy
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(record *models.IdempotencyRecord) error {
+	now := time.Now()
+	copy := *record
+	copy.CompletedAt = &now
+	s.records[record.Key] = &copy
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(userID int64, key string) error {
+	delete(s.records, key)
+	return nil
+}
+
+func idempotentRequest(key, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/api/v1/orders", strings.NewReader(body))
+	req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	return req.WithContext(context.WithValue(req.Context(), "userID", int64(7)))
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]*models.IdempotencyRecord{}}
+	calls := 0
+	handler := middleware.Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("ETag", `"1"`)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":42}`))
+	}))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, idempotentRequest("abc", `{"store_id":1}`))
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	retry := httptest.NewRecorder()
+	handler.ServeHTTP(retry, idempotentRequest("abc", `{"store_id":1}`))
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, `{"id":42}`, retry.Body.String())
+	assert.Equal(t, `"1"`, retry.Header().Get("ETag"))
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls)
+
+	reused := httptest.NewRecorder()
+	handler.ServeHTTP(reused, idempotentRequest("abc", `{"store_id":2}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotencyDoesNotStoreServerErrors(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]*models.IdempotencyRecord{}}
+	calls := 0
+	handler := middleware.Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "database unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, idempotentRequest("retry-me", `{}`))
+	assert.Equal(t, http.StatusInternalServerError, first.Code)
+
+	retry := httptest.NewRecorder()
+	handler.ServeHTTP(retry, idempotentRequest("retry-me", `{}`))
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyRejectsRetryWhileInProgress(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]*models.IdempotencyRecord{}}
+	retryCode := 0
+
+	// The retry arrives while the first request is still being handled
+	var handler http.Handler
+	handler = middleware.Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retryCode == 0 {
+			retry := httptest.NewRecorder()
+			handler.ServeHTTP(retry, idempotentRequest("busy", `{}`))
+			retryCode = retry.Code
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, idempotentRequest("busy", `{}`))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, http.StatusConflict, retryCode)
+}
@@ -2,31 +2,84 @@ package api
 
 import (
 	"database/sql"
+	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hratsch/zesty-sips-api/internal/api/handlers"
 	"github.com/hratsch/zesty-sips-api/internal/api/middleware"
+	"github.com/hratsch/zesty-sips-api/internal/config"
+	"github.com/hratsch/zesty-sips-api/internal/payments"
 	"github.com/hratsch/zesty-sips-api/internal/services"
 )
 
-func NewRouter(db *sql.DB) *mux.Router {
+// NewRouter wires up the services and routes. It fails if the
+// configuration cannot be used, such as a payment provider not meant for
+// production.
+func NewRouter(db *sql.DB) (*mux.Router, error) {
+	cfg := config.New()
 	r := mux.NewRouter()
 
 	// Middleware
 	r.Use(middleware.Logging)
 
 	// Services
+	var alertNotifier services.AlertNotifier = services.LogAlertNotifier{}
+	if cfg.StockAlertWebhookURL != "" {
+		alertNotifier = services.NewWebhookAlertNotifier(cfg.StockAlertWebhookURL)
+	}
+	var mailer services.Mailer = services.LogMailer{}
+	if cfg.SMTPAddr != "" {
+		mailer = services.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	}
 	userService := services.NewUserService(db)
-	productService := services.NewProductService(db)
+	storeService := services.NewStoreService(db)
+	deliveryZoneService := services.NewDeliveryZoneService(db)
+	taxService := services.NewTaxService(db)
+	inventoryService := services.NewInventoryService(db, alertNotifier)
+	productService := services.NewProductService(db, inventoryService)
+	categoryService := services.NewCategoryService(db)
 	loyaltyService := services.NewLoyaltyService(db)
 	promotionService := services.NewPromotionService(db)
-	orderService := services.NewOrderService(db, productService, loyaltyService, promotionService)
+	pricingService := services.NewPricingService(db, productService, promotionService)
+	reservationService := services.NewReservationService(db)
+	supplierService := services.NewSupplierService(db)
+	purchaseOrderService := services.NewPurchaseOrderService(db, productService)
+	orderEvents := services.NewOrderEventBroker()
+	orderEvents.OnPublish(services.NewOrderStatusNotifier(db, services.LogNotifier{}).NotifyStatusChange)
+	paymentProvider, err := payments.NewProvider(cfg.PaymentProvider, cfg.Environment == "production",
+		cfg.PaymentWebhookSecret, cfg.PaymentWebhookURL)
+	if err != nil {
+		return nil, err
+	}
+	paymentService := services.NewPaymentService(db, paymentProvider, orderEvents)
+	orderService := services.NewOrderService(db, productService, loyaltyService, pricingService, reservationService, paymentService, orderEvents)
+	cartService := services.NewCartService(db, pricingService, orderService)
+	receiptService := services.NewReceiptService(db, mailer)
 	analyticsService := services.NewAnalyticsService(db)
+	idempotencyService := services.NewIdempotencyService(db)
+
+	// Background jobs
+	go reservationService.RunExpiryLoop(time.Minute)
+	go inventoryService.RunDispatchLoop(time.Minute)
+	go cartService.RunExpiryLoop(time.Hour)
+	go idempotencyService.RunExpiryLoop(time.Hour)
 
 	// Handlers
 	userHandler := handlers.NewUserHandler(userService)
+	storeHandler := handlers.NewStoreHandler(storeService)
+	deliveryZoneHandler := handlers.NewDeliveryZoneHandler(deliveryZoneService)
+	taxHandler := handlers.NewTaxHandler(taxService)
 	productHandler := handlers.NewProductHandler(productService)
+	categoryHandler := handlers.NewCategoryHandler(categoryService)
+	inventoryHandler := handlers.NewInventoryHandler(inventoryService)
 	orderHandler := handlers.NewOrderHandler(orderService)
+	cartHandler := handlers.NewCartHandler(cartService)
+	paymentHandler := handlers.NewPaymentHandler(paymentService, orderService)
+	receiptHandler := handlers.NewReceiptHandler(receiptService, orderService)
+	reservationHandler := handlers.NewReservationHandler(reservationService)
+	supplierHandler := handlers.NewSupplierHandler(supplierService)
+	purchaseOrderHandler := handlers.NewPurchaseOrderHandler(purchaseOrderService)
 	loyaltyHandler := handlers.NewLoyaltyHandler(loyaltyService)
 	promotionHandler := handlers.NewPromotionHandler(promotionService)
 	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService)
@@ -35,12 +88,17 @@ func NewRouter(db *sql.DB) *mux.Router {
 	r.HandleFunc("/health", handlers.HealthCheck).Methods("GET")
 	r.HandleFunc("/register", userHandler.Register).Methods("POST")
 	r.HandleFunc("/login", userHandler.Login).Methods("POST")
+	r.HandleFunc("/payments/webhooks/{provider}", paymentHandler.Webhook).Methods("POST")
 
 	// Protected routes
 	api := r.PathPrefix("/api/v1").Subrouter()
 	api.Use(middleware.Auth)
 
+	// Retrying these with the same Idempotency-Key replays the first response
+	idempotent := middleware.Idempotency(idempotencyService)
+
 	// User routes
+	api.HandleFunc("/users", userHandler.CreateUser).Methods("POST")
 	api.HandleFunc("/users/{id}", userHandler.GetUser).Methods("GET")
 
 	// Product routes
@@ -48,32 +106,126 @@ func NewRouter(db *sql.DB) *mux.Router {
 	api.HandleFunc("/products", productHandler.CreateProduct).Methods("POST")
 	api.HandleFunc("/products/{id}", productHandler.GetProduct).Methods("GET")
 	api.HandleFunc("/products/{id}", productHandler.UpdateProduct).Methods("PUT")
+	api.HandleFunc("/products/{id}", productHandler.PatchProduct).Methods("PATCH")
 	api.HandleFunc("/products/{id}", productHandler.DeleteProduct).Methods("DELETE")
+	api.HandleFunc("/products/{id}/availability", productHandler.GetAvailability).Methods("GET")
+	api.HandleFunc("/products/{id}/schedule", productHandler.GetAvailabilityWindows).Methods("GET")
+	api.HandleFunc("/products/{id}/schedule", productHandler.SetAvailabilityWindows).Methods("PUT")
+	api.HandleFunc("/products/{id}/bundle", productHandler.GetBundle).Methods("GET")
+	api.HandleFunc("/products/{id}/bundle", productHandler.SetBundle).Methods("PUT")
+	api.HandleFunc("/products/{id}/modifiers", productHandler.GetModifiers).Methods("GET")
+	api.HandleFunc("/products/{id}/modifiers", productHandler.SetModifiers).Methods("PUT")
+	api.HandleFunc("/products/{id}/translations", productHandler.ListTranslations).Methods("GET")
+	api.HandleFunc("/products/{id}/translations/{locale}", productHandler.SetTranslation).Methods("PUT")
+	api.HandleFunc("/products/{id}/translations/{locale}", productHandler.DeleteTranslation).Methods("DELETE")
+	api.HandleFunc("/products/{id}/movements", inventoryHandler.ListMovements).Methods("GET")
+	api.HandleFunc("/products/{id}/movements/reconcile", inventoryHandler.Reconcile).Methods("GET")
+
+	// Category routes
+	api.HandleFunc("/categories", categoryHandler.ListCategories).Methods("GET")
+	api.HandleFunc("/categories", categoryHandler.CreateCategory).Methods("POST")
+	api.HandleFunc("/categories/{id}", categoryHandler.GetCategory).Methods("GET")
+	api.HandleFunc("/categories/{id}", categoryHandler.UpdateCategory).Methods("PUT")
+	api.HandleFunc("/categories/{id}", categoryHandler.DeleteCategory).Methods("DELETE")
+	api.HandleFunc("/categories/{id}/translations", categoryHandler.ListTranslations).Methods("GET")
+	api.HandleFunc("/categories/{id}/translations/{locale}", categoryHandler.SetTranslation).Methods("PUT")
+	api.HandleFunc("/categories/{id}/translations/{locale}", categoryHandler.DeleteTranslation).Methods("DELETE")
+
+	// Store routes
+	api.HandleFunc("/stores", storeHandler.ListStores).Methods("GET")
+	api.HandleFunc("/stores", storeHandler.CreateStore).Methods("POST")
+	api.HandleFunc("/stores/{id}", storeHandler.GetStore).Methods("GET")
+	api.HandleFunc("/stores/{id}", storeHandler.UpdateStore).Methods("PUT")
+	api.HandleFunc("/stores/{id}", storeHandler.DeleteStore).Methods("DELETE")
+	api.HandleFunc("/stores/{id}/products", storeHandler.ListStoreProducts).Methods("GET")
+	api.HandleFunc("/stores/{id}/products/{productId}", storeHandler.SetStoreProduct).Methods("PUT")
+	api.HandleFunc("/stores/{id}/slots", storeHandler.ListSlots).Methods("GET")
+	api.HandleFunc("/stores/{id}/orders/stream", orderHandler.StreamStoreOrders).Methods("GET")
+
+	// Delivery zone routes
+	api.HandleFunc("/stores/{id}/delivery-zones", deliveryZoneHandler.ListZones).Methods("GET")
+	api.HandleFunc("/stores/{id}/delivery-zones", deliveryZoneHandler.CreateZone).Methods("POST")
+	api.HandleFunc("/stores/{id}/delivery-zones/check", deliveryZoneHandler.CheckDelivery).Methods("GET")
+	api.HandleFunc("/delivery-zones/{id}", deliveryZoneHandler.GetZone).Methods("GET")
+	api.HandleFunc("/delivery-zones/{id}", deliveryZoneHandler.UpdateZone).Methods("PUT")
+	api.HandleFunc("/delivery-zones/{id}", deliveryZoneHandler.DeleteZone).Methods("DELETE")
+
+	// Tax rate routes
+	api.HandleFunc("/tax-rates", taxHandler.ListRates).Methods("GET")
+	api.HandleFunc("/tax-rates", taxHandler.CreateRate).Methods("POST")
+	api.HandleFunc("/tax-rates/{id}", taxHandler.UpdateRate).Methods("PUT")
+	api.HandleFunc("/tax-rates/{id}", taxHandler.DeleteRate).Methods("DELETE")
+
+	// Inventory routes
+	api.HandleFunc("/inventory/alerts", inventoryHandler.ListAlerts).Methods("GET")
+	api.HandleFunc("/inventory/adjustments", inventoryHandler.AdjustStock).Methods("POST")
+
+	// Purchasing routes
+	api.HandleFunc("/suppliers", supplierHandler.ListSuppliers).Methods("GET")
+	api.HandleFunc("/suppliers", supplierHandler.CreateSupplier).Methods("POST")
+	api.HandleFunc("/suppliers/{id}", supplierHandler.GetSupplier).Methods("GET")
+	api.HandleFunc("/suppliers/{id}", supplierHandler.UpdateSupplier).Methods("PUT")
+	api.HandleFunc("/suppliers/{id}", supplierHandler.DeleteSupplier).Methods("DELETE")
+	api.HandleFunc("/purchase-orders", purchaseOrderHandler.ListPurchaseOrders).Methods("GET")
+	api.HandleFunc("/purchase-orders", purchaseOrderHandler.CreatePurchaseOrder).Methods("POST")
+	api.HandleFunc("/purchase-orders/{id}", purchaseOrderHandler.GetPurchaseOrder).Methods("GET")
+	api.HandleFunc("/purchase-orders/{id}/status", purchaseOrderHandler.UpdatePurchaseOrderStatus).Methods("PATCH")
+	api.HandleFunc("/purchase-orders/{id}/receive", purchaseOrderHandler.ReceivePurchaseOrder).Methods("POST")
+
+	// Reservation routes
+	api.HandleFunc("/reservations", reservationHandler.CreateReservation).Methods("POST")
+	api.HandleFunc("/reservations/{id}", reservationHandler.GetReservation).Methods("GET")
+	api.HandleFunc("/reservations/{id}", reservationHandler.ReleaseReservation).Methods("DELETE")
 
 	// Order routes
-	api.HandleFunc("/orders", orderHandler.CreateOrder).Methods("POST")
+	api.Handle("/orders", idempotent(http.HandlerFunc(orderHandler.CreateOrder))).Methods("POST")
 	api.HandleFunc("/orders", orderHandler.ListOrders).Methods("GET")
+	api.HandleFunc("/staff/orders", orderHandler.ListAllOrders).Methods("GET")
+	api.HandleFunc("/orders/quote", orderHandler.QuoteOrder).Methods("POST")
 	api.HandleFunc("/orders/{id}", orderHandler.GetOrder).Methods("GET")
 	api.HandleFunc("/orders/{id}/status", orderHandler.UpdateOrderStatus).Methods("PATCH")
 	api.HandleFunc("/orders/{id}/cancel", orderHandler.CancelOrder).Methods("POST")
+	api.HandleFunc("/orders/{id}/items/{itemId}/cancel", orderHandler.CancelOrderItem).Methods("POST")
+	api.HandleFunc("/orders/{id}/history", orderHandler.GetStatusHistory).Methods("GET")
+	api.HandleFunc("/orders/{id}/events", orderHandler.StreamOrderEvents).Methods("GET")
+	api.HandleFunc("/orders/{id}/receipt", receiptHandler.GetReceipt).Methods("GET")
+	api.Handle("/orders/{id}/receipt/email", idempotent(http.HandlerFunc(receiptHandler.EmailReceipt))).Methods("POST")
+
+	// Payment routes
+	api.Handle("/orders/{id}/payments", idempotent(http.HandlerFunc(paymentHandler.AuthorizePayment))).Methods("POST")
+	api.HandleFunc("/orders/{id}/payments", paymentHandler.ListPayments).Methods("GET")
+	api.Handle("/orders/{id}/payments/capture", idempotent(http.HandlerFunc(paymentHandler.CapturePayment))).Methods("POST")
+	api.Handle("/orders/{id}/refunds/settle", idempotent(http.HandlerFunc(paymentHandler.SettleRefunds))).Methods("POST")
+
+	// Cart routes
+	api.HandleFunc("/cart", cartHandler.GetCart).Methods("GET")
+	api.HandleFunc("/cart", cartHandler.UpdateCart).Methods("PUT")
+	api.HandleFunc("/cart", cartHandler.ClearCart).Methods("DELETE")
+	api.HandleFunc("/cart/items", cartHandler.AddItem).Methods("POST")
+	api.HandleFunc("/cart/items/{itemId}", cartHandler.UpdateItem).Methods("PATCH")
+	api.HandleFunc("/cart/items/{itemId}", cartHandler.RemoveItem).Methods("DELETE")
+	api.Handle("/cart/checkout", idempotent(http.HandlerFunc(cartHandler.Checkout))).Methods("POST")
 
 	// Loyalty routes
 	api.HandleFunc("/loyalty/points", loyaltyHandler.GetLoyaltyPoints).Methods("GET")
 	api.HandleFunc("/loyalty/transactions", loyaltyHandler.GetLoyaltyTransactions).Methods("GET")
-	api.HandleFunc("/loyalty/redeem", loyaltyHandler.RedeemPoints).Methods("POST")
+	api.Handle("/loyalty/redeem", idempotent(http.HandlerFunc(loyaltyHandler.RedeemPoints))).Methods("POST")
 
 	// Promotion routes
 	api.HandleFunc("/promotions", promotionHandler.CreatePromotion).Methods("POST")
 	api.HandleFunc("/promotions", promotionHandler.ListActivePromotions).Methods("GET")
 	api.HandleFunc("/promotions/{id}", promotionHandler.GetPromotion).Methods("GET")
 	api.HandleFunc("/promotions/{id}", promotionHandler.UpdatePromotion).Methods("PUT")
+	api.HandleFunc("/promotions/{id}", promotionHandler.PatchPromotion).Methods("PATCH")
 	api.HandleFunc("/promotions/{id}", promotionHandler.DeletePromotion).Methods("DELETE")
 	api.HandleFunc("/promotions/apply", promotionHandler.ApplyPromotion).Methods("POST")
 
 	// Analytics routes
 	api.HandleFunc("/analytics/sales", analyticsHandler.GetSalesReport).Methods("GET")
 	api.HandleFunc("/analytics/top-products", analyticsHandler.GetTopProducts).Methods("GET")
+	api.HandleFunc("/analytics/tax", analyticsHandler.GetTaxReport).Methods("GET")
+	api.HandleFunc("/analytics/tips", analyticsHandler.GetTipReport).Methods("GET")
 	api.HandleFunc("/analytics/loyalty", analyticsHandler.GetLoyaltyStats).Methods("GET")
 
-	return r
+	return r, nil
 }
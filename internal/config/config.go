@@ -3,13 +3,43 @@ package config
 import "os"
 
 type Config struct {
-	DatabaseURL string
-	JWTSecret   string
+	DatabaseURL          string
+	JWTSecret            string
+	StockAlertWebhookURL string
+
+	// Environment is "production" on live deployments and anything else,
+	// usually empty, in development.
+	Environment string
+
+	// PaymentProvider names the payment gateway (see payments.NewProvider).
+	PaymentProvider string
+
+	// The built-in fake payment provider signs its webhooks with
+	// PaymentWebhookSecret and sends them to PaymentWebhookURL. Webhooks are
+	// rejected while the secret is unset.
+	PaymentWebhookSecret string
+	PaymentWebhookURL    string
+
+	// Receipts are emailed through the SMTP server at SMTPAddr (host:port)
+	// from MailFrom. Without one they are only logged.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
 }
 
 func New() *Config {
 	return &Config{
-		DatabaseURL: os.Getenv("DATABASE_URL"),
-		JWTSecret:   os.Getenv("JWT_SECRET"),
+		DatabaseURL:          os.Getenv("DATABASE_URL"),
+		JWTSecret:            os.Getenv("JWT_SECRET"),
+		StockAlertWebhookURL: os.Getenv("STOCK_ALERT_WEBHOOK_URL"),
+		Environment:          os.Getenv("APP_ENV"),
+		PaymentProvider:      os.Getenv("PAYMENT_PROVIDER"),
+		PaymentWebhookSecret: os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+		PaymentWebhookURL:    os.Getenv("PAYMENT_WEBHOOK_URL"),
+		SMTPAddr:             os.Getenv("SMTP_ADDR"),
+		SMTPUsername:         os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:         os.Getenv("SMTP_PASSWORD"),
+		MailFrom:             os.Getenv("MAIL_FROM"),
 	}
 }
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+)
+
+// AvailabilityWindow restricts when a product can be sold. Every field is
+// optional and an empty field does not restrict anything. Dates are
+// "YYYY-MM-DD" and inclusive; times are "HH:MM" with EndTime exclusive, and
+// a window whose EndTime is before its StartTime runs past midnight.
+// DaysOfWeek follows time.Weekday (0 = Sunday).
+type AvailabilityWindow struct {
+	ID         int64  `json:"id"`
+	ProductID  int64  `json:"product_id"`
+	StartDate  string `json:"start_date,omitempty"`
+	EndDate    string `json:"end_date,omitempty"`
+	DaysOfWeek []int  `json:"days_of_week,omitempty"`
+	StartTime  string `json:"start_time,omitempty"`
+	EndTime    string `json:"end_time,omitempty"`
+}
+
+// Contains reports whether t falls inside the window. t should already be in
+// the store's timezone. The part of an overnight window after midnight
+// belongs to the day the window started on, so its dates and days of week
+// are checked against the day before.
+func (w AvailabilityWindow) Contains(t time.Time) bool {
+	clock := t.Hour()*60 + t.Minute()
+	start, hasStart := clockMinutes(w.StartTime)
+	end, hasEnd := clockMinutes(w.EndTime)
+
+	if hasStart && hasEnd && end < start {
+		switch {
+		case clock >= start:
+			return w.onDay(t)
+		case clock < end:
+			return w.onDay(t.AddDate(0, 0, -1))
+		}
+		return false
+	}
+
+	if hasStart && clock < start {
+		return false
+	}
+	if hasEnd && clock >= end {
+		return false
+	}
+	return w.onDay(t)
+}
+
+// onDay reports whether the window's dates and days of week include the day
+// of t.
+func (w AvailabilityWindow) onDay(t time.Time) bool {
+	date := t.Format("2006-01-02")
+	if w.StartDate != "" && date < w.StartDate {
+		return false
+	}
+	if w.EndDate != "" && date > w.EndDate {
+		return false
+	}
+
+	if len(w.DaysOfWeek) == 0 {
+		return true
+	}
+	for _, d := range w.DaysOfWeek {
+		if time.Weekday(d) == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// clockMinutes returns the minutes since midnight of an "HH:MM" time, and
+// false if it is empty or invalid.
+func clockMinutes(clock string) (int, bool) {
+	if clock == "" {
+		return 0, false
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// IsAvailableAt reports whether a product with the given windows can be sold
+// at t. A product without windows is always available.
+func IsAvailableAt(windows []AvailabilityWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package models
+
+import "github.com/hratsch/zesty-sips-api/pkg/money"
+
+// BundleSlot is one part of a bundle product. A slot with a single option is
+// a fixed component; with several options the customer picks one when
+// ordering. Quantity is how many of the chosen product one bundle contains.
+type BundleSlot struct {
+	ID       int64          `json:"id"`
+	BundleID int64          `json:"bundle_id"`
+	Name     string         `json:"name"`
+	Quantity int            `json:"quantity"`
+	Options  []BundleOption `json:"options"`
+}
+
+// BundleOption is a product that can fill a slot. PriceAdjustment is the
+// surcharge (or discount, if negative) for choosing it.
+type BundleOption struct {
+	ProductID       int64       `json:"product_id"`
+	ProductName     string      `json:"product_name,omitempty"`
+	PriceAdjustment money.Money `json:"price_adjustment"`
+}
+
+// OrderItemComponent is a product a bundle on an order was made of. Quantity
+// is the total taken from stock for the whole order item.
+type OrderItemComponent struct {
+	ID              int64       `json:"id"`
+	SlotID          *int64      `json:"slot_id,omitempty"`
+	SlotName        string      `json:"slot_name"`
+	ProductID       int64       `json:"product_id"`
+	ProductName     string      `json:"product_name,omitempty"`
+	Quantity        int         `json:"quantity"`
+	PriceAdjustment money.Money `json:"price_adjustment"`
+}
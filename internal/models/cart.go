@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// Cart is a customer's order in progress. It is kept on the server so it
+// follows the customer between devices, and expires after ExpiresAt unless
+// it is changed again. Pricing is worked out from the catalog each time the
+// cart is read; it is nil until the cart has a store and items, and
+// PricingError explains why the cart cannot be priced as it stands.
+type Cart struct {
+	ID               int64         `json:"id"`
+	UserID           int64         `json:"user_id"`
+	StoreID          int64         `json:"store_id,omitempty"`
+	OrderType        string        `json:"order_type,omitempty"`
+	DeliveryAddress  string        `json:"delivery_address,omitempty"`
+	DeliveryPostcode string        `json:"delivery_postcode,omitempty"`
+	DeliveryLocation *GeoPoint     `json:"delivery_location,omitempty"`
+	PromotionCode    string        `json:"promotion_code,omitempty"`
+	ScheduledFor     *time.Time    `json:"scheduled_for,omitempty"`
+	TipAmount        *money.Money  `json:"tip_amount,omitempty"`
+	TipPercent       *int          `json:"tip_percent,omitempty"`
+	Items            []CartItem    `json:"items"`
+	Pricing          *OrderPricing `json:"pricing,omitempty"`
+	PricingError     string        `json:"pricing_error,omitempty"`
+	Version          int           `json:"version"`
+	ExpiresAt        time.Time     `json:"expires_at"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+}
+
+// CartItem is a line in a cart. Selections and ModifierIDs work as they do
+// on OrderItem; UnitPrice, Components and Modifiers are filled in when the
+// cart is priced.
+type CartItem struct {
+	ID          int64                `json:"id"`
+	ProductID   int64                `json:"product_id"`
+	Quantity    int                  `json:"quantity"`
+	Selections  map[int64]int64      `json:"selections,omitempty"`
+	ModifierIDs []int64              `json:"modifier_ids,omitempty"`
+	UnitPrice   *money.Money         `json:"unit_price,omitempty"`
+	Components  []OrderItemComponent `json:"components,omitempty"`
+	Modifiers   []OrderItemModifier  `json:"modifiers,omitempty"`
+}
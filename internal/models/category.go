@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+type Category struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Locale is the language Name and Description are in. It is only set
+	// when the category was localized for a request.
+	Locale string `json:"locale,omitempty"`
+}
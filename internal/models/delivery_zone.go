@@ -0,0 +1,86 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// GeoPoint is a position in decimal degrees.
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// DeliveryZone is an area a store delivers to, with its own fee, minimum
+// order (on the discounted subtotal) and estimated delivery time. An
+// address is in the zone if its postcode is listed or its location is
+// inside Polygon.
+type DeliveryZone struct {
+	ID           int64       `json:"id"`
+	StoreID      int64       `json:"store_id"`
+	Name         string      `json:"name"`
+	Postcodes    []string    `json:"postcodes,omitempty"`
+	Polygon      []GeoPoint  `json:"polygon,omitempty"`
+	Fee          money.Money `json:"fee"`
+	MinimumOrder money.Money `json:"minimum_order"`
+	ETAMinutes   int         `json:"eta_minutes"`
+	IsActive     bool        `json:"is_active"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// NormalizePostcode upper-cases a postcode and drops spaces and dashes, so
+// "sw1a 1aa" and "SW1A1AA" compare equal.
+func NormalizePostcode(postcode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '\t' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(postcode))
+}
+
+// Covers reports whether an address with the given postcode or location is
+// in the zone. Either may be empty.
+func (z DeliveryZone) Covers(postcode string, location *GeoPoint) bool {
+	if postcode = NormalizePostcode(postcode); postcode != "" {
+		for _, p := range z.Postcodes {
+			if NormalizePostcode(p) == postcode {
+				return true
+			}
+		}
+	}
+	return location != nil && PolygonContains(z.Polygon, *location)
+}
+
+// Contradicts reports whether the zone rules out an address with the given
+// postcode and location: the zone lists postcodes and the postcode is not
+// one of them, or it has a polygon and the location is outside it. Either
+// may be empty.
+func (z DeliveryZone) Contradicts(postcode string, location *GeoPoint) bool {
+	if NormalizePostcode(postcode) != "" && len(z.Postcodes) > 0 && !z.Covers(postcode, nil) {
+		return true
+	}
+	return location != nil && len(z.Polygon) >= 3 && !PolygonContains(z.Polygon, *location)
+}
+
+// PolygonContains reports whether p lies inside polygon, using the
+// even-odd rule. The polygon is closed implicitly and treated as flat,
+// which is accurate enough at the size of a delivery area.
+func PolygonContains(polygon []GeoPoint, p GeoPoint) bool {
+	if len(polygon) < 3 {
+		return false
+	}
+
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
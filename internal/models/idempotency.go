@@ -0,0 +1,28 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord is a request made with an Idempotency-Key and, once it
+// has finished, the response that was sent. Fingerprint identifies the
+// request (method, path and body) so a key cannot be reused for a
+// different one.
+type IdempotencyRecord struct {
+	UserID      int64
+	Key         string
+	Method      string
+	Path        string
+	Fingerprint string
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// Completed reports whether the original request has finished.
+func (r *IdempotencyRecord) Completed() bool {
+	return r.CompletedAt != nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// Reasons recorded on inventory movements.
+const (
+	MovementSale         = "sale"
+	MovementCancellation = "cancellation"
+	MovementRestock      = "restock"
+	MovementAdjustment   = "adjustment"
+	MovementWaste        = "waste"
+)
+
+// InventoryMovement is one entry in the append-only stock ledger.
+// QuantityChange is negative when stock leaves the store.
+type InventoryMovement struct {
+	ID             int64     `json:"id"`
+	StoreID        int64     `json:"store_id"`
+	ProductID      int64     `json:"product_id"`
+	QuantityChange int       `json:"quantity_change"`
+	BalanceAfter   int       `json:"balance_after"`
+	Reason         string    `json:"reason"`
+	ActorID        *int64    `json:"actor_id,omitempty"`
+	OrderID        *int64    `json:"order_id,omitempty"`
+	Note           string    `json:"note,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// InventoryReconciliation compares the stock implied by the ledger with the
+// stock currently recorded for a store.
+type InventoryReconciliation struct {
+	StoreID        int64 `json:"store_id"`
+	ProductID      int64 `json:"product_id"`
+	LedgerQuantity int   `json:"ledger_quantity"`
+	StockQuantity  int   `json:"stock_quantity"`
+	Discrepancy    int   `json:"discrepancy"`
+}
@@ -17,6 +17,6 @@ type LoyaltyTransaction struct {
 	UserID    int64     `json:"user_id"`
 	OrderID   int64     `json:"order_id"`
 	Points    int       `json:"points"`
-	Type      string    `json:"type"` // "earn" or "redeem"
+	Type      string    `json:"type"` // "earn", "redeem", "reversal" or "restore"
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// ProductModifier is a paid extra that can be added to a product, such as
+// an extra shot or a protein boost.
+type ProductModifier struct {
+	ID        int64       `json:"id"`
+	ProductID int64       `json:"product_id"`
+	Name      string      `json:"name"`
+	Price     money.Money `json:"price"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// OrderItemModifier is a modifier as it was charged on an order.
+type OrderItemModifier struct {
+	ID         int64       `json:"id"`
+	ModifierID *int64      `json:"modifier_id,omitempty"`
+	Name       string      `json:"name"`
+	Price      money.Money `json:"price"`
+}
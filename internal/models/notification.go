@@ -0,0 +1,49 @@
+package models
+
+import "fmt"
+
+// Notification is a message to a customer about one of their orders. It
+// does not depend on how it is delivered.
+type Notification struct {
+	UserID  int64  `json:"user_id"`
+	OrderID int64  `json:"order_id"`
+	Status  string `json:"status"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+}
+
+// OrderStatusNotification returns what to tell a customer when their order
+// moves to status, and false for statuses they are not told about, such as
+// the order being placed.
+func OrderStatusNotification(userID, orderID int64, status, orderType string) (*Notification, bool) {
+	var title, body string
+	switch status {
+	case OrderConfirmed:
+		title, body = "Order confirmed", "We've got your order #%d."
+	case OrderPreparing:
+		title, body = "Order in the works", "We're making your order #%d now."
+	case OrderReady:
+		title, body = "Order ready", "Your order #%d is ready for pickup."
+		if orderType == OrderTypeDelivery {
+			body = "Your order #%d is ready and waiting for a driver."
+		}
+	case OrderOutForDelivery:
+		title, body = "On its way", "Your order #%d is out for delivery."
+	case OrderCompleted:
+		title, body = "Enjoy!", "Your order #%d is complete. Thanks for stopping by."
+	case OrderCancelled:
+		title, body = "Order cancelled", "Your order #%d has been cancelled."
+	case OrderRefunded:
+		title, body = "Order refunded", "Your order #%d has been refunded."
+	default:
+		return nil, false
+	}
+
+	return &Notification{
+		UserID:  userID,
+		OrderID: orderID,
+		Status:  status,
+		Title:   title,
+		Body:    fmt.Sprintf(body, orderID),
+	}, true
+}
@@ -2,24 +2,89 @@ package models
 
 import (
 	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
 )
 
+// OrderTypeDelivery orders are taken to the customer and pay the store's
+// delivery fee.
+const OrderTypeDelivery = "delivery"
+
+// OrderPricing is how an order's total was worked out. The total is the
+// subtotal less the discount, plus the delivery fee and tax. When
+// TaxIncluded is set, prices already included tax: TaxAmount is the part of
+// the subtotal that was tax and is not added again. TipAmount is charged on
+// top of the total and goes to staff; loyalty points, promotions and tax
+// ignore it.
+type OrderPricing struct {
+	Subtotal       money.Money `json:"subtotal"`
+	DiscountAmount money.Money `json:"discount_amount"`
+	DeliveryFee    money.Money `json:"delivery_fee"`
+	TaxAmount      money.Money `json:"tax_amount"`
+	TaxIncluded    bool        `json:"tax_included"`
+	TotalAmount    money.Money `json:"total_amount"`
+	TipAmount      money.Money `json:"tip_amount"`
+	TaxLines       []TaxLine   `json:"tax_lines,omitempty"`
+}
+
 type Order struct {
 	ID              int64       `json:"id"`
 	UserID          int64       `json:"user_id"`
-	TotalAmount     float64     `json:"total_amount"`
+	StoreID         int64       `json:"store_id"`
 	Status          string      `json:"status"`
 	OrderType       string      `json:"order_type"`
 	DeliveryAddress string      `json:"delivery_address,omitempty"`
+	Version         int         `json:"version"`
 	CreatedAt       time.Time   `json:"created_at"`
 	UpdatedAt       time.Time   `json:"updated_at"`
 	Items           []OrderItem `json:"items"`
+	PromotionCode   string      `json:"promotion_code,omitempty"`
+	Refunds         []Refund    `json:"refunds,omitempty"`
+
+	// DeliveryPostcode and DeliveryLocation place a delivery order in one
+	// of the store's delivery zones. The zone that matched and its
+	// estimated delivery time are filled in when the order is priced.
+	DeliveryPostcode   string    `json:"delivery_postcode,omitempty"`
+	DeliveryLocation   *GeoPoint `json:"delivery_location,omitempty"`
+	DeliveryZoneID     *int64    `json:"delivery_zone_id,omitempty"`
+	DeliveryETAMinutes *int      `json:"delivery_eta_minutes,omitempty"`
+
+	// ScheduledFor asks for the order to be ready for pickup or delivery at
+	// the start of one of the store's time slots. It is nil for orders
+	// wanted as soon as possible.
+	ScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+
+	// Pricing is always worked out on the server; amounts sent by the
+	// client are ignored, except for a fixed TipAmount. TipPercent instead
+	// picks one of the TipPresets.
+	OrderPricing
+	TipPercent *int `json:"tip_percent,omitempty"`
+
+	// ReservationID is set on create to check out against held stock.
+	ReservationID int64 `json:"reservation_id,omitempty"`
 }
 
 type OrderItem struct {
-	ID        int64   `json:"id"`
-	OrderID   int64   `json:"order_id"`
-	ProductID int64   `json:"product_id"`
-	Quantity  int     `json:"quantity"`
-	UnitPrice float64 `json:"unit_price"`
+	ID        int64       `json:"id"`
+	OrderID   int64       `json:"order_id"`
+	ProductID int64       `json:"product_id"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+
+	// TaxCategory is the product's tax category when the order was placed.
+	TaxCategory string `json:"tax_category,omitempty"`
+
+	// CancelledQuantity is how many of Quantity have been cancelled since
+	// the order was placed.
+	CancelledQuantity int `json:"cancelled_quantity,omitempty"`
+
+	// Selections picks a product for each choice slot of a bundle, keyed by
+	// slot ID. Components is the resulting breakdown.
+	Selections map[int64]int64      `json:"selections,omitempty"`
+	Components []OrderItemComponent `json:"components,omitempty"`
+
+	// ModifierIDs picks the product's modifiers to add. Modifiers is what
+	// was charged for them.
+	ModifierIDs []int64             `json:"modifier_ids,omitempty"`
+	Modifiers   []OrderItemModifier `json:"modifiers,omitempty"`
 }
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	OrderPending        = "pending"
+	OrderConfirmed      = "confirmed"
+	OrderPreparing      = "preparing"
+	OrderReady          = "ready"
+	OrderOutForDelivery = "out_for_delivery"
+	OrderCompleted      = "completed"
+	OrderCancelled      = "cancelled"
+	OrderRefunded       = "refunded"
+)
+
+// orderTransitions lists the statuses an order can move to from each status
+// and the roles allowed to make each move. Admins may make any listed move.
+// Completed and cancelled orders can only be refunded, by an admin.
+var orderTransitions = map[string]map[string][]string{
+	OrderPending: {
+		OrderConfirmed: {RoleStaff},
+		OrderCancelled: {RoleCustomer, RoleStaff},
+	},
+	OrderConfirmed: {
+		OrderPreparing: {RoleStaff},
+		OrderCancelled: {RoleCustomer, RoleStaff},
+	},
+	OrderPreparing: {
+		OrderReady:     {RoleStaff},
+		OrderCancelled: {RoleStaff},
+	},
+	OrderReady: {
+		OrderOutForDelivery: {RoleStaff, RoleDriver},
+		OrderCompleted:      {RoleStaff},
+	},
+	OrderOutForDelivery: {
+		OrderCompleted: {RoleStaff, RoleDriver},
+	},
+	OrderCompleted: {
+		OrderRefunded: {},
+	},
+	OrderCancelled: {
+		OrderRefunded: {},
+	},
+}
+
+// IsOrderStatus reports whether status is one of the order lifecycle states.
+func IsOrderStatus(status string) bool {
+	switch status {
+	case OrderPending, OrderConfirmed, OrderPreparing, OrderReady,
+		OrderOutForDelivery, OrderCompleted, OrderCancelled, OrderRefunded:
+		return true
+	}
+	return false
+}
+
+// IsOrderTransition reports whether the lifecycle has a move from one
+// status to another, regardless of who makes it.
+func IsOrderTransition(from, to string) bool {
+	_, ok := orderTransitions[from][to]
+	return ok
+}
+
+// CanTransitionOrder reports whether a user with role may move an order
+// from one status to another.
+func CanTransitionOrder(from, to, role string) bool {
+	roles, ok := orderTransitions[from][to]
+	if !ok {
+		return false
+	}
+	if role == RoleAdmin {
+		return true
+	}
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOrderStatuses returns the statuses role can move an order in status
+// to, sorted by name.
+func NextOrderStatuses(status, role string) []string {
+	var next []string
+	for to := range orderTransitions[status] {
+		if CanTransitionOrder(status, to, role) {
+			next = append(next, to)
+		}
+	}
+	sort.Strings(next)
+	return next
+}
+
+// OrderStatusChange is one step in an order's lifecycle. FromStatus is empty
+// for the order being placed.
+type OrderStatusChange struct {
+	ID         int64     `json:"id"`
+	OrderID    int64     `json:"order_id"`
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status"`
+	ActorID    *int64    `json:"actor_id,omitempty"`
+	ActorRole  string    `json:"actor_role,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Order event types.
+const (
+	OrderEventCreated       = "order.created"
+	OrderEventStatusChanged = "order.status_changed"
+)
+
+// OrderEvent is an order being placed or changing status, as pushed to live
+// displays. Events are read from the order status history, whose IDs give
+// their order and are the cursor a stream resumes from.
+type OrderEvent struct {
+	ID         int64     `json:"id"`
+	Type       string    `json:"type"`
+	OrderID    int64     `json:"order_id"`
+	StoreID    int64     `json:"store_id"`
+	FromStatus string    `json:"from_status,omitempty"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OrderEventType returns the type of event for a status change; a change
+// with no FromStatus is the order being placed.
+func OrderEventType(fromStatus string) string {
+	if fromStatus == "" {
+		return OrderEventCreated
+	}
+	return OrderEventStatusChanged
+}
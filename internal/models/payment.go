@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+const (
+	PaymentPending    = "pending"
+	PaymentAuthorized = "authorized"
+	PaymentDeclined   = "declined"
+	PaymentCaptured   = "captured"
+	PaymentVoided     = "voided"
+	PaymentRefunded   = "refunded"
+)
+
+// Payment is an attempt to pay for an order through a payment provider.
+// Amount is what was authorized; CapturedAmount and RefundedAmount are what
+// has actually been taken and given back.
+type Payment struct {
+	ID                int64       `json:"id"`
+	OrderID           int64       `json:"order_id"`
+	Provider          string      `json:"provider"`
+	ProviderReference string      `json:"provider_reference,omitempty"`
+	Status            string      `json:"status"`
+	Amount            money.Money `json:"amount"`
+	CapturedAmount    money.Money `json:"captured_amount"`
+	RefundedAmount    money.Money `json:"refunded_amount"`
+	DeclineReason     string      `json:"decline_reason,omitempty"`
+	CreatedAt         time.Time   `json:"created_at"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+}
@@ -2,15 +2,34 @@ package models
 
 import (
 	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
 )
 
 type Product struct {
-	ID            int64     `json:"id"`
-	Name          string    `json:"name"`
-	Description   string    `json:"description"`
-	Size          string    `json:"size"`
-	Price         float64   `json:"price"`
-	StockQuantity int       `json:"stock_quantity"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID               int64       `json:"id"`
+	Name             string      `json:"name"`
+	Description      string      `json:"description"`
+	Size             string      `json:"size"`
+	CategoryID       *int64      `json:"category_id,omitempty"`
+	Price            money.Money `json:"price"`
+	ReorderThreshold int         `json:"reorder_threshold"`
+	IsBundle         bool        `json:"is_bundle"`
+	TaxCategory      string      `json:"tax_category"`
+	Version          int         `json:"version"`
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+
+	// StockQuantity is read-only. It is the product's stock at one store
+	// when listed for that store, and the total across stores otherwise;
+	// stock changes through store stock levels and adjustments.
+	StockQuantity int `json:"stock_quantity"`
+
+	// AvailableQuantity is stock minus live reservations. It is only set
+	// when the product is listed for a specific store.
+	AvailableQuantity *int `json:"available_quantity,omitempty"`
+
+	// Locale is the language Name and Description are in. It is only set
+	// when the product was localized for a request.
+	Locale string `json:"locale,omitempty"`
 }
@@ -12,6 +12,8 @@ type Promotion struct {
 	StartDate       time.Time `json:"start_date"`
 	EndDate         time.Time `json:"end_date"`
 	IsActive        bool      `json:"is_active"`
+	MaxRedemptions  *int      `json:"max_redemptions,omitempty"` // nil is unlimited
+	Version         int       `json:"version"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 }
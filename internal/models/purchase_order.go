@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+const (
+	PurchaseOrderDraft             = "draft"
+	PurchaseOrderOrdered           = "ordered"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+	PurchaseOrderCancelled         = "cancelled"
+)
+
+type PurchaseOrder struct {
+	ID           int64               `json:"id"`
+	SupplierID   int64               `json:"supplier_id"`
+	StoreID      int64               `json:"store_id"`
+	Status       string              `json:"status"`
+	ExpectedDate *time.Time          `json:"expected_date,omitempty"`
+	Notes        string              `json:"notes"`
+	CreatedBy    int64               `json:"created_by"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	Items        []PurchaseOrderItem `json:"items"`
+}
+
+type PurchaseOrderItem struct {
+	ID               int64                  `json:"id"`
+	PurchaseOrderID  int64                  `json:"purchase_order_id"`
+	ProductID        int64                  `json:"product_id"`
+	QuantityOrdered  int                    `json:"quantity_ordered"`
+	QuantityReceived int                    `json:"quantity_received"`
+	UnitCost         money.Money            `json:"unit_cost"`
+	Receipts         []PurchaseOrderReceipt `json:"receipts,omitempty"`
+}
+
+// PurchaseOrderReceipt records one delivery against a purchase order line,
+// with the unit cost actually paid for it.
+type PurchaseOrderReceipt struct {
+	ID         int64       `json:"id"`
+	ItemID     int64       `json:"purchase_order_item_id"`
+	Quantity   int         `json:"quantity"`
+	UnitCost   money.Money `json:"unit_cost"`
+	ReceivedBy int64       `json:"received_by"`
+	ReceivedAt time.Time   `json:"received_at"`
+}
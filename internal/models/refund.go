@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// Refund is money owed back to a customer for a cancelled order, or for
+// the cancelled part of a line when OrderItemID is set.
+type Refund struct {
+	ID          int64       `json:"id"`
+	OrderID     int64       `json:"order_id"`
+	OrderItemID *int64      `json:"order_item_id,omitempty"`
+	Amount      money.Money `json:"amount"`
+	Reason      string      `json:"reason"`
+	CreatedBy   int64       `json:"created_by"`
+	CreatedAt   time.Time   `json:"created_at"`
+
+	// PaymentID and SettledAt are set once the refund has been paid back
+	// through the order's payment, or found to need no money moved.
+	PaymentID         *int64     `json:"payment_id,omitempty"`
+	ProviderReference string     `json:"provider_reference,omitempty"`
+	SettledAt         *time.Time `json:"settled_at,omitempty"`
+}
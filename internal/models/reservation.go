@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	ReservationActive    = "active"
+	ReservationConverted = "converted"
+	ReservationReleased  = "released"
+)
+
+// Reservation holds stock at a store for a customer while they check out.
+// Active reservations stop counting against stock once ExpiresAt passes.
+type Reservation struct {
+	ID        int64             `json:"id"`
+	UserID    int64             `json:"user_id"`
+	StoreID   int64             `json:"store_id"`
+	Status    string            `json:"status"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	OrderID   *int64            `json:"order_id,omitempty"`
+	Items     []ReservationItem `json:"items"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+type ReservationItem struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int   `json:"quantity"`
+}
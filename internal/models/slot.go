@@ -0,0 +1,75 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Scheduling defaults used when a store leaves its settings at zero, and
+// how far ahead customers may schedule an order.
+const (
+	DefaultSlotMinutes  = 15
+	DefaultSlotCapacity = 10
+	DefaultPrepMinutes  = 15
+	MaxScheduleDays     = 7
+)
+
+// TimeSlot is a window a customer can ask for their order to be ready in.
+// Booked counts the live orders already scheduled into it.
+type TimeSlot struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Capacity  int       `json:"capacity"`
+	Booked    int       `json:"booked"`
+	Available bool      `json:"available"`
+}
+
+// DaySlots splits the opening hours of day's weekday into back-to-back
+// slots of the given length, in day's location. Opening hours whose close
+// time is not after the open time run past midnight, and their slots belong
+// to the day they opened on. A slot that would run past closing is left
+// out.
+func DaySlots(hours []StoreHours, day time.Time, length time.Duration) []TimeSlot {
+	if length <= 0 {
+		return nil
+	}
+
+	var slots []TimeSlot
+	for _, h := range hours {
+		if time.Weekday(h.DayOfWeek) != day.Weekday() {
+			continue
+		}
+		opens, err1 := time.Parse("15:04", h.OpenTime)
+		closes, err2 := time.Parse("15:04", h.CloseTime)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		start := time.Date(day.Year(), day.Month(), day.Day(), opens.Hour(), opens.Minute(), 0, 0, day.Location())
+		end := time.Date(day.Year(), day.Month(), day.Day(), closes.Hour(), closes.Minute(), 0, 0, day.Location())
+		if !end.After(start) {
+			end = end.AddDate(0, 0, 1)
+		}
+
+		for t := start; !t.Add(length).After(end); t = t.Add(length) {
+			slots = append(slots, TimeSlot{Start: t, End: t.Add(length)})
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Start.Before(slots[j].Start) })
+	return slots
+}
+
+// FindSlot returns the slot that starts exactly at t, looking at the
+// opening hours of t's day and of the day before in case they run past
+// midnight. t should already be in the store's timezone.
+func FindSlot(hours []StoreHours, t time.Time, length time.Duration) (TimeSlot, bool) {
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		for _, slot := range DaySlots(hours, day, length) {
+			if slot.Start.Equal(t) {
+				return slot, true
+			}
+		}
+	}
+	return TimeSlot{}, false
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// StockAlert is raised when a store's stock of a product drops below the
+// product's reorder threshold.
+type StockAlert struct {
+	ID               int64      `json:"id"`
+	StoreID          int64      `json:"store_id"`
+	ProductID        int64      `json:"product_id"`
+	ProductName      string     `json:"product_name"`
+	StockQuantity    int        `json:"stock_quantity"`
+	ReorderThreshold int        `json:"reorder_threshold"`
+	NotifiedAt       *time.Time `json:"notified_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
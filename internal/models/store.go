@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+type Store struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Timezone string `json:"timezone"`
+
+	// The store charges the tax rates of TaxJurisdiction and its own. With
+	// PricesIncludeTax, prices already include tax. DeliveryFee is added to
+	// delivery orders while the store has no active delivery zones; once it
+	// does, each zone sets its own fee.
+	TaxJurisdiction  string      `json:"tax_jurisdiction,omitempty"`
+	PricesIncludeTax bool        `json:"prices_include_tax"`
+	DeliveryFee      money.Money `json:"delivery_fee"`
+
+	// Scheduled orders are taken for SlotMinutes-long slots, at most
+	// SlotCapacity per slot, and prepared from PrepMinutes before their slot.
+	// Zero values take the Default* settings.
+	SlotMinutes  int `json:"slot_minutes"`
+	SlotCapacity int `json:"slot_capacity"`
+	PrepMinutes  int `json:"prep_minutes"`
+
+	Hours     []StoreHours `json:"hours"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// StoreHours describes when a store is open on a given weekday. Times are
+// "HH:MM" in the store's timezone; DayOfWeek follows time.Weekday (0 = Sunday).
+type StoreHours struct {
+	DayOfWeek int    `json:"day_of_week"`
+	OpenTime  string `json:"open_time"`
+	CloseTime string `json:"close_time"`
+}
+
+// StoreProduct holds a store's own stock level for a product and an optional
+// price that overrides the catalog price at that store.
+type StoreProduct struct {
+	StoreID       int64        `json:"store_id"`
+	ProductID     int64        `json:"product_id"`
+	StockQuantity int          `json:"stock_quantity"`
+	Price         *money.Money `json:"price,omitempty"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
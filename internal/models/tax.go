@@ -0,0 +1,47 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// TaxCategoryStandard is the tax category of products that do not name one.
+const TaxCategoryStandard = "standard"
+
+// NormalizeTaxCategory lower-cases a tax category, defaulting to
+// TaxCategoryStandard.
+func NormalizeTaxCategory(category string) string {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category == "" {
+		return TaxCategoryStandard
+	}
+	return category
+}
+
+// TaxRate is a percentage charged on products of one tax category, in all
+// stores of Jurisdiction or in the store StoreID; exactly one is set.
+type TaxRate struct {
+	ID           int64     `json:"id"`
+	Jurisdiction string    `json:"jurisdiction,omitempty"`
+	StoreID      *int64    `json:"store_id,omitempty"`
+	TaxCategory  string    `json:"tax_category"`
+	Name         string    `json:"name"`
+	Rate         float64   `json:"rate"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TaxLine is the tax one rate charged on an order's items of one tax
+// category. TaxableAmount is their subtotal after discount.
+type TaxLine struct {
+	ID            int64       `json:"id,omitempty"`
+	TaxRateID     *int64      `json:"tax_rate_id,omitempty"`
+	Name          string      `json:"name"`
+	Jurisdiction  string      `json:"jurisdiction,omitempty"`
+	TaxCategory   string      `json:"tax_category"`
+	Rate          float64     `json:"rate"`
+	TaxableAmount money.Money `json:"taxable_amount"`
+	TaxAmount     money.Money `json:"tax_amount"`
+}
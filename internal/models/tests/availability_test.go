@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/models"
+)
+
+func TestAvailabilityWindowContains(t *testing.T) {
+	// Saturday 2024-06-15
+	at := func(clock string) time.Time {
+		tm, _ := time.Parse("2006-01-02 15:04", "2024-06-15 "+clock)
+		return tm
+	}
+
+	summerWeekends := models.AvailabilityWindow{
+		StartDate:  "2024-06-01",
+		EndDate:    "2024-08-31",
+		DaysOfWeek: []int{0, 6},
+	}
+	assert.True(t, summerWeekends.Contains(at("12:00")))
+	assert.False(t, summerWeekends.Contains(at("12:00").AddDate(0, 0, 2)))
+	assert.False(t, summerWeekends.Contains(at("12:00").AddDate(0, 3, 0)))
+
+	breakfast := models.AvailabilityWindow{EndTime: "11:00"}
+	assert.True(t, breakfast.Contains(at("10:59")))
+	assert.False(t, breakfast.Contains(at("11:00")))
+
+	lateNight := models.AvailabilityWindow{StartTime: "22:00", EndTime: "02:00"}
+	assert.True(t, lateNight.Contains(at("23:30")))
+	assert.True(t, lateNight.Contains(at("01:00")))
+	assert.False(t, lateNight.Contains(at("12:00")))
+}
+
+func TestIsAvailableAt(t *testing.T) {
+	now := time.Date(2024, 6, 15, 9, 0, 0, 0, time.UTC)
+
+	assert.True(t, models.IsAvailableAt(nil, now))
+	assert.True(t, models.IsAvailableAt([]models.AvailabilityWindow{
+		{StartTime: "12:00"},
+		{EndTime: "11:00"},
+	}, now))
+	assert.False(t, models.IsAvailableAt([]models.AvailabilityWindow{
+		{StartTime: "12:00"},
+	}, now))
+}
+
+func TestAvailabilityWindowContainsTimes(t *testing.T) {
+	// Friday 2024-06-14 and Saturday 2024-06-15
+	friday := func(clock string) time.Time {
+		tm, _ := time.Parse("2006-01-02 15:04", "2024-06-14 "+clock)
+		return tm
+	}
+	saturday := func(clock string) time.Time {
+		return friday(clock).AddDate(0, 0, 1)
+	}
+
+	fridayLate := models.AvailabilityWindow{DaysOfWeek: []int{5}, StartTime: "22:00", EndTime: "02:00"}
+	lastNight := models.AvailabilityWindow{EndDate: "2024-06-14", StartTime: "22:00", EndTime: "02:00"}
+
+	tests := []struct {
+		name   string
+		window models.AvailabilityWindow
+		at     time.Time
+		want   bool
+	}{
+		{"single digit hour before start", models.AvailabilityWindow{StartTime: "9:00", EndTime: "17:00"}, friday("08:30"), false},
+		{"single digit hour after start", models.AvailabilityWindow{StartTime: "9:00", EndTime: "17:00"}, friday("10:00"), true},
+		{"single digit hour end", models.AvailabilityWindow{EndTime: "9:30"}, friday("10:00"), false},
+		{"overnight before midnight", fridayLate, friday("23:00"), true},
+		{"overnight after midnight", fridayLate, saturday("01:00"), true},
+		{"overnight after end", fridayLate, saturday("02:00"), false},
+		{"overnight after midnight of the wrong day", fridayLate, friday("01:00"), false},
+		{"overnight before midnight of the wrong day", fridayLate, saturday("23:00"), false},
+		{"overnight past the last date", lastNight, saturday("01:00"), true},
+		{"overnight starting after the last date", lastNight, saturday("23:00"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.window.Contains(tt.at))
+		})
+	}
+}
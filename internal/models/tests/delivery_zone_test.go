@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/models"
+)
+
+func TestNormalizePostcode(t *testing.T) {
+	assert.Equal(t, "SW1A1AA", models.NormalizePostcode(" sw1a 1aa "))
+	assert.Equal(t, "12345", models.NormalizePostcode("123-45"))
+	assert.Equal(t, "", models.NormalizePostcode("  "))
+}
+
+func TestPolygonContains(t *testing.T) {
+	// An L-shaped area: a 2x2 square with its top-right quarter cut out
+	polygon := []models.GeoPoint{
+		{Lat: 0, Lng: 0}, {Lat: 0, Lng: 2}, {Lat: 1, Lng: 2},
+		{Lat: 1, Lng: 1}, {Lat: 2, Lng: 1}, {Lat: 2, Lng: 0},
+	}
+
+	assert.True(t, models.PolygonContains(polygon, models.GeoPoint{Lat: 0.5, Lng: 0.5}))
+	assert.True(t, models.PolygonContains(polygon, models.GeoPoint{Lat: 0.5, Lng: 1.5}))
+	assert.True(t, models.PolygonContains(polygon, models.GeoPoint{Lat: 1.5, Lng: 0.5}))
+	assert.False(t, models.PolygonContains(polygon, models.GeoPoint{Lat: 1.5, Lng: 1.5}))
+	assert.False(t, models.PolygonContains(polygon, models.GeoPoint{Lat: -0.5, Lng: 0.5}))
+	assert.False(t, models.PolygonContains(polygon[:2], models.GeoPoint{Lat: 0, Lng: 1}))
+}
+
+func TestDeliveryZoneCovers(t *testing.T) {
+	zone := models.DeliveryZone{
+		Postcodes: []string{"SW1A1AA"},
+		Polygon:   []models.GeoPoint{{Lat: 51.5, Lng: -0.2}, {Lat: 51.5, Lng: -0.1}, {Lat: 51.6, Lng: -0.15}},
+	}
+
+	assert.True(t, zone.Covers("sw1a 1aa", nil))
+	assert.True(t, zone.Covers("", &models.GeoPoint{Lat: 51.52, Lng: -0.15}))
+	assert.True(t, zone.Covers("E1 6AN", &models.GeoPoint{Lat: 51.52, Lng: -0.15}))
+	assert.False(t, zone.Covers("E1 6AN", nil))
+	assert.False(t, zone.Covers("", &models.GeoPoint{Lat: 51.52, Lng: 0}))
+	assert.False(t, zone.Covers("", nil))
+}
+
+func TestDeliveryZoneContradicts(t *testing.T) {
+	zone := models.DeliveryZone{
+		Postcodes: []string{"SW1A1AA"},
+		Polygon:   []models.GeoPoint{{Lat: 51.5, Lng: -0.2}, {Lat: 51.5, Lng: -0.1}, {Lat: 51.6, Lng: -0.15}},
+	}
+
+	assert.False(t, zone.Contradicts("sw1a 1aa", &models.GeoPoint{Lat: 51.52, Lng: -0.15}))
+	assert.False(t, zone.Contradicts("", nil))
+	assert.True(t, zone.Contradicts("E1 6AN", &models.GeoPoint{Lat: 51.52, Lng: -0.15}))
+	assert.True(t, zone.Contradicts("SW1A 1AA", &models.GeoPoint{Lat: 51.52, Lng: 0}))
+
+	// A zone with only postcodes has nothing to say about locations
+	postcodesOnly := models.DeliveryZone{Postcodes: zone.Postcodes}
+	assert.False(t, postcodesOnly.Contradicts("SW1A 1AA", &models.GeoPoint{Lat: 0, Lng: 0}))
+}
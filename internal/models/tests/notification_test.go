@@ -0,0 +1,26 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/models"
+)
+
+func TestOrderStatusNotification(t *testing.T) {
+	n, ok := models.OrderStatusNotification(3, 42, models.OrderReady, "pickup")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), n.UserID)
+	assert.Equal(t, int64(42), n.OrderID)
+	assert.Equal(t, models.OrderReady, n.Status)
+	assert.Equal(t, "Your order #42 is ready for pickup.", n.Body)
+
+	n, ok = models.OrderStatusNotification(3, 42, models.OrderReady, models.OrderTypeDelivery)
+	assert.True(t, ok)
+	assert.Equal(t, "Your order #42 is ready and waiting for a driver.", n.Body)
+}
+
+func TestOrderStatusNotificationSkipsPending(t *testing.T) {
+	_, ok := models.OrderStatusNotification(3, 42, models.OrderPending, "pickup")
+	assert.False(t, ok)
+}
@@ -0,0 +1,31 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/models"
+)
+
+func TestCanTransitionOrder(t *testing.T) {
+	assert.True(t, models.CanTransitionOrder(models.OrderPending, models.OrderConfirmed, models.RoleStaff))
+	assert.False(t, models.CanTransitionOrder(models.OrderPending, models.OrderConfirmed, models.RoleCustomer))
+	assert.True(t, models.CanTransitionOrder(models.OrderPending, models.OrderCancelled, models.RoleCustomer))
+	assert.False(t, models.CanTransitionOrder(models.OrderPreparing, models.OrderCancelled, models.RoleCustomer))
+	assert.True(t, models.CanTransitionOrder(models.OrderOutForDelivery, models.OrderCompleted, models.RoleDriver))
+
+	// Terminal states cannot be reopened, even by admins
+	assert.False(t, models.CanTransitionOrder(models.OrderCancelled, models.OrderPreparing, models.RoleAdmin))
+	assert.False(t, models.IsOrderTransition(models.OrderCompleted, models.OrderPending))
+
+	// Only admins refund
+	assert.True(t, models.CanTransitionOrder(models.OrderCompleted, models.OrderRefunded, models.RoleAdmin))
+	assert.False(t, models.CanTransitionOrder(models.OrderCompleted, models.OrderRefunded, models.RoleStaff))
+}
+
+func TestNextOrderStatuses(t *testing.T) {
+	assert.Equal(t, []string{"out_for_delivery"}, models.NextOrderStatuses(models.OrderReady, models.RoleDriver))
+	assert.Equal(t, []string{"completed", "out_for_delivery"}, models.NextOrderStatuses(models.OrderReady, models.RoleStaff))
+	assert.Empty(t, models.NextOrderStatuses(models.OrderRefunded, models.RoleAdmin))
+	assert.False(t, models.IsOrderStatus("prepraing"))
+}
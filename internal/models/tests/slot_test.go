@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/models"
+)
+
+func TestDaySlots(t *testing.T) {
+	// Saturday 2024-06-15
+	day := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	hours := []models.StoreHours{
+		{DayOfWeek: 6, OpenTime: "14:00", CloseTime: "15:00"},
+		{DayOfWeek: 6, OpenTime: "07:00", CloseTime: "08:10"},
+		{DayOfWeek: 0, OpenTime: "07:00", CloseTime: "18:00"},
+	}
+
+	slots := models.DaySlots(hours, day, 30*time.Minute)
+	var starts []string
+	for _, s := range slots {
+		starts = append(starts, s.Start.Format("15:04"))
+	}
+	assert.Equal(t, []string{"07:00", "07:30", "14:00", "14:30"}, starts)
+	assert.Equal(t, "07:30", slots[0].End.Format("15:04"))
+
+	assert.Empty(t, models.DaySlots(hours, day.AddDate(0, 0, 1), 0))
+	assert.Empty(t, models.DaySlots(hours, day.AddDate(0, 0, 2), 30*time.Minute))
+}
+
+func TestFindSlotPastMidnight(t *testing.T) {
+	hours := []models.StoreHours{{DayOfWeek: 5, OpenTime: "22:00", CloseTime: "02:00"}}
+
+	// 01:00 on Saturday belongs to Friday night's opening hours
+	slot, ok := models.FindSlot(hours, time.Date(2024, 6, 15, 1, 0, 0, 0, time.UTC), time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 6, 15, 2, 0, 0, 0, time.UTC), slot.End)
+
+	_, ok = models.FindSlot(hours, time.Date(2024, 6, 15, 1, 30, 0, 0, time.UTC), time.Hour)
+	assert.False(t, ok)
+
+	_, ok = models.FindSlot(hours, time.Date(2024, 6, 15, 2, 0, 0, 0, time.UTC), time.Hour)
+	assert.False(t, ok)
+}
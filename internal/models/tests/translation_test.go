@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/models"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(t, []string{"es-mx", "es", "en"}, models.ParseAcceptLanguage("en;q=0.5, es-MX, es;q=0.8"))
+	assert.Equal(t, []string{"fr"}, models.ParseAcceptLanguage("*, fr, de;q=0"))
+	assert.Empty(t, models.ParseAcceptLanguage(""))
+}
+
+func TestPickTranslation(t *testing.T) {
+	translations := map[string]models.Translation{
+		"es":    {Locale: "es", Name: "Batido de fresa"},
+		"es-mx": {Locale: "es-mx", Name: "Licuado de fresa"},
+	}
+
+	tr, ok := models.PickTranslation(translations, []string{"es-mx"})
+	assert.True(t, ok)
+	assert.Equal(t, "Licuado de fresa", tr.Name)
+
+	// Regional variants fall back to the primary language
+	tr, ok = models.PickTranslation(translations, []string{"es-ar"})
+	assert.True(t, ok)
+	assert.Equal(t, "Batido de fresa", tr.Name)
+
+	// Preferring the default language keeps the untranslated text
+	_, ok = models.PickTranslation(translations, []string{"en-gb", "es"})
+	assert.False(t, ok)
+
+	_, ok = models.PickTranslation(translations, []string{"fr"})
+	assert.False(t, ok)
+}
@@ -0,0 +1,14 @@
+package models
+
+// TipPresets are the tip percentages offered at checkout.
+var TipPresets = []int{10, 15, 20}
+
+// IsTipPreset reports whether percent is one of TipPresets.
+func IsTipPreset(percent int) bool {
+	for _, p := range TipPresets {
+		if p == percent {
+			return true
+		}
+	}
+	return false
+}
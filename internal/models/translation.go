@@ -0,0 +1,112 @@
+package models
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLanguage is the language product and category text is written in.
+// Translations supply the text in every other language.
+const DefaultLanguage = "en"
+
+// Translation is a product's or category's text in one language. An empty
+// Description falls back to the untranslated one.
+type Translation struct {
+	Locale      string    `json:"locale"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// NormalizeLocale lowercases a language tag and separates subtags with
+// hyphens, so "es_MX" becomes "es-mx". It returns "" if tag is not a valid
+// language tag.
+func NormalizeLocale(tag string) string {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if !localePattern.MatchString(tag) {
+		return ""
+	}
+	return tag
+}
+
+// ParseAcceptLanguage returns the languages in an Accept-Language header,
+// most preferred first. Wildcards, invalid tags and q=0 entries are dropped.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+
+	var entries []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := NormalizeLocale(fields[0])
+		if locale == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		entries = append(entries, weighted{locale, q})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].q > entries[j].q })
+
+	locales := make([]string, len(entries))
+	for i, e := range entries {
+		locales[i] = e.locale
+	}
+	return locales
+}
+
+// LanguageFallbacks follows each preferred language with its primary
+// language, so ["es-mx", "en"] becomes ["es-mx", "es", "en"]. Duplicates
+// are removed.
+func LanguageFallbacks(langs []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	add := func(lang string) {
+		if !seen[lang] {
+			seen[lang] = true
+			out = append(out, lang)
+		}
+	}
+	for _, lang := range langs {
+		add(lang)
+		if i := strings.IndexByte(lang, '-'); i > 0 {
+			add(lang[:i])
+		}
+	}
+	return out
+}
+
+// PickTranslation returns the translation for the most preferred language
+// that has one. It returns false when nothing matches or a DefaultLanguage
+// variant without its own translation is preferred first, meaning the
+// untranslated text should be shown.
+func PickTranslation(translations map[string]Translation, langs []string) (Translation, bool) {
+	for _, lang := range LanguageFallbacks(langs) {
+		if t, ok := translations[lang]; ok {
+			return t, true
+		}
+		if lang == DefaultLanguage {
+			return Translation{}, false
+		}
+	}
+	return Translation{}, false
+}
@@ -6,6 +6,24 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// User roles. Customers place orders; staff run a store; drivers deliver
+// orders; admins can do anything.
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleDriver   = "driver"
+	RoleAdmin    = "admin"
+)
+
+// IsRole reports whether role is one of the user roles.
+func IsRole(role string) bool {
+	switch role {
+	case RoleCustomer, RoleStaff, RoleDriver, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
 	ID        int64     `json:"id"`
 	Email     string    `json:"email"`
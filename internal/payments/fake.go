@@ -0,0 +1,252 @@
+package payments
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// Payment method tokens FakeProvider understands. Any other token is
+// approved straight away.
+const (
+	FakeTokenDecline           = "tok_decline"
+	FakeTokenInsufficientFunds = "tok_insufficient_funds"
+	FakeTokenPending           = "tok_pending"
+	FakeTokenError             = "tok_error"
+)
+
+// FakeSignatureHeader carries the HMAC-SHA256 of a fake webhook body.
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// FakeProvider is an in-memory payment provider for local development and
+// tests. It declines or fails on the Fake* tokens, waits Latency before
+// answering each call, and leaves FakeTokenPending authorizations pending
+// until PendingDelay has passed, then approves them and sends a signed
+// webhook to WebhookURL. Without a Secret every webhook is rejected.
+type FakeProvider struct {
+	Secret       string
+	Latency      time.Duration
+	PendingDelay time.Duration
+	WebhookURL   string
+	Client       *http.Client
+
+	mu       sync.Mutex
+	seq      int
+	payments map[string]*fakePayment
+}
+
+type fakePayment struct {
+	status     string
+	authorized money.Money
+	captured   money.Money
+	refunded   money.Money
+}
+
+func NewFakeProvider(secret, webhookURL string) *FakeProvider {
+	return &FakeProvider{
+		Secret:       secret,
+		PendingDelay: 5 * time.Second,
+		WebhookURL:   webhookURL,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		payments:     make(map[string]*fakePayment),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Authorize(req AuthorizeRequest) (*Result, error) {
+	time.Sleep(p.Latency)
+	if req.Token == FakeTokenError {
+		return nil, errors.New("fake provider: connection refused")
+	}
+	if !req.Amount.IsPositive() {
+		return nil, errors.New("fake provider: amount must be positive")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.seq++
+	reference := fmt.Sprintf("fake_%d_%d", req.OrderID, p.seq)
+	payment := &fakePayment{status: models.PaymentAuthorized, authorized: req.Amount}
+	result := &Result{Reference: reference, Status: models.PaymentAuthorized}
+
+	switch req.Token {
+	case FakeTokenDecline:
+		payment.status = models.PaymentDeclined
+		result.Status, result.DeclineReason = models.PaymentDeclined, "card_declined"
+	case FakeTokenInsufficientFunds:
+		payment.status = models.PaymentDeclined
+		result.Status, result.DeclineReason = models.PaymentDeclined, "insufficient_funds"
+	case FakeTokenPending:
+		payment.status = models.PaymentPending
+		result.Status = models.PaymentPending
+		time.AfterFunc(p.PendingDelay, func() { p.completePending(reference) })
+	}
+
+	p.payments[reference] = payment
+	return result, nil
+}
+
+// completePending approves a pending authorization and reports it by
+// webhook.
+func (p *FakeProvider) completePending(reference string) {
+	p.mu.Lock()
+	payment := p.payments[reference]
+	if payment == nil || payment.status != models.PaymentPending {
+		p.mu.Unlock()
+		return
+	}
+	payment.status = models.PaymentAuthorized
+	p.seq++
+	event := Event{
+		ID:        fmt.Sprintf("evt_%d", p.seq),
+		Reference: reference,
+		Status:    models.PaymentAuthorized,
+		Amount:    payment.authorized,
+	}
+	p.mu.Unlock()
+
+	if p.WebhookURL == "" {
+		log.Printf("Fake payment %s authorized; no webhook URL configured", reference)
+		return
+	}
+	if err := p.sendWebhook(event); err != nil {
+		log.Printf("Failed to deliver fake payment webhook for %s: %v", reference, err)
+	}
+}
+
+func (p *FakeProvider) sendWebhook(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", p.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(FakeSignatureHeader, p.Sign(body))
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature FakeProvider puts on a webhook body.
+func (p *FakeProvider) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *FakeProvider) Capture(reference string, amount money.Money) (*Result, error) {
+	time.Sleep(p.Latency)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, err := p.find(reference, models.PaymentAuthorized)
+	if err != nil {
+		return nil, err
+	}
+	if !amount.IsPositive() || amount.Cmp(payment.authorized) > 0 {
+		return nil, fmt.Errorf("fake provider: cannot capture %s of %s authorized", amount, payment.authorized)
+	}
+
+	payment.status = models.PaymentCaptured
+	payment.captured = amount
+	return &Result{Reference: reference, Status: models.PaymentCaptured}, nil
+}
+
+func (p *FakeProvider) Void(reference string) (*Result, error) {
+	time.Sleep(p.Latency)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, err := p.find(reference, models.PaymentAuthorized)
+	if err != nil {
+		return nil, err
+	}
+
+	payment.status = models.PaymentVoided
+	return &Result{Reference: reference, Status: models.PaymentVoided}, nil
+}
+
+func (p *FakeProvider) Refund(reference string, amount money.Money) (*Result, error) {
+	time.Sleep(p.Latency)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, err := p.find(reference, models.PaymentCaptured)
+	if err != nil {
+		return nil, err
+	}
+	left := payment.captured.Sub(payment.refunded)
+	if !amount.IsPositive() || amount.Cmp(left) > 0 {
+		return nil, fmt.Errorf("fake provider: cannot refund %s, %s left", amount, left)
+	}
+
+	payment.refunded = payment.refunded.Add(amount)
+	status := models.PaymentCaptured
+	if payment.refunded.Cmp(payment.captured) == 0 {
+		payment.status = models.PaymentRefunded
+		status = models.PaymentRefunded
+	}
+	p.seq++
+	return &Result{Reference: fmt.Sprintf("%s_refund_%d", reference, p.seq), Status: status}, nil
+}
+
+// find returns a payment that is in status.
+func (p *FakeProvider) find(reference, status string) (*fakePayment, error) {
+	payment := p.payments[reference]
+	if payment == nil {
+		return nil, fmt.Errorf("fake provider: no payment %s", reference)
+	}
+	if payment.status != status {
+		return nil, fmt.Errorf("fake provider: payment %s is %s", reference, payment.status)
+	}
+	return payment, nil
+}
+
+func (p *FakeProvider) ParseWebhook(r *http.Request) (*Event, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	// Without a secret anyone could sign a delivery
+	if p.Secret == "" {
+		return nil, ErrInvalidSignature
+	}
+	expected := p.Sign(body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(FakeSignatureHeader))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
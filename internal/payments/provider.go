@@ -0,0 +1,71 @@
+// Package payments talks to payment providers. Provider hides the
+// differences between them; the rest of the API only deals with payment
+// records and the statuses in models.
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// ErrInvalidSignature is returned for webhook deliveries that did not come
+// from the provider.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// AuthorizeRequest asks a provider to hold Amount on the customer's payment
+// method. Token identifies the payment method, as collected by the client
+// from the provider.
+type AuthorizeRequest struct {
+	OrderID int64
+	Amount  money.Money
+	Token   string
+}
+
+// Result is a provider's answer to a request. Status is one of the
+// models.Payment* statuses; DeclineReason explains a decline.
+type Result struct {
+	Reference     string
+	Status        string
+	DeclineReason string
+}
+
+// Event is a webhook notification that a payment changed, typically an
+// authorization that was pending finishing.
+type Event struct {
+	ID            string      `json:"id"`
+	Reference     string      `json:"reference"`
+	Status        string      `json:"status"`
+	Amount        money.Money `json:"amount"`
+	DeclineReason string      `json:"decline_reason,omitempty"`
+}
+
+// Provider is a payment gateway. Errors mean the request could not be made;
+// a declined payment is a Result with status declined.
+type Provider interface {
+	Name() string
+	Authorize(req AuthorizeRequest) (*Result, error)
+	Capture(reference string, amount money.Money) (*Result, error)
+	Void(reference string) (*Result, error)
+	// Refund returns the reference of the refund itself.
+	Refund(reference string, amount money.Money) (*Result, error)
+	// ParseWebhook checks that a webhook delivery came from the provider and
+	// decodes it.
+	ParseWebhook(r *http.Request) (*Event, error)
+}
+
+// NewProvider returns the provider called name. The only one built in is
+// "fake", which is also used when name is empty. It takes no real money, so
+// it is refused in production.
+func NewProvider(name string, production bool, secret, webhookURL string) (Provider, error) {
+	switch name {
+	case "", "fake":
+		if production {
+			return nil, errors.New("payments: the fake provider cannot be used in production")
+		}
+		return NewFakeProvider(secret, webhookURL), nil
+	}
+	return nil, fmt.Errorf("payments: unknown provider %q", name)
+}
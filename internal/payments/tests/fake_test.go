@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/models"
+	"zesty-sips-api/internal/payments"
+	"zesty-sips-api/pkg/money"
+)
+
+func authorize(t *testing.T, p *payments.FakeProvider, token string, minor int64) *payments.Result {
+	result, err := p.Authorize(payments.AuthorizeRequest{OrderID: 1, Amount: money.New(minor, "USD"), Token: token})
+	assert.NoError(t, err)
+	return result
+}
+
+func TestFakeProviderDeclines(t *testing.T) {
+	p := payments.NewFakeProvider("secret", "")
+
+	result := authorize(t, p, payments.FakeTokenDecline, 500)
+	assert.Equal(t, models.PaymentDeclined, result.Status)
+	assert.Equal(t, "card_declined", result.DeclineReason)
+
+	result = authorize(t, p, payments.FakeTokenInsufficientFunds, 500)
+	assert.Equal(t, "insufficient_funds", result.DeclineReason)
+
+	_, err := p.Capture(result.Reference, money.New(500, "USD"))
+	assert.Error(t, err)
+
+	_, err = p.Authorize(payments.AuthorizeRequest{OrderID: 1, Amount: money.New(500, "USD"), Token: payments.FakeTokenError})
+	assert.Error(t, err)
+}
+
+func TestFakeProviderCaptureAndRefundLimits(t *testing.T) {
+	p := payments.NewFakeProvider("secret", "")
+	result := authorize(t, p, "tok_visa", 1000)
+	assert.Equal(t, models.PaymentAuthorized, result.Status)
+
+	_, err := p.Capture(result.Reference, money.New(1001, "USD"))
+	assert.Error(t, err)
+
+	captured, err := p.Capture(result.Reference, money.New(800, "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentCaptured, captured.Status)
+
+	_, err = p.Void(result.Reference)
+	assert.Error(t, err)
+
+	refund, err := p.Refund(result.Reference, money.New(300, "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentCaptured, refund.Status)
+	assert.NotEqual(t, result.Reference, refund.Reference)
+
+	_, err = p.Refund(result.Reference, money.New(501, "USD"))
+	assert.Error(t, err)
+
+	refund, err = p.Refund(result.Reference, money.New(500, "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentRefunded, refund.Status)
+}
+
+func TestFakeProviderWebhookSignature(t *testing.T) {
+	p := payments.NewFakeProvider("secret", "")
+	body, _ := json.Marshal(payments.Event{ID: "evt_1", Reference: "fake_1_1", Status: models.PaymentAuthorized})
+
+	req := httptest.NewRequest("POST", "/payments/webhooks/fake", bytes.NewReader(body))
+	req.Header.Set(payments.FakeSignatureHeader, p.Sign(body))
+	event, err := p.ParseWebhook(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "evt_1", event.ID)
+	assert.Equal(t, models.PaymentAuthorized, event.Status)
+
+	req = httptest.NewRequest("POST", "/payments/webhooks/fake", bytes.NewReader(body))
+	req.Header.Set(payments.FakeSignatureHeader, payments.NewFakeProvider("other", "").Sign(body))
+	_, err = p.ParseWebhook(req)
+	assert.ErrorIs(t, err, payments.ErrInvalidSignature)
+}
+
+func TestFakeProviderWebhookWithoutSecret(t *testing.T) {
+	p := payments.NewFakeProvider("", "")
+	body, _ := json.Marshal(payments.Event{ID: "evt_1", Reference: "fake_1_1", Status: models.PaymentAuthorized})
+
+	// An empty secret would otherwise let anyone compute the signature
+	req := httptest.NewRequest("POST", "/payments/webhooks/fake", bytes.NewReader(body))
+	req.Header.Set(payments.FakeSignatureHeader, p.Sign(body))
+	_, err := p.ParseWebhook(req)
+	assert.ErrorIs(t, err, payments.ErrInvalidSignature)
+}
+
+func TestNewProvider(t *testing.T) {
+	provider, err := payments.NewProvider("", false, "secret", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "fake", provider.Name())
+
+	// The fake gateway takes no real money
+	_, err = payments.NewProvider("fake", true, "secret", "")
+	assert.Error(t, err)
+
+	_, err = payments.NewProvider("stripe", false, "secret", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package receipts
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+var htmlTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"date":       func(t time.Time) string { return t.Format(dateLayout) },
+	"capitalize": capitalize,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Receipt for order #{{.OrderID}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; max-width: 28em; margin: 2em auto; color: #222; }
+h1 { font-size: 1.3em; margin-bottom: 0; text-align: center; }
+.address { color: #666; text-align: center; margin-top: 0.2em; }
+table { width: 100%; border-collapse: collapse; margin: 1em 0; }
+td { padding: 0.2em 0; vertical-align: top; }
+td.amount { text-align: right; white-space: nowrap; }
+tr.extra td { color: #666; padding-left: 1.5em; font-size: 0.9em; }
+tr.strong td { font-weight: bold; border-top: 1px solid #ccc; }
+.footer { color: #666; font-size: 0.9em; text-align: center; }
+</style>
+</head>
+<body>
+<h1>{{.StoreName}}</h1>
+{{if .StoreAddress}}<p class="address">{{.StoreAddress}}</p>{{end}}
+<p>
+Order #{{.OrderID}}<br>
+Placed {{date .PlacedAt}}<br>
+{{if .ScheduledFor}}Ready for {{date .ScheduledFor}}<br>{{end}}
+{{capitalize .OrderType}}
+</p>
+<table class="items">
+{{range .Items}}<tr><td>{{.Quantity}} &times; {{.Name}}</td><td class="amount">{{.Total}}</td></tr>
+{{range .Extras}}<tr class="extra"><td>{{if .Price.IsZero}}{{.Name}}{{else}}+ {{.Name}}{{end}}</td><td class="amount">{{if not .Price.IsZero}}{{.Price}}{{end}}</td></tr>
+{{end}}{{end}}</table>
+<table class="totals">
+{{range .Amounts}}<tr{{if .Strong}} class="strong"{{end}}><td>{{.Label}}</td><td class="amount">{{.Amount}}</td></tr>
+{{end}}</table>
+<p class="footer">
+{{if .LoyaltyPoints}}Loyalty points earned: {{.LoyaltyPoints}}<br>{{end}}
+{{if .Currency}}Amounts in {{.Currency}}<br>{{end}}
+Thank you!
+</p>
+</body>
+</html>
+`))
+
+// RenderHTML writes the receipt as an HTML page, suitable for the body of
+// an email.
+func RenderHTML(w io.Writer, r *Receipt) error {
+	return htmlTemplate.Execute(w, r)
+}
@@ -0,0 +1,100 @@
+package receipts
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The PDF is the plain text receipt set in Courier on pages the width of a
+// till roll, so it needs no fonts embedded and no layout of its own.
+const (
+	pdfFontSize  = 10
+	pdfLeading   = 12
+	pdfMargin    = 24
+	pdfCharWidth = 6 // Courier glyphs are 0.6em wide
+	pdfPageWidth = textWidth*pdfCharWidth + 2*pdfMargin
+	pdfMaxLines  = 200
+)
+
+// RenderPDF writes the receipt as a PDF document. Pages are as long as the
+// receipt, up to pdfMaxLines lines each.
+func RenderPDF(w io.Writer, r *Receipt) error {
+	_, err := w.Write(buildPDF(textLines(r)))
+	return err
+}
+
+// buildPDF sets lines of text on as many pages as they need. Objects 1 to
+// 3 are the catalog, the page tree and the font; each page then takes two
+// more, the page and its content stream.
+func buildPDF(lines []string) []byte {
+	var pages [][]string
+	for len(lines) > pdfMaxLines {
+		pages = append(pages, lines[:pdfMaxLines])
+		lines = lines[pdfMaxLines:]
+	}
+	pages = append(pages, lines)
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		height := len(page)*pdfLeading + 2*pdfMargin
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, height, 5+2*i))
+
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, height-pdfMargin-pdfFontSize)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfText(line))
+		}
+		content.WriteString("ET")
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+// pdfText encodes s for a PDF string in WinAnsiEncoding. Characters the
+// encoding lacks are printed as "?".
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= ' ' && r < 0x7f:
+			b.WriteRune(r)
+		case r == '€':
+			b.WriteByte(0x80)
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
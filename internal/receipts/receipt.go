@@ -0,0 +1,117 @@
+// Package receipts renders order receipts as HTML, plain text and PDF.
+// Receipt holds everything printed on one, already worked out; the services
+// build it from an order and the renderers only lay it out.
+package receipts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// Receipt is what is printed on an order's receipt. PlacedAt and
+// ScheduledFor are in the store's timezone.
+type Receipt struct {
+	OrderID       int64
+	StoreName     string
+	StoreAddress  string
+	PlacedAt      time.Time
+	ScheduledFor  *time.Time
+	OrderType     string
+	Status        string
+	Currency      string
+	Items         []Item
+	Subtotal      money.Money
+	Discount      money.Money
+	PromotionCode string
+	DeliveryFee   money.Money
+	TaxLines      []TaxLine
+	TaxAmount     money.Money
+	TaxIncluded   bool
+	Total         money.Money
+	Tip           money.Money
+	Refunded      money.Money
+	LoyaltyPoints int
+}
+
+// Item is one order line. Quantity leaves out anything cancelled, and Total
+// is Quantity times UnitPrice, which already includes the extras.
+type Item struct {
+	Name      string
+	Quantity  int
+	UnitPrice money.Money
+	Total     money.Money
+	Extras    []Extra
+}
+
+// Extra is a modifier or bundle choice on an item, with what it added to
+// the unit price.
+type Extra struct {
+	Name  string
+	Price money.Money
+}
+
+// TaxLine is the tax charged at one rate.
+type TaxLine struct {
+	Name   string
+	Rate   float64
+	Amount money.Money
+}
+
+// Amount is a labelled line in a receipt's totals.
+type Amount struct {
+	Label  string
+	Amount money.Money
+	Strong bool
+}
+
+// Paid is what the customer was charged: the total and the tip.
+func (r *Receipt) Paid() money.Money {
+	return r.Total.Add(r.Tip)
+}
+
+// Amounts returns the totals section of the receipt in order, leaving out
+// lines that do not apply to the order. All three formats print these, so
+// they always agree.
+func (r *Receipt) Amounts() []Amount {
+	amounts := []Amount{{Label: "Subtotal", Amount: r.Subtotal}}
+	if r.Discount.IsPositive() {
+		label := "Discount"
+		if r.PromotionCode != "" {
+			label = fmt.Sprintf("Discount (%s)", r.PromotionCode)
+		}
+		amounts = append(amounts, Amount{Label: label, Amount: r.Discount.Neg()})
+	}
+	if r.DeliveryFee.IsPositive() {
+		amounts = append(amounts, Amount{Label: "Delivery fee", Amount: r.DeliveryFee})
+	}
+	for _, t := range r.TaxLines {
+		label := fmt.Sprintf("%s %s%%", t.Name, formatRate(t.Rate))
+		if r.TaxIncluded {
+			label += " (included)"
+		}
+		amounts = append(amounts, Amount{Label: label, Amount: t.Amount})
+	}
+	if len(r.TaxLines) == 0 && r.TaxAmount.IsPositive() {
+		amounts = append(amounts, Amount{Label: "Tax", Amount: r.TaxAmount})
+	}
+	amounts = append(amounts, Amount{Label: "Total", Amount: r.Total, Strong: true})
+	if r.Tip.IsPositive() {
+		amounts = append(amounts,
+			Amount{Label: "Tip", Amount: r.Tip},
+			Amount{Label: "Amount paid", Amount: r.Paid(), Strong: true},
+		)
+	}
+	if r.Refunded.IsPositive() {
+		amounts = append(amounts, Amount{Label: "Refunded", Amount: r.Refunded.Neg()})
+	}
+	return amounts
+}
+
+// formatRate prints a tax rate without trailing zeros, e.g. "8.875" or "20".
+func formatRate(rate float64) string {
+	return fmt.Sprintf("%g", rate)
+}
+
+const dateLayout = "2 Jan 2006 15:04"
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/receipts"
+	"zesty-sips-api/pkg/money"
+)
+
+func usd(minor int64) money.Money {
+	return money.New(minor, "USD")
+}
+
+func sampleReceipt() *receipts.Receipt {
+	return &receipts.Receipt{
+		OrderID:      42,
+		StoreName:    "Zesty Sips Downtown",
+		StoreAddress: "1 Main St",
+		PlacedAt:     time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC),
+		OrderType:    "delivery",
+		Currency:     "USD",
+		Items: []receipts.Item{
+			{
+				Name: "Mango (Large) Smoothie", Quantity: 2, UnitPrice: usd(650), Total: usd(1300),
+				Extras: []receipts.Extra{{Name: "Protein boost", Price: usd(100)}, {Name: "Base: Oat <milk>"}},
+			},
+		},
+		Subtotal:      usd(1300),
+		Discount:      usd(130),
+		PromotionCode: "SPRING10",
+		DeliveryFee:   usd(299),
+		TaxLines:      []receipts.TaxLine{{Name: "Sales tax", Rate: 8.875, Amount: usd(104)}},
+		TaxAmount:     usd(104),
+		Total:         usd(1573),
+		Tip:           usd(200),
+		LoyaltyPoints: 15,
+	}
+}
+
+func TestAmounts(t *testing.T) {
+	var labels []string
+	for _, a := range sampleReceipt().Amounts() {
+		labels = append(labels, a.Label+" "+a.Amount.String())
+	}
+	assert.Equal(t, []string{
+		"Subtotal 13.00",
+		"Discount (SPRING10) -1.30",
+		"Delivery fee 2.99",
+		"Sales tax 8.875% 1.04",
+		"Total 15.73",
+		"Tip 2.00",
+		"Amount paid 17.73",
+	}, labels)
+}
+
+func TestAmountsLeaveOutWhatDoesNotApply(t *testing.T) {
+	r := &receipts.Receipt{Subtotal: usd(500), Total: usd(500)}
+	amounts := r.Amounts()
+	assert.Len(t, amounts, 2)
+	assert.Equal(t, "Total", amounts[1].Label)
+}
+
+func TestRenderText(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, receipts.RenderText(&buf, sampleReceipt()))
+	text := buf.String()
+
+	assert.Contains(t, text, "Order #42\n")
+	assert.Contains(t, text, "Placed 5 Mar 2024 09:30\n")
+	assert.Contains(t, text, "Delivery\n")
+	assert.Contains(t, text, "2 x Mango (Large) Smoothie         13.00\n")
+	assert.Contains(t, text, "    + Protein boost                 1.00\n")
+	assert.Contains(t, text, "AMOUNT PAID                        17.73\n")
+	assert.Contains(t, text, "Loyalty points earned: 15\n")
+	for _, line := range strings.Split(text, "\n") {
+		assert.LessOrEqual(t, len([]rune(line)), 40, line)
+	}
+}
+
+func TestRenderTextTruncatesLongNames(t *testing.T) {
+	r := sampleReceipt()
+	r.Items[0].Name = strings.Repeat("Very long product name ", 3)
+
+	var buf bytes.Buffer
+	assert.NoError(t, receipts.RenderText(&buf, r))
+	assert.Contains(t, buf.String(), "2 x Very long product name Very... 13.00\n")
+}
+
+func TestRenderHTMLEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, receipts.RenderHTML(&buf, sampleReceipt()))
+	html := buf.String()
+
+	assert.Contains(t, html, "Base: Oat &lt;milk&gt;")
+	assert.Contains(t, html, "<td>Amount paid</td><td class=\"amount\">17.73</td>")
+	assert.Contains(t, html, "Loyalty points earned: 15")
+}
+
+func TestRenderPDF(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, receipts.RenderPDF(&buf, sampleReceipt()))
+	pdf := buf.String()
+
+	assert.True(t, strings.HasPrefix(pdf, "%PDF-1.4\n"))
+	assert.True(t, strings.HasSuffix(pdf, "%%EOF\n"))
+	assert.Contains(t, pdf, "(2 x Mango \\(Large\\) Smoothie")
+	assert.Contains(t, pdf, "/Count 1")
+
+	// The cross-reference table must point at each object
+	xref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(pdf)
+	if assert.Len(t, xref, 2) {
+		start, _ := strconv.Atoi(xref[1])
+		assert.True(t, strings.HasPrefix(pdf[start:], "xref\n"))
+		offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(pdf[start:], -1)
+		assert.Len(t, offsets, 5)
+		for i, o := range offsets {
+			offset, _ := strconv.Atoi(o[1])
+			assert.True(t, strings.HasPrefix(pdf[offset:], strconv.Itoa(i+1)+" 0 obj\n"))
+		}
+	}
+}
+
+func TestRenderPDFSplitsLongReceipts(t *testing.T) {
+	r := sampleReceipt()
+	for i := 0; i < 250; i++ {
+		r.Items = append(r.Items, receipts.Item{Name: "Water", Quantity: 1, UnitPrice: usd(100), Total: usd(100)})
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, receipts.RenderPDF(&buf, r))
+	assert.Contains(t, buf.String(), "/Count 2")
+}
@@ -0,0 +1,106 @@
+package receipts
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// textWidth is how many characters wide a plain text receipt is, the
+// width of a till roll.
+const textWidth = 40
+
+// RenderText writes the receipt as plain text.
+func RenderText(w io.Writer, r *Receipt) error {
+	for _, line := range textLines(r) {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// textLines lays the receipt out as fixed-width lines, for the plain text
+// and PDF formats.
+func textLines(r *Receipt) []string {
+	rule := strings.Repeat("-", textWidth)
+
+	lines := []string{center(r.StoreName)}
+	if r.StoreAddress != "" {
+		lines = append(lines, center(r.StoreAddress))
+	}
+	lines = append(lines, rule,
+		fmt.Sprintf("Order #%d", r.OrderID),
+		"Placed "+r.PlacedAt.Format(dateLayout),
+	)
+	if r.ScheduledFor != nil {
+		lines = append(lines, "Ready for "+r.ScheduledFor.Format(dateLayout))
+	}
+	lines = append(lines, capitalize(r.OrderType), rule)
+
+	for _, item := range r.Items {
+		lines = append(lines, spread(fmt.Sprintf("%d x %s", item.Quantity, item.Name), item.Total.String()))
+		for _, extra := range item.Extras {
+			if extra.Price.IsZero() {
+				lines = append(lines, truncate("    "+extra.Name, textWidth))
+			} else {
+				lines = append(lines, spread("    + "+extra.Name, extra.Price.String()))
+			}
+		}
+	}
+	lines = append(lines, rule)
+
+	for _, a := range r.Amounts() {
+		label := a.Label
+		if a.Strong {
+			label = strings.ToUpper(label)
+		}
+		lines = append(lines, spread(label, a.Amount.String()))
+	}
+	lines = append(lines, rule)
+
+	if r.LoyaltyPoints > 0 {
+		lines = append(lines, fmt.Sprintf("Loyalty points earned: %d", r.LoyaltyPoints))
+	}
+	if r.Currency != "" {
+		lines = append(lines, "Amounts in "+r.Currency)
+	}
+	return append(lines, "", center("Thank you!"))
+}
+
+// spread puts left and right at either end of a line, cutting left short
+// if both do not fit.
+func spread(left, right string) string {
+	room := textWidth - utf8.RuneCountInString(right) - 1
+	left = truncate(left, room)
+	gap := textWidth - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+	return left + strings.Repeat(" ", gap) + right
+}
+
+func center(s string) string {
+	s = truncate(s, textWidth)
+	return strings.Repeat(" ", (textWidth-utf8.RuneCountInString(s))/2) + s
+}
+
+// capitalize upper-cases the first letter of s, e.g. "delivery" to
+// "Delivery".
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	return strings.ToUpper(string(r)) + s[n:]
+}
+
+// truncate cuts s down to n characters, marking the cut with "...".
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	if n <= 3 {
+		return string(runes[:n])
+	}
+	return string(runes[:n-3]) + "..."
+}
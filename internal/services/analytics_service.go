@@ -2,7 +2,10 @@ package services
 
 import (
 	"database/sql"
+	"sort"
 	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
 )
 
 type AnalyticsService struct {
@@ -14,37 +17,175 @@ func NewAnalyticsService(db *sql.DB) *AnalyticsService {
 }
 
 type SalesReport struct {
-	TotalSales        float64 `json:"total_sales"`
-	OrderCount        int     `json:"order_count"`
-	AverageOrderValue float64 `json:"average_order_value"`
+	TotalSales        money.Money `json:"total_sales"`
+	TotalTax          money.Money `json:"total_tax"`
+	OrderCount        int         `json:"order_count"`
+	AverageOrderValue money.Money `json:"average_order_value"`
 }
 
 func (s *AnalyticsService) GetSalesReport(startDate, endDate time.Time) (*SalesReport, error) {
 	query := `
 		SELECT 
 			COALESCE(SUM(total_amount), 0) as total_sales,
+			COALESCE(SUM(tax_amount), 0) as total_tax,
 			COUNT(*) as order_count
 		FROM orders
 		WHERE created_at BETWEEN $1 AND $2
 	`
 	var report SalesReport
-	err := s.DB.QueryRow(query, startDate, endDate).Scan(&report.TotalSales, &report.OrderCount)
+	err := s.DB.QueryRow(query, startDate, endDate).Scan(&report.TotalSales, &report.TotalTax, &report.OrderCount)
 	if err != nil {
 		return nil, err
 	}
 
 	if report.OrderCount > 0 {
-		report.AverageOrderValue = report.TotalSales / float64(report.OrderCount)
+		report.AverageOrderValue = report.TotalSales.Div(int64(report.OrderCount), money.RoundHalfUp)
 	}
 
 	return &report, nil
 }
 
+// TaxReportLine is the tax charged at one rate on one tax category.
+type TaxReportLine struct {
+	Jurisdiction  string      `json:"jurisdiction,omitempty"`
+	Name          string      `json:"name"`
+	TaxCategory   string      `json:"tax_category"`
+	Rate          float64     `json:"rate"`
+	TaxableAmount money.Money `json:"taxable_amount"`
+	TaxAmount     money.Money `json:"tax_amount"`
+	OrderCount    int         `json:"order_count"`
+}
+
+// GetTaxReport breaks down the tax charged on orders placed between
+// startDate and endDate by jurisdiction, rate and tax category, for one
+// store or all of them when storeID is zero. Cancelled and refunded orders
+// are left out since their tax was given back.
+func (s *AnalyticsService) GetTaxReport(startDate, endDate time.Time, storeID int64) ([]TaxReportLine, error) {
+	query := `
+		SELECT
+			COALESCE(t.jurisdiction, ''),
+			t.name,
+			t.tax_category,
+			t.rate,
+			SUM(t.taxable_amount) as taxable_amount,
+			SUM(t.tax_amount) as tax_amount,
+			COUNT(DISTINCT t.order_id) as order_count
+		FROM order_tax_lines t
+		JOIN orders o ON o.id = t.order_id
+		WHERE o.created_at BETWEEN $1 AND $2
+			AND ($3 = 0 OR o.store_id = $3)
+			AND o.status NOT IN ('cancelled', 'refunded')
+		GROUP BY t.jurisdiction, t.name, t.tax_category, t.rate
+		ORDER BY t.jurisdiction NULLS LAST, t.name, t.tax_category, t.rate
+	`
+	rows, err := s.DB.Query(query, startDate, endDate, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []TaxReportLine{}
+	for rows.Next() {
+		var l TaxReportLine
+		err := rows.Scan(&l.Jurisdiction, &l.Name, &l.TaxCategory, &l.Rate, &l.TaxableAmount, &l.TaxAmount, &l.OrderCount)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+
+	return lines, rows.Err()
+}
+
+// TipReportLine is the tips a store took on one day.
+type TipReportLine struct {
+	StoreID      int64       `json:"store_id"`
+	StoreName    string      `json:"store_name"`
+	Date         string      `json:"date"`
+	TipAmount    money.Money `json:"tip_amount"`
+	TippedOrders int         `json:"tipped_orders"`
+	OrderCount   int         `json:"order_count"`
+}
+
+// GetTipReport totals the tips on orders placed between startDate and
+// endDate per store and day, the day being taken in the store's timezone,
+// for one store or all of them when storeID is zero. Cancelled and refunded
+// orders are left out since their tip was given back. Orders are grouped
+// here rather than in SQL because created_at is stored as UTC without a
+// timezone, and the day an order falls on depends on the store's.
+func (s *AnalyticsService) GetTipReport(startDate, endDate time.Time, storeID int64) ([]TipReportLine, error) {
+	query := `
+		SELECT s.id, s.name, s.timezone, o.created_at, o.tip_amount
+		FROM orders o
+		JOIN stores s ON s.id = o.store_id
+		WHERE o.created_at BETWEEN $1 AND $2
+			AND ($3 = 0 OR o.store_id = $3)
+			AND o.status NOT IN ('cancelled', 'refunded')
+	`
+	rows, err := s.DB.Query(query, startDate, endDate, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type storeDay struct {
+		storeID int64
+		date    string
+	}
+	locations := make(map[string]*time.Location)
+	byDay := make(map[storeDay]int)
+	lines := []TipReportLine{}
+	for rows.Next() {
+		var id int64
+		var name, timezone string
+		var createdAt time.Time
+		var tip money.Money
+		if err := rows.Scan(&id, &name, &timezone, &createdAt, &tip); err != nil {
+			return nil, err
+		}
+
+		loc, ok := locations[timezone]
+		if !ok {
+			if loc, err = time.LoadLocation(timezone); err != nil {
+				loc = time.UTC
+			}
+			locations[timezone] = loc
+		}
+		utc := time.Date(createdAt.Year(), createdAt.Month(), createdAt.Day(), createdAt.Hour(),
+			createdAt.Minute(), createdAt.Second(), createdAt.Nanosecond(), time.UTC)
+		key := storeDay{id, utc.In(loc).Format("2006-01-02")}
+
+		i, ok := byDay[key]
+		if !ok {
+			i = len(lines)
+			byDay[key] = i
+			lines = append(lines, TipReportLine{StoreID: id, StoreName: name, Date: key.date})
+		}
+		line := &lines[i]
+		line.TipAmount = line.TipAmount.Add(tip)
+		if tip.IsPositive() {
+			line.TippedOrders++
+		}
+		line.OrderCount++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Date != lines[j].Date {
+			return lines[i].Date < lines[j].Date
+		}
+		return lines[i].StoreName < lines[j].StoreName
+	})
+	return lines, nil
+}
+
 type TopProduct struct {
-	ProductID   int64   `json:"product_id"`
-	ProductName string  `json:"product_name"`
-	TotalSales  float64 `json:"total_sales"`
-	Quantity    int     `json:"quantity"`
+	ProductID   int64       `json:"product_id"`
+	ProductName string      `json:"product_name"`
+	TotalSales  money.Money `json:"total_sales"`
+	Quantity    int         `json:"quantity"`
 }
 
 func (s *AnalyticsService) GetTopProducts(limit int) ([]TopProduct, error) {
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/lib/pq"
+)
+
+const availabilityColumns = `
+	id, product_id, COALESCE(to_char(start_date, 'YYYY-MM-DD'), ''), COALESCE(to_char(end_date, 'YYYY-MM-DD'), ''),
+	days_of_week, COALESCE(start_time, ''), COALESCE(end_time, '')
+`
+
+func scanAvailabilityWindows(rows *sql.Rows) ([]models.AvailabilityWindow, error) {
+	defer rows.Close()
+
+	var windows []models.AvailabilityWindow
+	for rows.Next() {
+		var w models.AvailabilityWindow
+		var days pq.Int64Array
+		err := rows.Scan(&w.ID, &w.ProductID, &w.StartDate, &w.EndDate, &days, &w.StartTime, &w.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range days {
+			w.DaysOfWeek = append(w.DaysOfWeek, int(d))
+		}
+		windows = append(windows, w)
+	}
+
+	return windows, rows.Err()
+}
+
+// loadAvailabilityWindows returns every product's availability windows keyed
+// by product ID. Products without windows are absent from the map.
+func loadAvailabilityWindows(db *sql.DB) (map[int64][]models.AvailabilityWindow, error) {
+	rows, err := db.Query(`SELECT ` + availabilityColumns + ` FROM product_availability ORDER BY product_id, id`)
+	if err != nil {
+		return nil, err
+	}
+
+	windows, err := scanAvailabilityWindows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	byProduct := make(map[int64][]models.AvailabilityWindow)
+	for _, w := range windows {
+		byProduct[w.ProductID] = append(byProduct[w.ProductID], w)
+	}
+	return byProduct, nil
+}
+
+// validateAvailabilityWindow checks a window and rewrites its times in the
+// canonical HH:MM form, so that "9:00" is stored as "09:00".
+func validateAvailabilityWindow(w *models.AvailabilityWindow) error {
+	for _, date := range []string{w.StartDate, w.EndDate} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+	}
+	if w.StartDate != "" && w.EndDate != "" && w.EndDate < w.StartDate {
+		return errors.New("end_date must not be before start_date")
+	}
+	for _, clock := range []*string{&w.StartTime, &w.EndTime} {
+		if *clock == "" {
+			continue
+		}
+		t, err := time.Parse("15:04", *clock)
+		if err != nil {
+			return fmt.Errorf("invalid time %q, expected HH:MM", *clock)
+		}
+		*clock = t.Format("15:04")
+	}
+	for _, d := range w.DaysOfWeek {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("invalid day of week %d", d)
+		}
+	}
+	return nil
+}
+
+func (s *ProductService) GetAvailability(productID int64) ([]models.AvailabilityWindow, error) {
+	rows, err := s.DB.Query(`SELECT `+availabilityColumns+` FROM product_availability WHERE product_id = $1 ORDER BY id`, productID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAvailabilityWindows(rows)
+}
+
+// SetAvailability replaces a product's availability windows. An empty list
+// makes the product always available.
+func (s *ProductService) SetAvailability(productID int64, windows []models.AvailabilityWindow) error {
+	for i := range windows {
+		if err := validateAvailabilityWindow(&windows[i]); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM product_availability WHERE product_id = $1`, productID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO product_availability (product_id, start_date, end_date, days_of_week, start_time, end_time)
+		VALUES ($1, NULLIF($2, '')::DATE, NULLIF($3, '')::DATE, $4, NULLIF($5, ''), NULLIF($6, ''))
+		RETURNING id
+	`
+	for i := range windows {
+		days := make(pq.Int64Array, len(windows[i].DaysOfWeek))
+		for j, d := range windows[i].DaysOfWeek {
+			days[j] = int64(d)
+		}
+		err := tx.QueryRow(query, productID, windows[i].StartDate, windows[i].EndDate, days,
+			windows[i].StartTime, windows[i].EndTime).Scan(&windows[i].ID)
+		if err != nil {
+			return err
+		}
+		windows[i].ProductID = productID
+	}
+
+	return tx.Commit()
+}
+
+// IsAvailable reports whether a product can be sold at a store at the given
+// instant, evaluated in the store's timezone.
+func (s *ProductService) IsAvailable(storeID, productID int64, at time.Time) (bool, error) {
+	loc, err := storeLocation(s.DB, storeID)
+	if err != nil {
+		return false, err
+	}
+
+	windows, err := s.GetAvailability(productID)
+	if err != nil {
+		return false, err
+	}
+
+	return models.IsAvailableAt(windows, at.In(loc)), nil
+}
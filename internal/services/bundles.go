@@ -0,0 +1,199 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+// GetBundle returns a bundle's slots in order with their options. A product
+// that is not a bundle has no slots.
+func (s *ProductService) GetBundle(productID int64) ([]models.BundleSlot, error) {
+	query := `
+		SELECT bs.id, bs.name, bs.quantity, o.product_id, p.name, o.price_adjustment
+		FROM bundle_slots bs
+		JOIN bundle_slot_options o ON o.slot_id = bs.id
+		JOIN products p ON p.id = o.product_id
+		WHERE bs.bundle_id = $1
+		ORDER BY bs.position, bs.id, o.price_adjustment, p.name
+	`
+	rows, err := s.DB.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var slots []models.BundleSlot
+	for rows.Next() {
+		var slotID int64
+		var name string
+		var quantity int
+		var option models.BundleOption
+		err := rows.Scan(&slotID, &name, &quantity, &option.ProductID, &option.ProductName, &option.PriceAdjustment)
+		if err != nil {
+			return nil, err
+		}
+		if len(slots) == 0 || slots[len(slots)-1].ID != slotID {
+			slots = append(slots, models.BundleSlot{ID: slotID, BundleID: productID, Name: name, Quantity: quantity})
+		}
+		slot := &slots[len(slots)-1]
+		slot.Options = append(slot.Options, option)
+	}
+
+	return slots, rows.Err()
+}
+
+// SetBundle replaces a product's bundle slots. A non-empty list turns the
+// product into a bundle and an empty list turns it back into a plain
+// product. Bundles cannot contain other bundles.
+func (s *ProductService) SetBundle(productID int64, slots []models.BundleSlot) error {
+	for i := range slots {
+		slot := &slots[i]
+		if strings.TrimSpace(slot.Name) == "" {
+			return errors.New("every slot needs a name")
+		}
+		if slot.Quantity == 0 {
+			slot.Quantity = 1
+		}
+		if slot.Quantity < 0 {
+			return fmt.Errorf("slot %q: quantity must be positive", slot.Name)
+		}
+		if len(slot.Options) == 0 {
+			return fmt.Errorf("slot %q: at least one option is required", slot.Name)
+		}
+		seen := make(map[int64]bool)
+		for _, option := range slot.Options {
+			if option.ProductID == productID {
+				return errors.New("a bundle cannot contain itself")
+			}
+			if seen[option.ProductID] {
+				return fmt.Errorf("slot %q: product %d is listed twice", slot.Name, option.ProductID)
+			}
+			seen[option.ProductID] = true
+		}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var isBundle bool
+	err = tx.QueryRow(`SELECT is_bundle FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&isBundle)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("product")
+		}
+		return err
+	}
+
+	// A product used inside a bundle cannot become one itself
+	if len(slots) > 0 {
+		var usedInBundle bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM bundle_slot_options WHERE product_id = $1)`, productID).
+			Scan(&usedInBundle)
+		if err != nil {
+			return err
+		}
+		if usedInBundle {
+			return errors.New("product is a component of another bundle")
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM bundle_slots WHERE bundle_id = $1`, productID); err != nil {
+		return err
+	}
+
+	for i := range slots {
+		slot := &slots[i]
+		slot.BundleID = productID
+		query := `INSERT INTO bundle_slots (bundle_id, name, quantity, position) VALUES ($1, $2, $3, $4) RETURNING id`
+		if err := tx.QueryRow(query, productID, slot.Name, slot.Quantity, i).Scan(&slot.ID); err != nil {
+			return err
+		}
+
+		for j := range slot.Options {
+			option := &slot.Options[j]
+			var componentIsBundle bool
+			err := tx.QueryRow(`SELECT name, is_bundle FROM products WHERE id = $1`, option.ProductID).
+				Scan(&option.ProductName, &componentIsBundle)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					return fmt.Errorf("product %d not found", option.ProductID)
+				}
+				return err
+			}
+			if componentIsBundle {
+				return fmt.Errorf("product %d is a bundle and cannot be a component", option.ProductID)
+			}
+
+			query := `INSERT INTO bundle_slot_options (slot_id, product_id, price_adjustment) VALUES ($1, $2, $3)`
+			if _, err := tx.Exec(query, slot.ID, option.ProductID, option.PriceAdjustment); err != nil {
+				return err
+			}
+		}
+	}
+
+	query := `UPDATE products SET is_bundle = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	if _, err := tx.Exec(query, len(slots) > 0, productID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// BundleComponents resolves the products an order item for a bundle is made
+// of, using the item's selections for choice slots. It returns nil for
+// products that are not bundles.
+func (s *ProductService) BundleComponents(item models.OrderItem) ([]models.OrderItemComponent, error) {
+	slots, err := s.GetBundle(item.ProductID)
+	if err != nil || len(slots) == 0 {
+		return nil, err
+	}
+
+	used := make(map[int64]bool)
+	components := make([]models.OrderItemComponent, 0, len(slots))
+	for _, slot := range slots {
+		var chosen *models.BundleOption
+		productID, selected := item.Selections[slot.ID]
+		switch {
+		case selected:
+			for i := range slot.Options {
+				if slot.Options[i].ProductID == productID {
+					chosen = &slot.Options[i]
+					break
+				}
+			}
+			if chosen == nil {
+				return nil, invalidf("product %d is not an option for %q", productID, slot.Name)
+			}
+		case len(slot.Options) == 1:
+			chosen = &slot.Options[0]
+		default:
+			return nil, invalidf("a choice is required for %q in product %d", slot.Name, item.ProductID)
+		}
+		used[slot.ID] = true
+
+		slotID := slot.ID
+		components = append(components, models.OrderItemComponent{
+			SlotID:          &slotID,
+			SlotName:        slot.Name,
+			ProductID:       chosen.ProductID,
+			ProductName:     chosen.ProductName,
+			Quantity:        slot.Quantity * item.Quantity,
+			PriceAdjustment: chosen.PriceAdjustment,
+		})
+	}
+
+	for slotID := range item.Selections {
+		if !used[slotID] {
+			return nil, invalidf("slot %d is not part of product %d", slotID, item.ProductID)
+		}
+	}
+
+	return components, nil
+}
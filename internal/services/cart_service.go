@@ -0,0 +1,477 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+	"github.com/lib/pq"
+)
+
+// DefaultCartTTL is how long a cart survives without being changed.
+const DefaultCartTTL = 7 * 24 * time.Hour
+
+type CartService struct {
+	DB             *sql.DB
+	PricingService *PricingService
+	OrderService   *OrderService
+	TTL            time.Duration
+}
+
+func NewCartService(db *sql.DB, pricingService *PricingService, orderService *OrderService) *CartService {
+	return &CartService{DB: db, PricingService: pricingService, OrderService: orderService, TTL: DefaultCartTTL}
+}
+
+// GetCart returns a customer's cart, priced from the catalog. A customer
+// without a live cart gets an empty one.
+func (s *CartService) GetCart(userID int64) (*models.Cart, error) {
+	cart := &models.Cart{UserID: userID, Items: []models.CartItem{}}
+	query := `
+		SELECT id, COALESCE(store_id, 0), COALESCE(order_type, ''), COALESCE(delivery_address, ''),
+			COALESCE(delivery_postcode, ''), delivery_latitude, delivery_longitude, COALESCE(promotion_code, ''),
+			scheduled_for, tip_amount, tip_percent, version, expires_at, created_at, updated_at
+		FROM carts WHERE user_id = $1 AND expires_at > CURRENT_TIMESTAMP
+	`
+	var lat, lng sql.NullFloat64
+	err := s.DB.QueryRow(query, userID).Scan(
+		&cart.ID, &cart.StoreID, &cart.OrderType, &cart.DeliveryAddress,
+		&cart.DeliveryPostcode, &lat, &lng, &cart.PromotionCode, &cart.ScheduledFor, &cart.TipAmount, &cart.TipPercent,
+		&cart.Version, &cart.ExpiresAt, &cart.CreatedAt, &cart.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return cart, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cart.DeliveryLocation = geoPoint(lat, lng)
+
+	rows, err := s.DB.Query(`
+		SELECT id, product_id, quantity, selections, modifier_ids
+		FROM cart_items WHERE cart_id = $1 ORDER BY id
+	`, cart.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.CartItem
+		var selections []byte
+		var modifierIDs pq.Int64Array
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &selections, &modifierIDs); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(selections, &item.Selections); err != nil {
+			return nil, err
+		}
+		item.ModifierIDs = modifierIDs
+		cart.Items = append(cart.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s.priceCart(cart)
+	return cart, nil
+}
+
+// orderFromCart builds the order a cart would place.
+func orderFromCart(cart *models.Cart) models.Order {
+	order := models.Order{
+		UserID:           cart.UserID,
+		StoreID:          cart.StoreID,
+		OrderType:        cart.OrderType,
+		DeliveryAddress:  cart.DeliveryAddress,
+		DeliveryPostcode: cart.DeliveryPostcode,
+		DeliveryLocation: cart.DeliveryLocation,
+		PromotionCode:    cart.PromotionCode,
+		ScheduledFor:     cart.ScheduledFor,
+		TipPercent:       cart.TipPercent,
+	}
+	if cart.TipAmount != nil {
+		order.TipAmount = *cart.TipAmount
+	}
+	for _, item := range cart.Items {
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID:   item.ProductID,
+			Quantity:    item.Quantity,
+			Selections:  item.Selections,
+			ModifierIDs: item.ModifierIDs,
+		})
+	}
+	return order
+}
+
+// priceCart fills in the cart's live pricing. Problems such as an expired
+// promotion code are reported on the cart rather than failing the read, so
+// the customer can see and fix them.
+func (s *CartService) priceCart(cart *models.Cart) {
+	if cart.StoreID == 0 || len(cart.Items) == 0 {
+		return
+	}
+
+	order := orderFromCart(cart)
+	if err := s.PricingService.PriceOrder(&order); err != nil {
+		cart.PricingError = err.Error()
+		return
+	}
+
+	cart.Pricing = &order.OrderPricing
+	for i := range cart.Items {
+		unitPrice := order.Items[i].UnitPrice
+		cart.Items[i].UnitPrice = &unitPrice
+		cart.Items[i].Components = order.Items[i].Components
+		cart.Items[i].Modifiers = order.Items[i].Modifiers
+	}
+}
+
+// touchCart locks the customer's cart for a change, creating it if needed,
+// and pushes its expiry back. An expired cart is thrown away first so the
+// customer starts fresh. If expectedVersion is non-zero it must match the
+// cart's current version.
+func (s *CartService) touchCart(tx *sql.Tx, userID int64, expectedVersion int) (int64, error) {
+	_, err := tx.Exec(`DELETE FROM carts WHERE user_id = $1 AND expires_at <= CURRENT_TIMESTAMP`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var cartID int64
+	var version int
+	err = tx.QueryRow(`SELECT id, version FROM carts WHERE user_id = $1 FOR UPDATE`, userID).Scan(&cartID, &version)
+	if err == sql.ErrNoRows {
+		if expectedVersion != 0 {
+			return 0, ErrVersionConflict
+		}
+		query := `INSERT INTO carts (user_id, expires_at) VALUES ($1, CURRENT_TIMESTAMP + $2 * INTERVAL '1 second') RETURNING id`
+		err := tx.QueryRow(query, userID, int(s.TTL.Seconds())).Scan(&cartID)
+		return cartID, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	if expectedVersion != 0 && version != expectedVersion {
+		return 0, ErrVersionConflict
+	}
+
+	query := `
+		UPDATE carts
+		SET version = version + 1, expires_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	_, err = tx.Exec(query, cartID, int(s.TTL.Seconds()))
+	return cartID, err
+}
+
+// UpdateCart sets where, how and when the cart will be ordered, its
+// promotion code and tip. The time slot is checked when the cart is checked
+// out. Items are changed through AddItem, UpdateItem and RemoveItem.
+func (s *CartService) UpdateCart(userID int64, details *models.Cart, expectedVersion int) (*models.Cart, error) {
+	if details.PromotionCode != "" {
+		if _, err := s.PricingService.PromotionService.ApplyPromotion(details.PromotionCode, money.Money{}); err != nil {
+			return nil, err
+		}
+	}
+	if details.TipPercent != nil && !models.IsTipPreset(*details.TipPercent) {
+		return nil, invalidf("tip_percent must be one of %v", models.TipPresets)
+	}
+	if details.TipAmount != nil && details.TipPercent != nil {
+		return nil, invalidf("set tip_amount or tip_percent, not both")
+	}
+	if details.TipAmount != nil && details.TipAmount.IsNegative() {
+		return nil, invalidf("tip_amount cannot be negative")
+	}
+	if details.StoreID != 0 {
+		var exists bool
+		if err := s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM stores WHERE id = $1)`, details.StoreID).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, notFound("store")
+		}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cartID, err := s.touchCart(tx, userID, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE carts
+		SET store_id = NULLIF($1, 0), order_type = NULLIF($2, ''), delivery_address = NULLIF($3, ''),
+			delivery_postcode = NULLIF($4, ''), delivery_latitude = $5, delivery_longitude = $6,
+			promotion_code = NULLIF($7, ''), scheduled_for = $8, tip_amount = $9, tip_percent = $10
+		WHERE id = $11
+	`
+	lat, lng := geoColumns(details.DeliveryLocation)
+	_, err = tx.Exec(query, details.StoreID, details.OrderType, details.DeliveryAddress,
+		models.NormalizePostcode(details.DeliveryPostcode), lat, lng, details.PromotionCode, details.ScheduledFor,
+		details.TipAmount, details.TipPercent, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetCart(userID)
+}
+
+// AddItem puts a product in the cart. Adding a product that is already in
+// the cart with the same bundle selections and modifiers raises the
+// quantity of that line instead of adding another.
+func (s *CartService) AddItem(userID int64, item *models.CartItem, expectedVersion int) (*models.Cart, error) {
+	if item.Quantity <= 0 {
+		return nil, invalidf("quantity must be positive")
+	}
+
+	// Check the product, its bundle selections and its modifiers up front
+	var exists bool
+	if err := s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)`, item.ProductID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, notFound("product")
+	}
+	orderItem := models.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity, Selections: item.Selections}
+	if _, err := s.PricingService.ProductService.BundleComponents(orderItem); err != nil {
+		return nil, err
+	}
+	if _, err := s.PricingService.ProductService.resolveModifiers(item.ProductID, item.ModifierIDs); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cartID, err := s.touchCart(tx, userID, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT id, selections, modifier_ids FROM cart_items WHERE cart_id = $1 AND product_id = $2`,
+		cartID, item.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	var existingID int64
+	for rows.Next() {
+		var line models.CartItem
+		var selections []byte
+		var modifierIDs pq.Int64Array
+		if err := rows.Scan(&line.ID, &selections, &modifierIDs); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal(selections, &line.Selections); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		line.ModifierIDs = modifierIDs
+		if sameCartLine(line, *item) {
+			existingID = line.ID
+			break
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if existingID != 0 {
+		query := `UPDATE cart_items SET quantity = quantity + $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+		if _, err := tx.Exec(query, item.Quantity, existingID); err != nil {
+			return nil, err
+		}
+	} else {
+		selections, err := json.Marshal(item.Selections)
+		if err != nil {
+			return nil, err
+		}
+		if item.Selections == nil {
+			selections = []byte("{}")
+		}
+		query := `INSERT INTO cart_items (cart_id, product_id, quantity, selections, modifier_ids) VALUES ($1, $2, $3, $4, $5)`
+		_, err = tx.Exec(query, cartID, item.ProductID, item.Quantity, selections, pq.Int64Array(item.ModifierIDs))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetCart(userID)
+}
+
+// sameCartLine reports whether two cart lines are the same product made the
+// same way. Modifier order does not matter.
+func sameCartLine(a, b models.CartItem) bool {
+	if len(a.Selections) != len(b.Selections) || len(a.ModifierIDs) != len(b.ModifierIDs) {
+		return false
+	}
+	for slotID, productID := range a.Selections {
+		if b.Selections[slotID] != productID {
+			return false
+		}
+	}
+
+	am := append([]int64(nil), a.ModifierIDs...)
+	bm := append([]int64(nil), b.ModifierIDs...)
+	sort.Slice(am, func(i, j int) bool { return am[i] < am[j] })
+	sort.Slice(bm, func(i, j int) bool { return bm[i] < bm[j] })
+	for i := range am {
+		if am[i] != bm[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateItem sets the quantity of a line in the cart.
+func (s *CartService) UpdateItem(userID, itemID int64, quantity int, expectedVersion int) (*models.Cart, error) {
+	if quantity <= 0 {
+		return nil, invalidf("quantity must be positive")
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cartID, err := s.touchCart(tx, userID, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE cart_items SET quantity = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND cart_id = $3`
+	result, err := tx.Exec(query, quantity, itemID, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, notFound("cart item")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetCart(userID)
+}
+
+// RemoveItem takes a line out of the cart.
+func (s *CartService) RemoveItem(userID, itemID int64, expectedVersion int) (*models.Cart, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cartID, err := s.touchCart(tx, userID, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM cart_items WHERE id = $1 AND cart_id = $2`, itemID, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, notFound("cart item")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetCart(userID)
+}
+
+// ClearCart empties and forgets a customer's cart.
+func (s *CartService) ClearCart(userID int64) error {
+	_, err := s.DB.Exec(`DELETE FROM carts WHERE user_id = $1`, userID)
+	return err
+}
+
+// Checkout places the cart as an order through OrderService.CreateOrder and
+// takes the ordered lines out of the cart in the same transaction. The cart
+// is locked before its lines are removed, and if it changed while the order
+// was being placed, from another device say, nothing is ordered and
+// ErrVersionConflict is returned. If expectedVersion is non-zero it must
+// match the cart's version.
+func (s *CartService) Checkout(userID int64, expectedVersion int) (*models.Order, error) {
+	cart, err := s.GetCart(userID)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != 0 && cart.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+	if len(cart.Items) == 0 {
+		return nil, invalidf("cart is empty")
+	}
+
+	order := orderFromCart(cart)
+	err = s.OrderService.createOrder(&order, func(tx *sql.Tx) error {
+		return removeOrdered(tx, cart)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// removeOrdered locks the cart, checks it is still the version that was
+// ordered, and deletes it along with its lines.
+func removeOrdered(tx *sql.Tx, cart *models.Cart) error {
+	var version int
+	err := tx.QueryRow(`SELECT version FROM carts WHERE id = $1 FOR UPDATE`, cart.ID).Scan(&version)
+	if err == sql.ErrNoRows || (err == nil && version != cart.Version) {
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM cart_items WHERE cart_id = $1`, cart.ID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM carts WHERE id = $1`, cart.ID)
+	return err
+}
+
+// ExpireCarts deletes carts that have not been changed within their TTL.
+func (s *CartService) ExpireCarts() (int64, error) {
+	result, err := s.DB.Exec(`DELETE FROM carts WHERE expires_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RunExpiryLoop deletes expired carts every interval. It never returns and
+// is meant to be started in its own goroutine.
+func (s *CartService) RunExpiryLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := s.ExpireCarts(); err != nil {
+			log.Printf("Failed to delete expired carts: %v", err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+type CategoryService struct {
+	DB *sql.DB
+}
+
+func NewCategoryService(db *sql.DB) *CategoryService {
+	return &CategoryService{DB: db}
+}
+
+func (s *CategoryService) CreateCategory(category *models.Category) error {
+	if category.Name == "" {
+		return errors.New("category name is required")
+	}
+
+	query := `INSERT INTO categories (name, description) VALUES ($1, $2) RETURNING id, created_at, updated_at`
+
+	return s.DB.QueryRow(query, category.Name, category.Description).
+		Scan(&category.ID, &category.CreatedAt, &category.UpdatedAt)
+}
+
+func (s *CategoryService) GetCategory(id int64) (*models.Category, error) {
+	category := &models.Category{}
+	query := `SELECT id, name, COALESCE(description, ''), created_at, updated_at FROM categories WHERE id = $1`
+
+	err := s.DB.QueryRow(query, id).Scan(
+		&category.ID, &category.Name, &category.Description, &category.CreatedAt, &category.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("category")
+		}
+		return nil, err
+	}
+
+	return category, nil
+}
+
+func (s *CategoryService) ListCategories() ([]*models.Category, error) {
+	query := `SELECT id, name, COALESCE(description, ''), created_at, updated_at FROM categories ORDER BY name`
+
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []*models.Category
+	for rows.Next() {
+		category := &models.Category{}
+		err := rows.Scan(&category.ID, &category.Name, &category.Description, &category.CreatedAt, &category.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, nil
+}
+
+func (s *CategoryService) UpdateCategory(category *models.Category) error {
+	if category.Name == "" {
+		return errors.New("category name is required")
+	}
+
+	query := `UPDATE categories SET name = $1, description = $2, updated_at = CURRENT_TIMESTAMP
+              WHERE id = $3 RETURNING created_at, updated_at`
+
+	err := s.DB.QueryRow(query, category.Name, category.Description, category.ID).
+		Scan(&category.CreatedAt, &category.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return notFound("category")
+	}
+	return err
+}
+
+// DeleteCategory removes a category. Its products stay in the catalog
+// without a category.
+func (s *CategoryService) DeleteCategory(id int64) error {
+	query := `DELETE FROM categories WHERE id = $1`
+	_, err := s.DB.Exec(query, id)
+	return err
+}
+
+// LocalizeCategories translates categories in place for the preferred
+// languages, falling back to the untranslated text.
+func (s *CategoryService) LocalizeCategories(categories []*models.Category, langs []string) error {
+	if len(langs) == 0 || len(categories) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(categories))
+	for i, c := range categories {
+		ids[i] = c.ID
+	}
+	translations, err := categoryTranslations.load(s.DB, ids, models.LanguageFallbacks(langs))
+	if err != nil {
+		return err
+	}
+
+	for _, c := range categories {
+		c.Locale = models.DefaultLanguage
+		if tr, ok := models.PickTranslation(translations[c.ID], langs); ok {
+			c.Name = tr.Name
+			if tr.Description != "" {
+				c.Description = tr.Description
+			}
+			c.Locale = tr.Locale
+		}
+	}
+	return nil
+}
+
+func (s *CategoryService) ListTranslations(categoryID int64) ([]models.Translation, error) {
+	return categoryTranslations.list(s.DB, categoryID)
+}
+
+func (s *CategoryService) SetTranslation(categoryID int64, translation *models.Translation) error {
+	return categoryTranslations.set(s.DB, categoryID, translation)
+}
+
+func (s *CategoryService) DeleteTranslation(categoryID int64, locale string) error {
+	return categoryTranslations.delete(s.DB, categoryID, locale)
+}
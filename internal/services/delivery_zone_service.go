@@ -0,0 +1,252 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrNoDeliveryZone is returned for a delivery to an address none of the
+// store's delivery zones cover.
+var ErrNoDeliveryZone = invalidf("the store does not deliver to this address")
+
+type DeliveryZoneService struct {
+	DB *sql.DB
+}
+
+func NewDeliveryZoneService(db *sql.DB) *DeliveryZoneService {
+	return &DeliveryZoneService{DB: db}
+}
+
+// deliveryZoneColumns lists the delivery_zones columns in the order
+// scanDeliveryZone reads them.
+const deliveryZoneColumns = `id, store_id, name, postcodes, polygon, fee, minimum_order, eta_minutes, is_active, created_at, updated_at`
+
+func scanDeliveryZone(row rowScanner, zone *models.DeliveryZone) error {
+	var postcodes pq.StringArray
+	var polygon []byte
+	err := row.Scan(
+		&zone.ID, &zone.StoreID, &zone.Name, &postcodes, &polygon, &zone.Fee, &zone.MinimumOrder,
+		&zone.ETAMinutes, &zone.IsActive, &zone.CreatedAt, &zone.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	zone.Postcodes = postcodes
+	if polygon != nil {
+		return json.Unmarshal(polygon, &zone.Polygon)
+	}
+	return nil
+}
+
+// validateDeliveryZone checks a zone and normalizes its postcodes.
+func validateDeliveryZone(zone *models.DeliveryZone) error {
+	if zone.Name == "" {
+		return errors.New("zone name is required")
+	}
+	if len(zone.Postcodes) == 0 && len(zone.Polygon) == 0 {
+		return errors.New("a zone needs postcodes or a polygon")
+	}
+	if len(zone.Polygon) > 0 && len(zone.Polygon) < 3 {
+		return errors.New("polygon needs at least 3 points")
+	}
+	for _, p := range zone.Polygon {
+		if p.Lat < -90 || p.Lat > 90 || p.Lng < -180 || p.Lng > 180 {
+			return fmt.Errorf("invalid polygon point %v,%v", p.Lat, p.Lng)
+		}
+	}
+	if zone.Fee.IsNegative() {
+		return errors.New("fee cannot be negative")
+	}
+	if zone.MinimumOrder.IsNegative() {
+		return errors.New("minimum_order cannot be negative")
+	}
+	if zone.ETAMinutes < 0 {
+		return errors.New("eta_minutes cannot be negative")
+	}
+
+	postcodes := make([]string, 0, len(zone.Postcodes))
+	for _, p := range zone.Postcodes {
+		if p = models.NormalizePostcode(p); p != "" {
+			postcodes = append(postcodes, p)
+		}
+	}
+	zone.Postcodes = postcodes
+	return nil
+}
+
+// polygonValue encodes a zone's polygon for the JSONB column, or NULL when
+// the zone matches by postcode only.
+func polygonValue(polygon []models.GeoPoint) (interface{}, error) {
+	if len(polygon) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(polygon)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (s *DeliveryZoneService) CreateZone(zone *models.DeliveryZone) error {
+	if err := validateDeliveryZone(zone); err != nil {
+		return err
+	}
+	polygon, err := polygonValue(zone.Polygon)
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM stores WHERE id = $1)`, zone.StoreID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return notFound("store")
+	}
+
+	query := `INSERT INTO delivery_zones (store_id, name, postcodes, polygon, fee, minimum_order, eta_minutes, is_active)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at`
+	return s.DB.QueryRow(query, zone.StoreID, zone.Name, pq.Array(zone.Postcodes), polygon, zone.Fee,
+		zone.MinimumOrder, zone.ETAMinutes, zone.IsActive).
+		Scan(&zone.ID, &zone.CreatedAt, &zone.UpdatedAt)
+}
+
+func (s *DeliveryZoneService) GetZone(id int64) (*models.DeliveryZone, error) {
+	zone := &models.DeliveryZone{}
+	query := `SELECT ` + deliveryZoneColumns + ` FROM delivery_zones WHERE id = $1`
+	if err := scanDeliveryZone(s.DB.QueryRow(query, id), zone); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("delivery zone")
+		}
+		return nil, err
+	}
+	return zone, nil
+}
+
+// ListZones returns a store's delivery zones, inactive ones included.
+func (s *DeliveryZoneService) ListZones(storeID int64) ([]*models.DeliveryZone, error) {
+	return listDeliveryZones(s.DB, storeID, false)
+}
+
+func listDeliveryZones(db *sql.DB, storeID int64, activeOnly bool) ([]*models.DeliveryZone, error) {
+	query := `SELECT ` + deliveryZoneColumns + ` FROM delivery_zones
+              WHERE store_id = $1 AND (is_active OR NOT $2) ORDER BY fee, id`
+	rows, err := db.Query(query, storeID, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zones := []*models.DeliveryZone{}
+	for rows.Next() {
+		zone := &models.DeliveryZone{}
+		if err := scanDeliveryZone(rows, zone); err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+	}
+
+	return zones, rows.Err()
+}
+
+func (s *DeliveryZoneService) UpdateZone(zone *models.DeliveryZone) error {
+	if err := validateDeliveryZone(zone); err != nil {
+		return err
+	}
+	polygon, err := polygonValue(zone.Polygon)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE delivery_zones SET name = $1, postcodes = $2, polygon = $3, fee = $4, minimum_order = $5,
+              eta_minutes = $6, is_active = $7, updated_at = CURRENT_TIMESTAMP
+              WHERE id = $8 RETURNING store_id, created_at, updated_at`
+	err = s.DB.QueryRow(query, zone.Name, pq.Array(zone.Postcodes), polygon, zone.Fee, zone.MinimumOrder,
+		zone.ETAMinutes, zone.IsActive, zone.ID).
+		Scan(&zone.StoreID, &zone.CreatedAt, &zone.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return notFound("delivery zone")
+	}
+	return err
+}
+
+func (s *DeliveryZoneService) DeleteZone(id int64) error {
+	_, err := s.DB.Exec(`DELETE FROM delivery_zones WHERE id = $1`, id)
+	return err
+}
+
+// FindZone returns the zone a delivery to the given postcode or location
+// would use. A zone that covers one but is contradicted by the other, such
+// as a listed postcode with a location outside the zone's polygon, is not
+// used. ok is false when the store has no active zones at all, in which
+// case it delivers anywhere for its flat delivery fee. A store with zones
+// that cover neither returns ErrNoDeliveryZone. Where zones overlap, the
+// cheapest applies.
+func (s *DeliveryZoneService) FindZone(storeID int64, postcode string, location *models.GeoPoint) (zone *models.DeliveryZone, ok bool, err error) {
+	return findDeliveryZone(s.DB, storeID, postcode, location)
+}
+
+func findDeliveryZone(db *sql.DB, storeID int64, postcode string, location *models.GeoPoint) (*models.DeliveryZone, bool, error) {
+	zones, err := listDeliveryZones(db, storeID, true)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(zones) == 0 {
+		return nil, false, nil
+	}
+	if models.NormalizePostcode(postcode) == "" && location == nil {
+		return nil, true, invalidf("delivery_postcode or delivery_location is required for delivery")
+	}
+
+	for _, zone := range zones {
+		if zone.Covers(postcode, location) && !zone.Contradicts(postcode, location) {
+			return zone, true, nil
+		}
+	}
+	return nil, true, ErrNoDeliveryZone
+}
+
+// checkDeliveryAddress makes sure a delivery order has an address and that
+// its postcode, when given, is the one in the address. The zone is found
+// from the postcode and location, so a postcode taken from elsewhere could
+// buy a cheaper zone than the address is in.
+func checkDeliveryAddress(order *models.Order) error {
+	if strings.TrimSpace(order.DeliveryAddress) == "" {
+		return invalidf("delivery_address is required for delivery")
+	}
+	postcode := models.NormalizePostcode(order.DeliveryPostcode)
+	if postcode != "" && !addressHasPostcode(order.DeliveryAddress, postcode) {
+		return invalidf("delivery_postcode %s is not part of delivery_address", order.DeliveryPostcode)
+	}
+	return nil
+}
+
+// addressHasPostcode reports whether a normalized postcode is made of whole
+// words of address, so "10" is found in "10 High St" but not in "E10 7AA".
+// A postcode written with a space or dash spans consecutive words.
+func addressHasPostcode(address, postcode string) bool {
+	words := strings.FieldsFunc(strings.ToUpper(address), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i := range words {
+		joined := ""
+		for _, word := range words[i:] {
+			joined += word
+			if len(joined) >= len(postcode) {
+				break
+			}
+		}
+		if joined == postcode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ErrNotFound is returned, wrapped with what was missing, when a row a
+// request names does not exist.
+var ErrNotFound = errors.New("not found")
+
+// notFound returns ErrNotFound for a missing row, as in "product not found".
+func notFound(what string) error {
+	return fmt.Errorf("%s %w", what, ErrNotFound)
+}
+
+// ErrInvalid is matched, with errors.Is, by errors that reject a request as
+// sent rather than failing on the server's side, such as an order for a
+// modifier the product does not have. Their messages say what is wrong.
+var ErrInvalid = errors.New("invalid request")
+
+type invalidError struct {
+	msg string
+}
+
+func (e *invalidError) Error() string        { return e.msg }
+func (e *invalidError) Is(target error) bool { return target == ErrInvalid }
+
+// invalidf returns an error matching ErrInvalid with a formatted message.
+func invalidf(format string, args ...interface{}) error {
+	return &invalidError{msg: fmt.Sprintf(format, args...)}
+}
+
+// ErrInsufficientStock is returned when a store does not have enough of a
+// product left for a sale, reservation or adjustment.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ErrVersionConflict is returned when an update names a version of a row
+// that is no longer current because someone else changed it first.
+var ErrVersionConflict = errors.New("resource was modified by another request")
+
+// ErrInvalidTransition is returned when a status change is not part of a
+// lifecycle, such as reopening a cancelled order.
+var ErrInvalidTransition = errors.New("status change is not allowed")
+
+// ErrForbidden is returned when the acting user's role may not perform an
+// otherwise valid action.
+var ErrForbidden = errors.New("not permitted for this role")
+
+// ErrInUse is returned when a row cannot be deleted because other records,
+// such as orders or the inventory ledger, still refer to it.
+var ErrInUse = errors.New("cannot be deleted while orders or stock history refer to it")
+
+// deleteError turns the foreign key violation from deleting a row that is
+// still referenced into ErrInUse, naming what could not be deleted.
+func deleteError(err error, what string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return fmt.Errorf("%s %w", what, ErrInUse)
+	}
+	return err
+}
+
+// checkVersionConflict is called after a versioned update matched no rows.
+// It tells a stale version apart from a missing row.
+func checkVersionConflict(db *sql.DB, table string, id int64, notFound error) error {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return notFound
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+const (
+	// DefaultIdempotencyTTL is how long a stored response can be replayed.
+	DefaultIdempotencyTTL = 24 * time.Hour
+
+	// idempotencyLockTimeout is how long a request may hold its key without
+	// finishing before a retry is allowed to take over, in case the server
+	// went away mid-request.
+	idempotencyLockTimeout = 5 * time.Minute
+)
+
+// IdempotencyService stores idempotency keys in Postgres for the
+// Idempotency middleware.
+type IdempotencyService struct {
+	DB  *sql.DB
+	TTL time.Duration
+}
+
+func NewIdempotencyService(db *sql.DB) *IdempotencyService {
+	return &IdempotencyService{DB: db, TTL: DefaultIdempotencyTTL}
+}
+
+// Claim records a request as started, or returns the earlier record if the
+// user has already used the key. Expired keys and abandoned claims are
+// cleared first so they can be used again.
+func (s *IdempotencyService) Claim(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+			AND (created_at <= CURRENT_TIMESTAMP - $3 * INTERVAL '1 second'
+				OR (completed_at IS NULL AND created_at <= CURRENT_TIMESTAMP - $4 * INTERVAL '1 second'))
+	`
+	_, err := s.DB.Exec(query, record.UserID, record.Key, int(s.TTL.Seconds()), int(idempotencyLockTimeout.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO idempotency_keys (user_id, key, method, path, fingerprint)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, key) DO NOTHING
+		RETURNING created_at
+	`
+	err = s.DB.QueryRow(query, record.UserID, record.Key, record.Method, record.Path, record.Fingerprint).
+		Scan(&record.CreatedAt)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	existing := &models.IdempotencyRecord{UserID: record.UserID, Key: record.Key}
+	var statusCode sql.NullInt64
+	var header []byte
+	query = `
+		SELECT method, path, fingerprint, status_code, headers, body, created_at, completed_at
+		FROM idempotency_keys WHERE user_id = $1 AND key = $2
+	`
+	err = s.DB.QueryRow(query, record.UserID, record.Key).Scan(
+		&existing.Method, &existing.Path, &existing.Fingerprint, &statusCode, &header,
+		&existing.Body, &existing.CreatedAt, &existing.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	existing.StatusCode = int(statusCode.Int64)
+	if header != nil {
+		if err := json.Unmarshal(header, &existing.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return existing, nil
+}
+
+// Complete saves the response to a claimed request.
+func (s *IdempotencyService) Complete(record *models.IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $1, headers = $2, body = $3, completed_at = CURRENT_TIMESTAMP
+		WHERE user_id = $4 AND key = $5
+	`
+	_, err = s.DB.Exec(query, record.StatusCode, header, record.Body, record.UserID, record.Key)
+	return err
+}
+
+// Release forgets a request that did not finish so it can be retried.
+func (s *IdempotencyService) Release(userID int64, key string) error {
+	_, err := s.DB.Exec(`DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND completed_at IS NULL`, userID, key)
+	return err
+}
+
+// ExpireKeys deletes keys older than the TTL.
+func (s *IdempotencyService) ExpireKeys() (int64, error) {
+	result, err := s.DB.Exec(`DELETE FROM idempotency_keys WHERE created_at <= CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'`,
+		int(s.TTL.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RunExpiryLoop deletes expired keys every interval. It never returns and is
+// meant to be started in its own goroutine.
+func (s *IdempotencyService) RunExpiryLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := s.ExpireKeys(); err != nil {
+			log.Printf("Failed to delete expired idempotency keys: %v", err)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+// AlertNotifier delivers low-stock alerts to whoever handles reordering.
+type AlertNotifier interface {
+	NotifyLowStock(alert *models.StockAlert) error
+}
+
+// LogAlertNotifier writes alerts to the standard logger.
+type LogAlertNotifier struct{}
+
+func (LogAlertNotifier) NotifyLowStock(alert *models.StockAlert) error {
+	log.Printf("Low stock: %s (product %d) at store %d has %d left, reorder threshold is %d",
+		alert.ProductName, alert.ProductID, alert.StoreID, alert.StockQuantity, alert.ReorderThreshold)
+	return nil
+}
+
+// WebhookAlertNotifier POSTs each alert as JSON to a configured URL.
+type WebhookAlertNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookAlertNotifier(url string) *WebhookAlertNotifier {
+	return &WebhookAlertNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *WebhookAlertNotifier) NotifyLowStock(alert *models.StockAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type InventoryService struct {
+	DB       *sql.DB
+	Notifier AlertNotifier
+
+	// dispatch wakes RunDispatchLoop when new alerts may be waiting.
+	dispatch chan struct{}
+}
+
+func NewInventoryService(db *sql.DB, notifier AlertNotifier) *InventoryService {
+	return &InventoryService{DB: db, Notifier: notifier, dispatch: make(chan struct{}, 1)}
+}
+
+// CheckLowStock records an alert when a stock change moves a store's stock of
+// a product from at or above its reorder threshold to below it. The alert is
+// written in the caller's transaction so it disappears if the change is rolled
+// back; call QueueDispatch once committed to have it delivered.
+func (s *InventoryService) CheckLowStock(tx *sql.Tx, storeID, productID int64, oldQuantity, newQuantity int) error {
+	var threshold int
+	err := tx.QueryRow(`SELECT reorder_threshold FROM products WHERE id = $1`, productID).Scan(&threshold)
+	if err != nil {
+		return err
+	}
+
+	if threshold <= 0 || newQuantity >= threshold || oldQuantity < threshold {
+		return nil
+	}
+
+	query := `INSERT INTO stock_alerts (store_id, product_id, stock_quantity, reorder_threshold) VALUES ($1, $2, $3, $4)`
+	_, err = tx.Exec(query, storeID, productID, newQuantity, threshold)
+	return err
+}
+
+// QueueDispatch asks RunDispatchLoop to deliver pending alerts soon. It never
+// blocks, so it is safe to call on the request path.
+func (s *InventoryService) QueueDispatch() {
+	select {
+	case s.dispatch <- struct{}{}:
+	default:
+	}
+}
+
+// RunDispatchLoop delivers pending alerts whenever QueueDispatch is called,
+// and every interval to retry alerts that failed to send. It never returns
+// and is meant to be started in its own goroutine.
+func (s *InventoryService) RunDispatchLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.dispatch:
+		case <-ticker.C:
+		}
+		if err := s.DispatchAlerts(); err != nil {
+			log.Printf("Failed to dispatch stock alerts: %v", err)
+		}
+	}
+}
+
+// DispatchAlerts sends every alert that has not been delivered yet. Alerts
+// are claimed by marking them notified before they are sent, so concurrent
+// dispatches never send the same alert twice; one that fails to send is put
+// back and retried on the next dispatch.
+func (s *InventoryService) DispatchAlerts() error {
+	query := `
+		WITH claimed AS (
+			UPDATE stock_alerts SET notified_at = CURRENT_TIMESTAMP
+			WHERE id IN (SELECT id FROM stock_alerts WHERE notified_at IS NULL FOR UPDATE SKIP LOCKED)
+			RETURNING *
+		)
+		SELECT ` + alertColumns + `
+		FROM claimed a
+		JOIN products p ON p.id = a.product_id
+		ORDER BY a.created_at
+	`
+	alerts, err := s.queryAlerts(query)
+	if err != nil {
+		return err
+	}
+
+	for _, alert := range alerts {
+		if err := s.Notifier.NotifyLowStock(alert); err != nil {
+			log.Printf("Failed to deliver stock alert %d: %v", alert.ID, err)
+			if _, err := s.DB.Exec(`UPDATE stock_alerts SET notified_at = NULL WHERE id = $1`, alert.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ListAlerts returns alerts newest first, optionally limited to one store
+// and/or product. Zero IDs match everything.
+func (s *InventoryService) ListAlerts(storeID, productID int64) ([]*models.StockAlert, error) {
+	query := `
+		SELECT ` + alertColumns + `
+		FROM stock_alerts a
+		JOIN products p ON p.id = a.product_id
+		WHERE ($1 = 0 OR a.store_id = $1) AND ($2 = 0 OR a.product_id = $2)
+		ORDER BY a.created_at DESC
+	`
+	return s.queryAlerts(query, storeID, productID)
+}
+
+// alertColumns lists the columns queryAlerts reads, from stock_alerts a
+// joined with products p.
+const alertColumns = `a.id, a.store_id, a.product_id, p.name, a.stock_quantity, a.reorder_threshold, a.notified_at, a.created_at`
+
+func (s *InventoryService) queryAlerts(query string, args ...interface{}) ([]*models.StockAlert, error) {
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []*models.StockAlert
+	for rows.Next() {
+		alert := &models.StockAlert{}
+		err := rows.Scan(
+			&alert.ID, &alert.StoreID, &alert.ProductID, &alert.ProductName,
+			&alert.StockQuantity, &alert.ReorderThreshold, &alert.NotifiedAt, &alert.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+// StockChange describes a change to a store's stock and why it happened.
+// Quantity is always positive; the direction comes from the operation.
+// ActorID and OrderID are optional and left empty when zero. ReservationID
+// names a reservation whose held stock the change may consume.
+type StockChange struct {
+	StoreID       int64
+	ProductID     int64
+	Quantity      int
+	Reason        string
+	ActorID       int64
+	OrderID       int64
+	ReservationID int64
+	Note          string
+}
+
+func recordMovement(tx *sql.Tx, change StockChange, quantityChange, balanceAfter int) (*models.InventoryMovement, error) {
+	m := &models.InventoryMovement{
+		StoreID:        change.StoreID,
+		ProductID:      change.ProductID,
+		QuantityChange: quantityChange,
+		BalanceAfter:   balanceAfter,
+		Reason:         change.Reason,
+		Note:           change.Note,
+	}
+	if change.ActorID != 0 {
+		m.ActorID = &change.ActorID
+	}
+	if change.OrderID != 0 {
+		m.OrderID = &change.OrderID
+	}
+
+	query := `
+		INSERT INTO inventory_movements (store_id, product_id, quantity_change, balance_after, reason, actor_id, order_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	err := tx.QueryRow(query, m.StoreID, m.ProductID, m.QuantityChange, m.BalanceAfter, m.Reason,
+		m.ActorID, m.OrderID, sql.NullString{String: m.Note, Valid: m.Note != ""},
+	).Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AdjustStock applies a manual correction or a waste write-off to a store's
+// stock. quantityChange is signed for adjustments; waste always removes stock.
+func (s *InventoryService) AdjustStock(change StockChange, quantityChange int) (*models.InventoryMovement, error) {
+	switch change.Reason {
+	case models.MovementAdjustment:
+		if quantityChange == 0 {
+			return nil, errors.New("quantity_change cannot be zero")
+		}
+	case models.MovementWaste:
+		if quantityChange >= 0 {
+			return nil, errors.New("waste must remove stock")
+		}
+	default:
+		return nil, fmt.Errorf("reason must be %q or %q", models.MovementAdjustment, models.MovementWaste)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var oldQuantity int
+	query := `SELECT stock_quantity FROM store_products WHERE store_id = $1 AND product_id = $2 FOR UPDATE`
+	err = tx.QueryRow(query, change.StoreID, change.ProductID).Scan(&oldQuantity)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	newQuantity := oldQuantity + quantityChange
+	if newQuantity < 0 {
+		return nil, ErrInsufficientStock
+	}
+
+	query = `
+		INSERT INTO store_products (store_id, product_id, stock_quantity)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (store_id, product_id) DO UPDATE
+		SET stock_quantity = $3,
+			updated_at = CURRENT_TIMESTAMP
+	`
+	if _, err := tx.Exec(query, change.StoreID, change.ProductID, newQuantity); err != nil {
+		return nil, err
+	}
+
+	movement, err := recordMovement(tx, change, quantityChange, newQuantity)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.CheckLowStock(tx, change.StoreID, change.ProductID, oldQuantity, newQuantity); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.QueueDispatch()
+
+	return movement, nil
+}
+
+// ListMovements returns a product's ledger entries newest first. A zero
+// storeID returns movements across all stores; a zero limit returns all.
+func (s *InventoryService) ListMovements(storeID, productID int64, limit int) ([]*models.InventoryMovement, error) {
+	query := `
+		SELECT id, store_id, product_id, quantity_change, balance_after, reason, actor_id, order_id, COALESCE(note, ''), created_at
+		FROM inventory_movements
+		WHERE product_id = $1 AND ($2 = 0 OR store_id = $2)
+		ORDER BY id DESC
+		LIMIT NULLIF($3, 0)
+	`
+	rows, err := s.DB.Query(query, productID, storeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []*models.InventoryMovement
+	for rows.Next() {
+		m := &models.InventoryMovement{}
+		err := rows.Scan(&m.ID, &m.StoreID, &m.ProductID, &m.QuantityChange, &m.BalanceAfter,
+			&m.Reason, &m.ActorID, &m.OrderID, &m.Note, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+
+	return movements, nil
+}
+
+// Reconcile sums a product's ledger at a store and compares it with the
+// store's current stock. A non-zero discrepancy means stock was changed
+// without going through the ledger.
+func (s *InventoryService) Reconcile(storeID, productID int64) (*models.InventoryReconciliation, error) {
+	query := `
+		SELECT
+			COALESCE((SELECT SUM(quantity_change) FROM inventory_movements WHERE store_id = $1 AND product_id = $2), 0),
+			COALESCE((SELECT stock_quantity FROM store_products WHERE store_id = $1 AND product_id = $2), 0)
+	`
+	rec := &models.InventoryReconciliation{StoreID: storeID, ProductID: productID}
+	err := s.DB.QueryRow(query, storeID, productID).Scan(&rec.LedgerQuantity, &rec.StockQuantity)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.Discrepancy = rec.StockQuantity - rec.LedgerQuantity
+	return rec, nil
+}
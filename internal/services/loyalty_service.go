@@ -32,6 +32,19 @@ func (s *LoyaltyService) AddLoyaltyPoints(userID, orderID int64, points int) err
 	}
 	defer tx.Rollback()
 
+	if err := s.addLoyaltyPoints(tx, userID, orderID, points); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// addLoyaltyPoints credits points to a user inside the caller's transaction.
+func (s *LoyaltyService) addLoyaltyPoints(tx *sql.Tx, userID, orderID int64, points int) error {
+	if points <= 0 {
+		return nil
+	}
+
 	// Update or insert loyalty points
 	query := `
 		INSERT INTO loyalty_points (user_id, points)
@@ -40,7 +53,7 @@ func (s *LoyaltyService) AddLoyaltyPoints(userID, orderID int64, points int) err
 		SET points = loyalty_points.points + $2,
 			updated_at = CURRENT_TIMESTAMP
 	`
-	_, err = tx.Exec(query, userID, points)
+	_, err := tx.Exec(query, userID, points)
 	if err != nil {
 		return err
 	}
@@ -48,11 +61,100 @@ func (s *LoyaltyService) AddLoyaltyPoints(userID, orderID int64, points int) err
 	// Record loyalty transaction
 	query = `INSERT INTO loyalty_transactions (user_id, order_id, points, type) VALUES ($1, $2, $3, 'earn')`
 	_, err = tx.Exec(query, userID, orderID, points)
+	return err
+}
+
+// reverseOrderPoints takes back the points a user earned on an order, inside
+// the caller's transaction. Points already spent can leave the balance
+// short, so it never goes below zero.
+func (s *LoyaltyService) reverseOrderPoints(tx *sql.Tx, userID, orderID int64) error {
+	earned, err := orderPointsEarned(tx, userID, orderID)
 	if err != nil {
 		return err
 	}
+	if earned <= 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE loyalty_points
+		SET points = GREATEST(points - $2, 0),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1
+	`
+	if _, err := tx.Exec(query, userID, earned); err != nil {
+		return err
+	}
 
-	return tx.Commit()
+	query = `INSERT INTO loyalty_transactions (user_id, order_id, points, type) VALUES ($1, $2, $3, 'reversal')`
+	_, err = tx.Exec(query, userID, orderID, earned)
+	return err
+}
+
+// orderPointsEarned returns the points a user earned on an order that have
+// not been taken back.
+func orderPointsEarned(q queryer, userID, orderID int64) (int, error) {
+	var earned int
+	query := `
+		SELECT COALESCE(SUM(CASE WHEN type = 'earn' THEN points WHEN type = 'reversal' THEN -points ELSE 0 END), 0)
+		FROM loyalty_transactions
+		WHERE user_id = $1 AND order_id = $2
+	`
+	err := q.QueryRow(query, userID, orderID).Scan(&earned)
+	return earned, err
+}
+
+// restoreRedeemedPoints gives back the points spent on an order, inside the
+// caller's transaction, when the order is cancelled. Points are returned to
+// whoever redeemed them.
+func (s *LoyaltyService) restoreRedeemedPoints(tx *sql.Tx, orderID int64) error {
+	query := `
+		SELECT user_id, SUM(CASE WHEN type = 'redeem' THEN points WHEN type = 'restore' THEN -points ELSE 0 END)
+		FROM loyalty_transactions
+		WHERE order_id = $1
+		GROUP BY user_id
+	`
+	rows, err := tx.Query(query, orderID)
+	if err != nil {
+		return err
+	}
+
+	restore := make(map[int64]int)
+	for rows.Next() {
+		var userID int64
+		var points int
+		if err := rows.Scan(&userID, &points); err != nil {
+			rows.Close()
+			return err
+		}
+		if points > 0 {
+			restore[userID] = points
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for userID, points := range restore {
+		query := `
+			INSERT INTO loyalty_points (user_id, points)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE
+			SET points = loyalty_points.points + $2,
+				updated_at = CURRENT_TIMESTAMP
+		`
+		if _, err := tx.Exec(query, userID, points); err != nil {
+			return err
+		}
+
+		query = `INSERT INTO loyalty_transactions (user_id, order_id, points, type) VALUES ($1, $2, $3, 'restore')`
+		if _, err := tx.Exec(query, userID, orderID, points); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (s *LoyaltyService) RedeemLoyaltyPoints(userID, orderID int64, points int) error {
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+)
+
+// Email is a message to one recipient. Text is required; HTML, when set, is
+// sent as its alternative.
+type Email struct {
+	To          string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer sends email to customers.
+type Mailer interface {
+	Send(email *Email) error
+}
+
+// LogMailer writes emails to the standard logger instead of sending them.
+type LogMailer struct{}
+
+func (LogMailer) Send(email *Email) error {
+	log.Printf("Email to %s: %s (%d attachments)\n%s", email.To, email.Subject, len(email.Attachments), email.Text)
+	return nil
+}
+
+// SMTPMailer sends email through an SMTP server, signing in when a username
+// is configured.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func NewSMTPMailer(addr, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{Addr: addr, From: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(email *Email) error {
+	msg, err := buildMessage(m.From, email)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{email.To}, msg)
+}
+
+// buildMessage encodes an email as a MIME message: the text and HTML as
+// alternatives, followed by any attachments.
+func buildMessage(from string, email *Email) ([]byte, error) {
+	if strings.ContainsAny(email.To+email.Subject, "\r\n") {
+		return nil, errors.New("email recipient and subject must be a single line")
+	}
+
+	var body bytes.Buffer
+	mixed := multipart.NewWriter(&body)
+
+	var alt bytes.Buffer
+	alternative := multipart.NewWriter(&alt)
+	if err := writePart(alternative, "text/plain; charset=utf-8", "", email.Text); err != nil {
+		return nil, err
+	}
+	// Clients show the last alternative they understand, so HTML goes last
+	if email.HTML != "" {
+		if err := writePart(alternative, "text/html; charset=utf-8", "", email.HTML); err != nil {
+			return nil, err
+		}
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+
+	w, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + alternative.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(alt.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for _, a := range email.Attachments {
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})
+		if err := writePart(mixed, a.ContentType, disposition, string(a.Data)); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", email.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// writePart adds a base64-encoded part to a multipart message.
+func writePart(mw *multipart.Writer, contentType, disposition, content string) error {
+	header := textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+	}
+	if disposition != "" {
+		header.Set("Content-Disposition", disposition)
+	}
+	w, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	return writeBase64(w, content)
+}
+
+// writeBase64 writes data base64-encoded in lines of 76 characters, as
+// mail transports require.
+func writeBase64(w io.Writer, data string) error {
+	encoded := base64.StdEncoding.EncodeToString([]byte(data))
+	for len(encoded) > 76 {
+		if _, err := fmt.Fprintf(w, "%s\r\n", encoded[:76]); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := fmt.Fprintf(w, "%s\r\n", encoded)
+	return err
+}
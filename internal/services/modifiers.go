@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/lib/pq"
+)
+
+// GetModifiers returns the modifiers that can be added to a product.
+func (s *ProductService) GetModifiers(productID int64) ([]models.ProductModifier, error) {
+	query := `
+		SELECT id, product_id, name, price, created_at, updated_at
+		FROM product_modifiers WHERE product_id = $1 ORDER BY price, name
+	`
+	rows, err := s.DB.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modifiers := []models.ProductModifier{}
+	for rows.Next() {
+		var m models.ProductModifier
+		if err := rows.Scan(&m.ID, &m.ProductID, &m.Name, &m.Price, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		modifiers = append(modifiers, m)
+	}
+
+	return modifiers, rows.Err()
+}
+
+// SetModifiers replaces a product's modifiers. Modifiers with an ID are
+// updated in place so past orders keep pointing at them; new ones are
+// created and any left out are removed.
+func (s *ProductService) SetModifiers(productID int64, modifiers []models.ProductModifier) error {
+	for _, m := range modifiers {
+		if strings.TrimSpace(m.Name) == "" {
+			return errors.New("every modifier needs a name")
+		}
+		if m.Price.IsNegative() {
+			return fmt.Errorf("modifier %q: price cannot be negative", m.Name)
+		}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)`, productID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return notFound("product")
+	}
+
+	var keep []int64
+	for i := range modifiers {
+		m := &modifiers[i]
+		m.ProductID = productID
+		if m.ID == 0 {
+			query := `INSERT INTO product_modifiers (product_id, name, price) VALUES ($1, $2, $3)
+                      RETURNING id, created_at, updated_at`
+			err := tx.QueryRow(query, productID, m.Name, m.Price).Scan(&m.ID, &m.CreatedAt, &m.UpdatedAt)
+			if err != nil {
+				return err
+			}
+		} else {
+			query := `UPDATE product_modifiers SET name = $1, price = $2, updated_at = CURRENT_TIMESTAMP
+                      WHERE id = $3 AND product_id = $4 RETURNING created_at, updated_at`
+			err := tx.QueryRow(query, m.Name, m.Price, m.ID, productID).Scan(&m.CreatedAt, &m.UpdatedAt)
+			if err != nil {
+				return fmt.Errorf("modifier %d not found", m.ID)
+			}
+		}
+		keep = append(keep, m.ID)
+	}
+
+	query := `DELETE FROM product_modifiers WHERE product_id = $1 AND NOT (id = ANY($2))`
+	if _, err := tx.Exec(query, productID, pq.Array(keep)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// resolveModifiers looks up the modifiers chosen for an order item at their
+// current prices. Every ID must belong to the item's product and appear once.
+func (s *ProductService) resolveModifiers(productID int64, ids []int64) ([]models.OrderItemModifier, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT id, name, price FROM product_modifiers WHERE product_id = $1 AND id = ANY($2)`
+	rows, err := s.DB.Query(query, productID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]models.OrderItemModifier)
+	for rows.Next() {
+		var id int64
+		var m models.OrderItemModifier
+		if err := rows.Scan(&id, &m.Name, &m.Price); err != nil {
+			return nil, err
+		}
+		m.ModifierID = &id
+		byID[id] = m
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	modifiers := make([]models.OrderItemModifier, 0, len(ids))
+	seen := make(map[int64]bool)
+	for _, id := range ids {
+		m, ok := byID[id]
+		if !ok {
+			return nil, invalidf("modifier %d is not available for product %d", id, productID)
+		}
+		if seen[id] {
+			return nil, invalidf("modifier %d is listed twice", id)
+		}
+		seen[id] = true
+		modifiers = append(modifiers, m)
+	}
+
+	return modifiers, nil
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+// Notifier delivers notifications to customers over whatever channel it
+// stands for, such as push, SMS or email.
+type Notifier interface {
+	Notify(n *models.Notification) error
+}
+
+// LogNotifier writes notifications to the standard logger, for local use.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(n *models.Notification) error {
+	log.Printf("Notify user %d about order %d: %s: %s", n.UserID, n.OrderID, n.Title, n.Body)
+	return nil
+}
+
+// OrderStatusNotifier tells customers when their orders change status. Its
+// NotifyStatusChange is meant to be hooked up to an OrderEventBroker.
+type OrderStatusNotifier struct {
+	DB       *sql.DB
+	Notifier Notifier
+}
+
+func NewOrderStatusNotifier(db *sql.DB, notifier Notifier) *OrderStatusNotifier {
+	return &OrderStatusNotifier{DB: db, Notifier: notifier}
+}
+
+// NotifyStatusChange sends the customer who placed an order the
+// notification for its new status, if there is one. The change is already
+// committed, so failures are only logged.
+func (n *OrderStatusNotifier) NotifyStatusChange(event models.OrderEvent) {
+	if event.Type != models.OrderEventStatusChanged {
+		return
+	}
+
+	var userID int64
+	var orderType string
+	query := `SELECT user_id, order_type FROM orders WHERE id = $1`
+	if err := n.DB.QueryRow(query, event.OrderID).Scan(&userID, &orderType); err != nil {
+		log.Printf("Failed to look up order %d to notify: %v", event.OrderID, err)
+		return
+	}
+
+	notification, ok := models.OrderStatusNotification(userID, event.OrderID, event.Status, orderType)
+	if !ok {
+		return
+	}
+	if err := n.Notifier.Notify(notification); err != nil {
+		log.Printf("Failed to notify user %d about order %d: %v", userID, event.OrderID, err)
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+// orderEventBuffer is how many events a subscriber may fall behind by
+// before it is dropped.
+const orderEventBuffer = 64
+
+// hookQueueSize is how many events may wait for the OnPublish hooks before
+// further events are dropped.
+const hookQueueSize = 256
+
+// OrderEventBroker fans order events out to the live streams open in this
+// process and to hooks such as customer notifications. Services publish
+// each event once the change behind it is committed.
+type OrderEventBroker struct {
+	mu    sync.Mutex
+	subs  map[chan models.OrderEvent]orderEventFilter
+	hooks []func(models.OrderEvent)
+	queue chan models.OrderEvent
+
+	// dropped counts events the hooks never saw because their queue was full
+	dropped atomic.Uint64
+}
+
+// orderEventFilter picks the events for one store or one order.
+type orderEventFilter struct {
+	storeID int64
+	orderID int64
+}
+
+func (f orderEventFilter) matches(event *models.OrderEvent) bool {
+	if f.orderID != 0 {
+		return event.OrderID == f.orderID
+	}
+	return event.StoreID == f.storeID
+}
+
+func NewOrderEventBroker() *OrderEventBroker {
+	return &OrderEventBroker{
+		subs:  make(map[chan models.OrderEvent]orderEventFilter),
+		queue: make(chan models.OrderEvent, hookQueueSize),
+	}
+}
+
+// Subscribe returns a channel of the events for a store's orders and a
+// function that ends the subscription. A subscriber that falls too far
+// behind has its channel closed; it should catch up from its last event
+// with ListStoreEvents and subscribe again.
+func (b *OrderEventBroker) Subscribe(storeID int64) (<-chan models.OrderEvent, func()) {
+	return b.subscribe(orderEventFilter{storeID: storeID})
+}
+
+// SubscribeOrder is like Subscribe for the events of a single order.
+func (b *OrderEventBroker) SubscribeOrder(orderID int64) (<-chan models.OrderEvent, func()) {
+	return b.subscribe(orderEventFilter{orderID: orderID})
+}
+
+func (b *OrderEventBroker) subscribe(filter orderEventFilter) (<-chan models.OrderEvent, func()) {
+	ch := make(chan models.OrderEvent, orderEventBuffer)
+	b.mu.Lock()
+	b.subs[ch] = filter
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// OnPublish adds a hook that is called with every event published. Hooks
+// run one event at a time, in order, on a goroutine of the broker's own,
+// so a slow hook delays other hooks but never the publisher: once
+// hookQueueSize events are waiting, new ones are dropped for the hooks and
+// counted in DroppedHookEvents. Hooks should log their own failures.
+func (b *OrderEventBroker) OnPublish(hook func(models.OrderEvent)) {
+	b.mu.Lock()
+	if len(b.hooks) == 0 {
+		go b.runHooks()
+	}
+	b.hooks = append(b.hooks, hook)
+	b.mu.Unlock()
+}
+
+func (b *OrderEventBroker) runHooks() {
+	for event := range b.queue {
+		b.mu.Lock()
+		hooks := b.hooks
+		b.mu.Unlock()
+
+		for _, hook := range hooks {
+			hook(event)
+		}
+	}
+}
+
+// queueForHooks hands an event to the hooks without waiting. If their queue
+// is full the event is dropped.
+func (b *OrderEventBroker) queueForHooks(event models.OrderEvent) {
+	select {
+	case b.queue <- event:
+	default:
+		b.dropped.Add(1)
+		log.Printf("Order event hooks are behind, dropped event %d for order %d", event.ID, event.OrderID)
+	}
+}
+
+// DroppedHookEvents returns how many events have been dropped for the hooks
+// because they were too far behind.
+func (b *OrderEventBroker) DroppedHookEvents() uint64 {
+	return b.dropped.Load()
+}
+
+// Publish sends events to their subscribers and hooks. Nil events are
+// skipped, so callers can pass on whatever recordStatusChange returned.
+func (b *OrderEventBroker) Publish(events ...*models.OrderEvent) {
+	b.mu.Lock()
+	for _, event := range events {
+		if event == nil {
+			continue
+		}
+		for ch, filter := range b.subs {
+			if !filter.matches(event) {
+				continue
+			}
+			select {
+			case ch <- *event:
+			default:
+				delete(b.subs, ch)
+				close(ch)
+			}
+		}
+	}
+	hasHooks := len(b.hooks) > 0
+	b.mu.Unlock()
+
+	if !hasHooks {
+		return
+	}
+	for _, event := range events {
+		if event != nil {
+			b.queueForHooks(*event)
+		}
+	}
+}
+
+// ListStoreEvents returns up to limit events for a store's orders that came
+// after the event with ID after, oldest first.
+func (s *OrderService) ListStoreEvents(storeID, after int64, limit int) ([]models.OrderEvent, error) {
+	return listOrderEvents(s.DB, `o.store_id = $1 AND h.id > $2 ORDER BY h.id LIMIT $3`, storeID, after, limit)
+}
+
+// ListOrderEvents returns an order's events after the event with ID after,
+// oldest first. With after zero that is the order's whole history.
+func (s *OrderService) ListOrderEvents(orderID, after int64) ([]models.OrderEvent, error) {
+	return listOrderEvents(s.DB, `h.order_id = $1 AND h.id > $2 ORDER BY h.id`, orderID, after)
+}
+
+// listOrderEvents reads events from the status history; where is the rest
+// of the query from its WHERE clause on.
+func listOrderEvents(db *sql.DB, where string, args ...interface{}) ([]models.OrderEvent, error) {
+	query := `
+		SELECT h.id, h.order_id, o.store_id, COALESCE(h.from_status, ''), h.to_status, h.created_at
+		FROM order_status_history h
+		JOIN orders o ON o.id = h.order_id
+		WHERE ` + where
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.OrderEvent{}
+	for rows.Next() {
+		var e models.OrderEvent
+		if err := rows.Scan(&e.ID, &e.OrderID, &e.StoreID, &e.FromStatus, &e.Status, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Type = models.OrderEventType(e.FromStatus)
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
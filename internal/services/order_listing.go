@@ -0,0 +1,147 @@
+package services
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/lib/pq"
+)
+
+// Page sizes for ListAllOrders.
+const (
+	DefaultOrderPageSize = 50
+	MaxOrderPageSize     = 200
+)
+
+// OrderFilter picks the orders ListAllOrders returns. Zero values match
+// everything. From and To bound when orders were placed, To exclusive.
+// Cursor is the ID of the last order of the previous page.
+type OrderFilter struct {
+	Statuses  []string
+	OrderType string
+	StoreID   int64
+	UserID    int64
+	From      *time.Time
+	To        *time.Time
+	Cursor    int64
+	Limit     int
+}
+
+// OrderPage is one page of orders, newest first. NextCursor fetches the
+// next page and is zero on the last one.
+type OrderPage struct {
+	Orders     []*models.Order `json:"orders"`
+	NextCursor int64           `json:"next_cursor,omitempty"`
+}
+
+// orderItemsJSON builds an order's items, with their modifiers and bundle
+// components, as a JSON array in the shape of models.OrderItem, so that a
+// page of orders comes back in a single query.
+const orderItemsJSON = `
+	SELECT json_agg(json_build_object(
+		'id', oi.id,
+		'order_id', oi.order_id,
+		'product_id', oi.product_id,
+		'quantity', oi.quantity,
+		'unit_price', oi.unit_price,
+		'tax_category', oi.tax_category,
+		'cancelled_quantity', oi.cancelled_quantity,
+		'components', (
+			SELECT json_agg(json_build_object(
+				'id', c.id,
+				'slot_id', c.slot_id,
+				'slot_name', c.slot_name,
+				'product_id', c.product_id,
+				'product_name', p.name,
+				'quantity', c.quantity,
+				'price_adjustment', c.price_adjustment
+			) ORDER BY c.id)
+			FROM order_item_components c
+			JOIN products p ON p.id = c.product_id
+			WHERE c.order_item_id = oi.id
+		),
+		'modifiers', (
+			SELECT json_agg(json_build_object(
+				'id', m.id,
+				'modifier_id', m.modifier_id,
+				'name', m.name,
+				'price', m.price
+			) ORDER BY m.id)
+			FROM order_item_modifiers m
+			WHERE m.order_item_id = oi.id
+		)
+	) ORDER BY oi.id)
+	FROM order_items oi
+	WHERE oi.order_id = o.id`
+
+// ListAllOrders returns a page of every customer's orders that match
+// filter, newest first, with their items. It is meant for staff, who see
+// the whole queue rather than their own orders.
+func (s *OrderService) ListAllOrders(filter OrderFilter) (*OrderPage, error) {
+	for _, status := range filter.Statuses {
+		if !models.IsOrderStatus(status) {
+			return nil, invalidf("unknown order status %q", status)
+		}
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultOrderPageSize
+	}
+	if filter.Limit > MaxOrderPageSize {
+		filter.Limit = MaxOrderPageSize
+	}
+
+	// One extra row tells whether there is another page
+	query := `
+		SELECT ` + orderColumns + `, COALESCE((` + orderItemsJSON + `), '[]')
+		FROM orders o
+		WHERE (COALESCE(cardinality($1::text[]), 0) = 0 OR o.status = ANY($1))
+			AND ($2 = '' OR o.order_type = $2)
+			AND ($3 = 0 OR o.store_id = $3)
+			AND ($4 = 0 OR o.user_id = $4)
+			AND ($5::timestamp IS NULL OR o.created_at >= $5)
+			AND ($6::timestamp IS NULL OR o.created_at < $6)
+			AND ($7 = 0 OR o.id < $7)
+		ORDER BY o.id DESC
+		LIMIT $8
+	`
+	rows, err := s.DB.Query(query, pq.Array(filter.Statuses), filter.OrderType, filter.StoreID, filter.UserID,
+		filter.From, filter.To, filter.Cursor, filter.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &OrderPage{Orders: []*models.Order{}}
+	for rows.Next() {
+		order := &models.Order{}
+		var items []byte
+		if err := scanOrder(orderRowWithItems{rows, &items}, order); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(items, &order.Items); err != nil {
+			return nil, err
+		}
+		page.Orders = append(page.Orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Orders) > filter.Limit {
+		page.Orders = page.Orders[:filter.Limit]
+		page.NextCursor = page.Orders[filter.Limit-1].ID
+	}
+	return page, nil
+}
+
+// orderRowWithItems lets scanOrder read a row that has the order's items
+// after its columns.
+type orderRowWithItems struct {
+	row   rowScanner
+	items *[]byte
+}
+
+func (r orderRowWithItems) Scan(dest ...interface{}) error {
+	return r.row.Scan(append(dest, r.items)...)
+}
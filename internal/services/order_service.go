@@ -3,121 +3,342 @@ package services
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"log"
+	"time"
 
 	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
 )
 
 type OrderService struct {
-	DB               *sql.DB
-	ProductService   *ProductService
-	LoyaltyService   *LoyaltyService
-	PromotionService *PromotionService
+	DB                 *sql.DB
+	ProductService     *ProductService
+	LoyaltyService     *LoyaltyService
+	PricingService     *PricingService
+	ReservationService *ReservationService
+	PaymentService     *PaymentService
+	Events             *OrderEventBroker
 }
 
-func NewOrderService(db *sql.DB, productService *ProductService, loyaltyService *LoyaltyService, promotionService *PromotionService) *OrderService {
+func NewOrderService(db *sql.DB, productService *ProductService, loyaltyService *LoyaltyService, pricingService *PricingService, reservationService *ReservationService, paymentService *PaymentService, events *OrderEventBroker) *OrderService {
 	return &OrderService{
-		DB:               db,
-		ProductService:   productService,
-		LoyaltyService:   loyaltyService,
-		PromotionService: promotionService,
+		DB:                 db,
+		ProductService:     productService,
+		LoyaltyService:     loyaltyService,
+		PricingService:     pricingService,
+		ReservationService: reservationService,
+		PaymentService:     paymentService,
+		Events:             events,
 	}
 }
 
-func (s *OrderService) CreateOrder(order *models.Order, promotionCode string) error {
+// orderColumns lists the orders columns in the order scanOrder reads them.
+const orderColumns = `id, user_id, store_id, status, order_type, delivery_address, COALESCE(delivery_postcode, ''),
+	delivery_latitude, delivery_longitude, delivery_zone_id, delivery_eta_minutes, COALESCE(promotion_code, ''),
+	scheduled_for, subtotal, discount_amount, delivery_fee, tax_amount, tax_included, total_amount, tip_amount, tip_percent,
+	version, created_at, updated_at`
+
+func scanOrder(row rowScanner, order *models.Order) error {
+	var lat, lng sql.NullFloat64
+	err := row.Scan(
+		&order.ID, &order.UserID, &order.StoreID, &order.Status, &order.OrderType, &order.DeliveryAddress,
+		&order.DeliveryPostcode, &lat, &lng, &order.DeliveryZoneID, &order.DeliveryETAMinutes, &order.PromotionCode,
+		&order.ScheduledFor, &order.Subtotal, &order.DiscountAmount, &order.DeliveryFee, &order.TaxAmount,
+		&order.TaxIncluded, &order.TotalAmount, &order.TipAmount, &order.TipPercent, &order.Version, &order.CreatedAt, &order.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	order.DeliveryLocation = geoPoint(lat, lng)
+	return nil
+}
+
+// geoPoint builds a location from nullable latitude and longitude columns.
+func geoPoint(lat, lng sql.NullFloat64) *models.GeoPoint {
+	if !lat.Valid || !lng.Valid {
+		return nil
+	}
+	return &models.GeoPoint{Lat: lat.Float64, Lng: lng.Float64}
+}
+
+// geoColumns splits a location into nullable latitude and longitude columns.
+func geoColumns(p *models.GeoPoint) (lat, lng sql.NullFloat64) {
+	if p == nil {
+		return lat, lng
+	}
+	return sql.NullFloat64{Float64: p.Lat, Valid: true}, sql.NullFloat64{Float64: p.Lng, Valid: true}
+}
+
+// QuoteOrder prices an order the way CreateOrder would without placing it.
+func (s *OrderService) QuoteOrder(order *models.Order) error {
+	return s.PricingService.PriceOrder(order)
+}
+
+// CreateOrder places an order. Prices come from the catalog, never from the
+// client, and the pricing breakdown is stored with the order. A scheduled
+// order takes a place in its time slot, and its items must be available at
+// the scheduled time rather than now.
+func (s *OrderService) CreateOrder(order *models.Order) error {
+	return s.createOrder(order, nil)
+}
+
+// createOrder is CreateOrder with a hook that runs in the order's
+// transaction once the order has been saved. The order is only placed if
+// the hook succeeds.
+func (s *OrderService) createOrder(order *models.Order, placed func(tx *sql.Tx) error) error {
+	if err := s.PricingService.PriceOrder(order); err != nil {
+		return err
+	}
+
+	// Reject seasonal or daypart items, or bundle components, ordered
+	// outside their windows
+	at := time.Now()
+	if order.ScheduledFor != nil {
+		at = *order.ScheduledFor
+	}
+	for _, item := range order.Items {
+		productIDs := []int64{item.ProductID}
+		for _, c := range item.Components {
+			productIDs = append(productIDs, c.ProductID)
+		}
+		for _, productID := range productIDs {
+			available, err := s.ProductService.IsAvailable(order.StoreID, productID, at)
+			if err != nil {
+				return err
+			}
+			if !available {
+				return invalidf("product %d is not available at this time", productID)
+			}
+		}
+	}
+
 	tx, err := s.DB.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Check and update stock for each item
-	for _, item := range order.Items {
-		err := s.ProductService.UpdateStock(tx, item.ProductID, item.Quantity)
-		if err != nil {
+	if order.ScheduledFor != nil {
+		if err := reserveSlot(tx, order.StoreID, *order.ScheduledFor); err != nil {
 			return err
 		}
 	}
 
-	// Apply promotion if a code is provided
-	if promotionCode != "" {
-		discountAmount, err := s.PromotionService.ApplyPromotion(promotionCode, order.TotalAmount)
+	// Insert order. Every order starts out pending; staff move it along.
+	order.Status = models.OrderPending
+	query := `INSERT INTO orders (user_id, store_id, status, order_type, delivery_address, delivery_postcode,
+                  delivery_latitude, delivery_longitude, delivery_zone_id, delivery_eta_minutes, promotion_code,
+                  scheduled_for, subtotal, discount_amount, delivery_fee, tax_amount, tax_included, total_amount,
+                  tip_amount, tip_percent)
+              VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10, NULLIF($11, ''), $12, $13, $14, $15, $16, $17, $18,
+                  $19, $20)
+              RETURNING id, version, created_at, updated_at`
+
+	lat, lng := geoColumns(order.DeliveryLocation)
+	err = tx.QueryRow(query, order.UserID, order.StoreID, order.Status, order.OrderType, order.DeliveryAddress,
+		models.NormalizePostcode(order.DeliveryPostcode), lat, lng, order.DeliveryZoneID, order.DeliveryETAMinutes,
+		order.PromotionCode, order.ScheduledFor, order.Subtotal, order.DiscountAmount, order.DeliveryFee, order.TaxAmount,
+		order.TaxIncluded, order.TotalAmount, order.TipAmount, order.TipPercent).
+		Scan(&order.ID, &order.Version, &order.CreatedAt, &order.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	event, err := recordStatusChange(tx, order.ID, "", order.Status, order.UserID, models.RoleCustomer)
+	if err != nil {
+		return err
+	}
+
+	if err := saveTaxLines(tx, order.ID, order.TaxLines); err != nil {
+		return err
+	}
+
+	// Take a use of the promotion code
+	if order.PromotionCode != "" {
+		err := redeemPromotion(tx, order.PromotionCode, order.ID, order.UserID, order.DiscountAmount)
 		if err != nil {
 			return err
 		}
-		order.TotalAmount -= discountAmount
 	}
 
-	// Insert order
-	query := `INSERT INTO orders (user_id, total_amount, status, order_type, delivery_address) 
-              VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at`
+	// Consume the customer's reservation, if they checked out against one
+	if order.ReservationID != 0 {
+		err = s.ReservationService.ConvertReservation(tx, order.ReservationID, order.UserID, order.StoreID, order.ID)
+		if err != nil {
+			return err
+		}
+	}
 
-	err = tx.QueryRow(query, order.UserID, order.TotalAmount, order.Status, order.OrderType, order.DeliveryAddress).
-		Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt)
-	if err != nil {
-		return err
+	// Check and update stock for each item. Bundles have no stock of their
+	// own and take it from their components.
+	for _, item := range order.Items {
+		stock := []models.OrderItemComponent{{ProductID: item.ProductID, Quantity: item.Quantity}}
+		if len(item.Components) > 0 {
+			stock = item.Components
+		}
+		for _, c := range stock {
+			err := s.ProductService.UpdateStock(tx, StockChange{
+				StoreID:       order.StoreID,
+				ProductID:     c.ProductID,
+				Quantity:      c.Quantity,
+				Reason:        models.MovementSale,
+				ActorID:       order.UserID,
+				OrderID:       order.ID,
+				ReservationID: order.ReservationID,
+			})
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	// Insert order items
 	for i := range order.Items {
-		query := `INSERT INTO order_items (order_id, product_id, quantity, unit_price) 
-                  VALUES ($1, $2, $3, $4) RETURNING id`
-		err = tx.QueryRow(query, order.ID, order.Items[i].ProductID, order.Items[i].Quantity, order.Items[i].UnitPrice).
+		query := `INSERT INTO order_items (order_id, product_id, quantity, unit_price, tax_category) 
+                  VALUES ($1, $2, $3, $4, $5) RETURNING id`
+		err = tx.QueryRow(query, order.ID, order.Items[i].ProductID, order.Items[i].Quantity, order.Items[i].UnitPrice,
+			order.Items[i].TaxCategory).
 			Scan(&order.Items[i].ID)
 		if err != nil {
 			return err
 		}
+
+		for j := range order.Items[i].Components {
+			c := &order.Items[i].Components[j]
+			query := `INSERT INTO order_item_components (order_item_id, slot_id, slot_name, product_id, quantity, price_adjustment)
+                      VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+			err := tx.QueryRow(query, order.Items[i].ID, c.SlotID, c.SlotName, c.ProductID, c.Quantity, c.PriceAdjustment).
+				Scan(&c.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		for j := range order.Items[i].Modifiers {
+			m := &order.Items[i].Modifiers[j]
+			query := `INSERT INTO order_item_modifiers (order_item_id, modifier_id, name, price)
+                      VALUES ($1, $2, $3, $4) RETURNING id`
+			if err := tx.QueryRow(query, order.Items[i].ID, m.ModifierID, m.Name, m.Price).Scan(&m.ID); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Calculate and add loyalty points (1 point per $1 spent)
-	loyaltyPoints := int(order.TotalAmount)
-	err = s.LoyaltyService.AddLoyaltyPoints(order.UserID, order.ID, loyaltyPoints)
-	if err != nil {
+	if placed != nil {
+		if err := placed(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return err
 	}
+	s.Events.Publish(event)
 
-	return tx.Commit()
+	// Deliver any low-stock alerts raised by this order
+	s.ProductService.InventoryService.QueueDispatch()
+
+	return nil
 }
 
 func (s *OrderService) GetOrder(id int64) (*models.Order, error) {
 	order := &models.Order{}
-	query := `SELECT id, user_id, total_amount, status, order_type, delivery_address, created_at, updated_at 
-              FROM orders WHERE id = $1`
-
-	err := s.DB.QueryRow(query, id).Scan(
-		&order.ID, &order.UserID, &order.TotalAmount, &order.Status,
-		&order.OrderType, &order.DeliveryAddress, &order.CreatedAt, &order.UpdatedAt,
-	)
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1`
 
+	err := scanOrder(s.DB.QueryRow(query, id), order)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("order not found")
+			return nil, notFound("order")
 		}
 		return nil, err
 	}
 
 	// Get order items
-	itemsQuery := `SELECT id, product_id, quantity, unit_price FROM order_items WHERE order_id = $1`
+	itemsQuery := `SELECT id, product_id, quantity, unit_price, tax_category, cancelled_quantity FROM order_items WHERE order_id = $1`
 	rows, err := s.DB.Query(itemsQuery, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	itemIndex := make(map[int64]int)
 	for rows.Next() {
 		var item models.OrderItem
-		err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &item.UnitPrice)
+		err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &item.UnitPrice, &item.TaxCategory, &item.CancelledQuantity)
 		if err != nil {
 			return nil, err
 		}
+		itemIndex[item.ID] = len(order.Items)
 		order.Items = append(order.Items, item)
 	}
 
+	// Get the components of any bundles
+	componentsQuery := `
+		SELECT c.id, c.order_item_id, c.slot_id, c.slot_name, c.product_id, p.name, c.quantity, c.price_adjustment
+		FROM order_item_components c
+		JOIN order_items oi ON oi.id = c.order_item_id
+		JOIN products p ON p.id = c.product_id
+		WHERE oi.order_id = $1
+		ORDER BY c.id
+	`
+	components, err := s.DB.Query(componentsQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer components.Close()
+
+	for components.Next() {
+		var c models.OrderItemComponent
+		var itemID int64
+		err := components.Scan(&c.ID, &itemID, &c.SlotID, &c.SlotName, &c.ProductID, &c.ProductName, &c.Quantity, &c.PriceAdjustment)
+		if err != nil {
+			return nil, err
+		}
+		i := itemIndex[itemID]
+		order.Items[i].Components = append(order.Items[i].Components, c)
+	}
+
+	// Get the modifiers added to each item
+	modifiersQuery := `
+		SELECT m.id, m.order_item_id, m.modifier_id, m.name, m.price
+		FROM order_item_modifiers m
+		JOIN order_items oi ON oi.id = m.order_item_id
+		WHERE oi.order_id = $1
+		ORDER BY m.id
+	`
+	modifiers, err := s.DB.Query(modifiersQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer modifiers.Close()
+
+	for modifiers.Next() {
+		var m models.OrderItemModifier
+		var itemID int64
+		if err := modifiers.Scan(&m.ID, &itemID, &m.ModifierID, &m.Name, &m.Price); err != nil {
+			return nil, err
+		}
+		i := itemIndex[itemID]
+		order.Items[i].Modifiers = append(order.Items[i].Modifiers, m)
+	}
+
+	order.TaxLines, err = getTaxLines(s.DB, id)
+	if err != nil {
+		return nil, err
+	}
+
+	order.Refunds, err = s.getRefunds(id)
+	if err != nil {
+		return nil, err
+	}
+
 	return order, nil
 }
 
 func (s *OrderService) ListOrders(userID int64) ([]*models.Order, error) {
-	query := `SELECT id, user_id, total_amount, status, order_type, delivery_address, created_at, updated_at 
-              FROM orders WHERE user_id = $1 ORDER BY created_at DESC`
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE user_id = $1 ORDER BY created_at DESC`
 
 	rows, err := s.DB.Query(query, userID)
 	if err != nil {
@@ -128,11 +349,7 @@ func (s *OrderService) ListOrders(userID int64) ([]*models.Order, error) {
 	var orders []*models.Order
 	for rows.Next() {
 		order := &models.Order{}
-		err := rows.Scan(
-			&order.ID, &order.UserID, &order.TotalAmount, &order.Status,
-			&order.OrderType, &order.DeliveryAddress, &order.CreatedAt, &order.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanOrder(rows, order); err != nil {
 			return nil, err
 		}
 		orders = append(orders, order)
@@ -141,47 +358,494 @@ func (s *OrderService) ListOrders(userID int64) ([]*models.Order, error) {
 	return orders, nil
 }
 
-func (s *OrderService) UpdateOrderStatus(id int64, status string) error {
-	query := `UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
-	_, err := s.DB.Exec(query, status, id)
+// UpdateOrderStatus moves an order through its lifecycle on behalf of
+// actorID acting as role, and returns the order's new version. The move must
+// be one the lifecycle allows for that role (ErrInvalidTransition or
+// ErrForbidden otherwise), and customers may only act on their own orders.
+// If expectedVersion is non-zero it must match the stored version.
+//
+// An order is only confirmed once its payment is authorized, and a scheduled
+// order waits in the queue until its prep window opens. Side effects
+// run in the same transaction: cancelling undoes the order (see
+// cancelOrder), completing credits loyalty points and refunding takes them
+// back and records a refund. Money then moves through the order's payment
+// once the change is committed (see settlePayment).
+func (s *OrderService) UpdateOrderStatus(id int64, status string, actorID int64, role string, expectedVersion int) (int, error) {
+	if !models.IsOrderStatus(status) {
+		return 0, fmt.Errorf("%w: unknown order status %q", ErrInvalidTransition, status)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID, storeID int64
+	var current string
+	var spent money.Money
+	var version int
+	query := `SELECT user_id, store_id, status, subtotal - discount_amount, version FROM orders WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRow(query, id).Scan(&userID, &storeID, &current, &spent, &version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, notFound("order")
+		}
+		return 0, err
+	}
+	if role == models.RoleCustomer && userID != actorID {
+		return 0, notFound("order")
+	}
+	if expectedVersion != 0 && version != expectedVersion {
+		return 0, ErrVersionConflict
+	}
+
+	if err := checkOrderTransition(current, status, role); err != nil {
+		return 0, err
+	}
+
+	switch status {
+	case models.OrderConfirmed:
+		paid, err := orderIsPaid(tx, id)
+		if err != nil {
+			return 0, err
+		}
+		if !paid {
+			return 0, fmt.Errorf("%w: order has no authorized payment", ErrInvalidTransition)
+		}
+	case models.OrderPreparing:
+		startsAt, err := prepStartsAt(tx, id)
+		if err != nil {
+			return 0, err
+		}
+		if startsAt != nil && time.Now().Before(*startsAt) {
+			return 0, fmt.Errorf("%w: order is scheduled; preparation opens at %s",
+				ErrInvalidTransition, startsAt.Format(time.RFC3339))
+		}
+	case models.OrderCancelled:
+		if err := s.cancelOrder(tx, id, userID, storeID, actorID); err != nil {
+			return 0, err
+		}
+	case models.OrderCompleted:
+		// Orders placed before points moved to completion were credited
+		// when they were created
+		earned, err := orderPointsEarned(tx, userID, id)
+		if err != nil {
+			return 0, err
+		}
+		if earned > 0 {
+			break
+		}
+		// 1 point per whole $1 spent on items, not on tax or fees
+		if err := s.LoyaltyService.addLoyaltyPoints(tx, userID, id, loyaltyPointsFor(spent)); err != nil {
+			return 0, err
+		}
+	case models.OrderRefunded:
+		if err := s.LoyaltyService.reverseOrderPoints(tx, userID, id); err != nil {
+			return 0, err
+		}
+		if err := refundRemaining(tx, id, "Order refunded", actorID); err != nil {
+			return 0, err
+		}
+	}
+
+	query = `UPDATE orders SET status = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP
+              WHERE id = $2 RETURNING version`
+	if err := tx.QueryRow(query, status, id).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	event, err := recordStatusChange(tx, id, current, status, actorID, role)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	s.Events.Publish(event)
+
+	s.settlePayment(id, status)
+	return version, nil
+}
+
+// settlePayment moves money to match an order's new status: a completed
+// order's payment is captured, and refunds from cancelling or refunding are
+// paid back. It runs after the status change is committed, so a failure is
+// logged and can be retried through PaymentService without undoing the
+// change.
+func (s *OrderService) settlePayment(orderID int64, status string) {
+	var err error
+	switch status {
+	case models.OrderCompleted:
+		_, err = s.PaymentService.CaptureOrder(orderID)
+	case models.OrderCancelled, models.OrderRefunded:
+		err = s.PaymentService.SettleRefunds(orderID)
+	}
+	if err != nil {
+		log.Printf("Failed to settle payment for order %d: %v", orderID, err)
+	}
+}
+
+// checkOrderTransition reports whether role may move an order from current
+// to status.
+func checkOrderTransition(current, status, role string) error {
+	if !models.IsOrderTransition(current, status) {
+		return fmt.Errorf("%w: order is %s and cannot become %s", ErrInvalidTransition, current, status)
+	}
+	if !models.CanTransitionOrder(current, status, role) {
+		return fmt.Errorf("%w: cannot move an order from %s to %s", ErrForbidden, current, status)
+	}
+	return nil
+}
+
+// CancelOrder cancels an order and undoes its side effects.
+func (s *OrderService) CancelOrder(orderID, actorID int64, role string) error {
+	_, err := s.UpdateOrderStatus(orderID, models.OrderCancelled, actorID, role, 0)
 	return err
 }
 
-func (s *OrderService) CancelOrder(orderID int64) error {
+// cancelOrder undoes an order inside the transaction that cancels it: stock
+// goes back, loyalty points earned on it are taken back and points spent on
+// it are returned, its promotion code is released, and whatever has not
+// already been refunded is.
+func (s *OrderService) cancelOrder(tx *sql.Tx, orderID, userID, storeID, actorID int64) error {
+	if err := s.restockOrder(tx, orderID, storeID, actorID); err != nil {
+		return err
+	}
+	if err := s.LoyaltyService.reverseOrderPoints(tx, userID, orderID); err != nil {
+		return err
+	}
+	if err := s.LoyaltyService.restoreRedeemedPoints(tx, orderID); err != nil {
+		return err
+	}
+	if err := releasePromotionRedemption(tx, orderID); err != nil {
+		return err
+	}
+	return refundRemaining(tx, orderID, "Order cancelled", actorID)
+}
+
+// CancelOrderItem cancels quantity of one line of an order, or all that is
+// left of it when quantity is zero, on behalf of actorID acting as role.
+// Whoever may cancel the whole order at its current status may cancel a
+// line. The line's stock goes back, and its price with its share of the
+// discount and tax comes off the order and is recorded as a refund.
+// Cancelling the last open line cancels the order.
+func (s *OrderService) CancelOrderItem(orderID, itemID int64, quantity int, actorID int64, role string) (*models.Refund, error) {
+	if quantity < 0 {
+		return nil, errors.New("quantity cannot be negative")
+	}
+
 	tx, err := s.DB.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
-	// Get order items
-	query := `SELECT product_id, quantity FROM order_items WHERE order_id = $1`
-	rows, err := tx.Query(query, orderID)
+	var userID, storeID int64
+	var current string
+	var pricing models.OrderPricing
+	query := `SELECT user_id, store_id, status, subtotal, discount_amount, tax_included FROM orders WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRow(query, orderID).Scan(&userID, &storeID, &current, &pricing.Subtotal, &pricing.DiscountAmount, &pricing.TaxIncluded)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("order")
+		}
+		return nil, err
+	}
+	if role == models.RoleCustomer && userID != actorID {
+		return nil, notFound("order")
+	}
+	if err := checkOrderTransition(current, models.OrderCancelled, role); err != nil {
+		return nil, err
+	}
+
+	var productID int64
+	var ordered, cancelled int
+	var unitPrice money.Money
+	var taxCategory string
+	query = `SELECT product_id, quantity, cancelled_quantity, unit_price, tax_category FROM order_items
+             WHERE id = $1 AND order_id = $2 FOR UPDATE`
+	err = tx.QueryRow(query, itemID, orderID).Scan(&productID, &ordered, &cancelled, &unitPrice, &taxCategory)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("order item")
+		}
+		return nil, err
+	}
+	remaining := ordered - cancelled
+	if remaining == 0 {
+		return nil, fmt.Errorf("%w: item %d is already cancelled", ErrInvalidTransition, itemID)
+	}
+	if quantity == 0 {
+		quantity = remaining
+	}
+	if quantity > remaining {
+		return nil, fmt.Errorf("%w: only %d of item %d left to cancel", ErrInvalidTransition, remaining, itemID)
+	}
+
+	// Put the stock back: the line's product, or its components for bundles
+	stock, err := itemStock(tx, itemID, productID, ordered, quantity)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range stock {
+		err := s.ProductService.RestockProduct(tx, StockChange{
+			StoreID:   storeID,
+			ProductID: c.ProductID,
+			Quantity:  c.Quantity,
+			Reason:    models.MovementCancellation,
+			ActorID:   actorID,
+			OrderID:   orderID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The line takes its share of the discount and tax off the order with
+	// it. Tax already included in the price is refunded as part of it.
+	lineAmount := unitPrice.Mul(int64(quantity))
+	var discountShare money.Money
+	if pricing.Subtotal.IsPositive() {
+		discountShare = pricing.DiscountAmount.MulRate(lineAmount.Minor, pricing.Subtotal.Minor, discountRounding)
+	}
+	taxShare, err := cancelTaxableAmount(tx, orderID, taxCategory, lineAmount.Sub(discountShare))
+	if err != nil {
+		return nil, err
+	}
+	amount := lineAmount.Sub(discountShare)
+	if !pricing.TaxIncluded {
+		amount = amount.Add(taxShare)
+	}
+	refund := &models.Refund{
+		OrderID:     orderID,
+		OrderItemID: &itemID,
+		Amount:      amount,
+		Reason:      fmt.Sprintf("Cancelled %d of item %d", quantity, itemID),
+		CreatedBy:   actorID,
+	}
+
+	query = `
+		UPDATE orders
+		SET subtotal = subtotal - $1, discount_amount = discount_amount - $2, tax_amount = tax_amount - $3,
+			total_amount = total_amount - $4, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+	`
+	if _, err := tx.Exec(query, lineAmount, discountShare, taxShare, refund.Amount, orderID); err != nil {
+		return nil, err
+	}
+	query = `UPDATE order_items SET cancelled_quantity = cancelled_quantity + $1 WHERE id = $2`
+	if _, err := tx.Exec(query, quantity, itemID); err != nil {
+		return nil, err
+	}
+	if err := recordRefund(tx, refund); err != nil {
+		return nil, err
+	}
+
+	var open bool
+	query = `SELECT EXISTS (SELECT 1 FROM order_items WHERE order_id = $1 AND cancelled_quantity < quantity)`
+	if err := tx.QueryRow(query, orderID).Scan(&open); err != nil {
+		return nil, err
+	}
+	var event *models.OrderEvent
+	if !open {
+		if err := s.cancelOrder(tx, orderID, userID, storeID, actorID); err != nil {
+			return nil, err
+		}
+		query := `UPDATE orders SET status = $1 WHERE id = $2`
+		if _, err := tx.Exec(query, models.OrderCancelled, orderID); err != nil {
+			return nil, err
+		}
+		event, err = recordStatusChange(tx, orderID, current, models.OrderCancelled, actorID, role)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.Events.Publish(event)
+
+	s.settlePayment(orderID, models.OrderCancelled)
+	return refund, nil
+}
+
+// itemStock returns the stock taken by quantity of an order line: the line's
+// product, or for bundles its components in proportion.
+func itemStock(tx *sql.Tx, itemID, productID int64, ordered, quantity int) ([]models.OrderItemComponent, error) {
+	rows, err := tx.Query(`SELECT product_id, quantity FROM order_item_components WHERE order_item_id = $1`, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stock []models.OrderItemComponent
+	for rows.Next() {
+		var c models.OrderItemComponent
+		if err := rows.Scan(&c.ProductID, &c.Quantity); err != nil {
+			return nil, err
+		}
+		// Component quantities are per line, so scale them to what is cancelled
+		c.Quantity = c.Quantity / ordered * quantity
+		stock = append(stock, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(stock) == 0 {
+		stock = []models.OrderItemComponent{{ProductID: productID, Quantity: quantity}}
+	}
+	return stock, nil
+}
+
+// recordRefund saves a refund inside the caller's transaction.
+func recordRefund(tx *sql.Tx, refund *models.Refund) error {
+	query := `
+		INSERT INTO refunds (order_id, order_item_id, amount, reason, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0))
+		RETURNING id, created_at
+	`
+	return tx.QueryRow(query, refund.OrderID, refund.OrderItemID, refund.Amount, refund.Reason, refund.CreatedBy).
+		Scan(&refund.ID, &refund.CreatedAt)
+}
+
+// refundRemaining refunds whatever of an order's total and tip has not been
+// refunded yet. Line refunds already came off the total when the line was
+// cancelled, so only whole-order refunds count against it.
+func refundRemaining(tx *sql.Tx, orderID int64, reason string, actorID int64) error {
+	var remaining money.Money
+	query := `
+		SELECT o.total_amount + o.tip_amount - COALESCE((SELECT SUM(r.amount) FROM refunds r WHERE r.order_id = o.id AND r.order_item_id IS NULL), 0)
+		FROM orders o WHERE o.id = $1
+	`
+	if err := tx.QueryRow(query, orderID).Scan(&remaining); err != nil {
 		return err
 	}
+	if !remaining.IsPositive() {
+		return nil
+	}
+
+	return recordRefund(tx, &models.Refund{OrderID: orderID, Amount: remaining, Reason: reason, CreatedBy: actorID})
+}
+
+func (s *OrderService) getRefunds(orderID int64) ([]models.Refund, error) {
+	query := `
+		SELECT id, order_id, order_item_id, amount, COALESCE(reason, ''), COALESCE(created_by, 0), created_at,
+			payment_id, COALESCE(provider_reference, ''), settled_at
+		FROM refunds WHERE order_id = $1 ORDER BY id
+	`
+	rows, err := s.DB.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	// Restock items
+	var refunds []models.Refund
 	for rows.Next() {
-		var productID int64
-		var quantity int
-		err := rows.Scan(&productID, &quantity)
+		var r models.Refund
+		err := rows.Scan(&r.ID, &r.OrderID, &r.OrderItemID, &r.Amount, &r.Reason, &r.CreatedBy, &r.CreatedAt,
+			&r.PaymentID, &r.ProviderReference, &r.SettledAt)
 		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, r)
+	}
+
+	return refunds, rows.Err()
+}
+
+// restockOrder returns the stock an order took to its store, leaving out
+// lines that were already cancelled and restocked.
+func (s *OrderService) restockOrder(tx *sql.Tx, orderID, storeID, actorID int64) error {
+	// Get the stock the order took: its items, or their components for bundles
+	query := `
+		SELECT oi.product_id, oi.quantity - oi.cancelled_quantity FROM order_items oi
+		WHERE oi.order_id = $1 AND oi.cancelled_quantity < oi.quantity
+			AND NOT EXISTS (SELECT 1 FROM order_item_components c WHERE c.order_item_id = oi.id)
+		UNION ALL
+		SELECT c.product_id, c.quantity / oi.quantity * (oi.quantity - oi.cancelled_quantity) FROM order_item_components c
+		JOIN order_items oi ON oi.id = c.order_item_id
+		WHERE oi.order_id = $1 AND oi.cancelled_quantity < oi.quantity
+	`
+	rows, err := tx.Query(query, orderID)
+	if err != nil {
+		return err
+	}
+
+	var items []models.OrderItem
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			rows.Close()
 			return err
 		}
-		err = s.ProductService.RestockProduct(productID, quantity)
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Restock items
+	for _, item := range items {
+		err = s.ProductService.RestockProduct(tx, StockChange{
+			StoreID:   storeID,
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Reason:    models.MovementCancellation,
+			ActorID:   actorID,
+			OrderID:   orderID,
+		})
 		if err != nil {
 			return err
 		}
 	}
 
-	// Update order status to cancelled
-	query = `UPDATE orders SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP WHERE id = $1`
-	_, err = tx.Exec(query, orderID)
+	return nil
+}
+
+// recordStatusChange adds a change to an order's status history and returns
+// it as an event, to be published once the transaction is committed.
+func recordStatusChange(tx *sql.Tx, orderID int64, from, to string, actorID int64, role string) (*models.OrderEvent, error) {
+	event := &models.OrderEvent{Type: models.OrderEventType(from), OrderID: orderID, FromStatus: from, Status: to}
+	query := `
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor_id, actor_role)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, 0), NULLIF($5, ''))
+		RETURNING id, created_at, (SELECT store_id FROM orders WHERE id = $1)
+	`
+	err := tx.QueryRow(query, orderID, from, to, actorID, role).Scan(&event.ID, &event.CreatedAt, &event.StoreID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return event, nil
+}
+
+// GetStatusHistory returns an order's status changes oldest first.
+func (s *OrderService) GetStatusHistory(orderID int64) ([]models.OrderStatusChange, error) {
+	query := `
+		SELECT id, order_id, COALESCE(from_status, ''), to_status, actor_id, COALESCE(actor_role, ''), created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY id
+	`
+	rows, err := s.DB.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.OrderStatusChange
+	for rows.Next() {
+		var c models.OrderStatusChange
+		err := rows.Scan(&c.ID, &c.OrderID, &c.FromStatus, &c.ToStatus, &c.ActorID, &c.ActorRole, &c.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, c)
 	}
 
-	return tx.Commit()
+	return history, rows.Err()
 }
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// FieldErrors maps JSON field names to what is wrong with them. It is
+// returned when a merge patch fails validation.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	msgs := make([]string, len(fields))
+	for i, field := range fields {
+		msgs[i] = field + ": " + e[field]
+	}
+	return "invalid patch: " + strings.Join(msgs, "; ")
+}
+
+// patchField ties a JSON field to its column. apply decodes the patch value,
+// validates it, stores it on the model being patched and returns the value
+// to write to the column.
+type patchField struct {
+	column string
+	apply  func(raw json.RawMessage) (interface{}, error)
+}
+
+// readOnlyPatchFields may appear in a resource but cannot be patched.
+var readOnlyPatchFields = map[string]bool{
+	"id": true, "version": true, "created_at": true, "updated_at": true,
+	"stock_quantity": true,
+}
+
+// applyMergePatch applies an RFC 7386 merge patch to a flat resource and
+// returns the columns it touched with their new values, in a stable order.
+func applyMergePatch(patch map[string]json.RawMessage, fields map[string]patchField) ([]string, []interface{}, error) {
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var columns []string
+	var values []interface{}
+	fieldErrors := FieldErrors{}
+	for _, key := range keys {
+		field, ok := fields[key]
+		if !ok {
+			if readOnlyPatchFields[key] {
+				fieldErrors[key] = "is read-only"
+			} else {
+				fieldErrors[key] = "is not a known field"
+			}
+			continue
+		}
+
+		value, err := field.apply(patch[key])
+		if err != nil {
+			fieldErrors[key] = err.Error()
+			continue
+		}
+		columns = append(columns, field.column)
+		values = append(values, value)
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, nil, fieldErrors
+	}
+	return columns, values, nil
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// patchString decodes a string member. When nullable, null clears it to "".
+func patchString(raw json.RawMessage, nullable bool) (string, error) {
+	if isJSONNull(raw) {
+		if nullable {
+			return "", nil
+		}
+		return "", errors.New("cannot be null")
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", errors.New("must be a string")
+	}
+	return v, nil
+}
+
+func patchRequiredString(raw json.RawMessage) (string, error) {
+	v, err := patchString(raw, false)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(v) == "" {
+		return "", errors.New("cannot be empty")
+	}
+	return v, nil
+}
+
+func patchFloat(raw json.RawMessage, min, max float64) (float64, error) {
+	if isJSONNull(raw) {
+		return 0, errors.New("cannot be null")
+	}
+	var v float64
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0, errors.New("must be a number")
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("must be between %g and %g", min, max)
+	}
+	return v, nil
+}
+
+func patchMoney(raw json.RawMessage) (money.Money, error) {
+	if isJSONNull(raw) {
+		return money.Money{}, errors.New("cannot be null")
+	}
+	var v money.Money
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return money.Money{}, errors.New("must be an amount such as 4.50")
+	}
+	if v.IsNegative() {
+		return money.Money{}, errors.New("cannot be negative")
+	}
+	return v, nil
+}
+
+// patchOptionalID decodes a reference to another row. null clears it.
+func patchOptionalID(raw json.RawMessage) (*int64, error) {
+	if isJSONNull(raw) {
+		return nil, nil
+	}
+	var v int64
+	if err := json.Unmarshal(raw, &v); err != nil || v <= 0 {
+		return nil, errors.New("must be a positive integer or null")
+	}
+	return &v, nil
+}
+
+// patchOptionalLimit decodes a positive limit. null removes the limit.
+func patchOptionalLimit(raw json.RawMessage) (*int, error) {
+	if isJSONNull(raw) {
+		return nil, nil
+	}
+	var v int
+	if err := json.Unmarshal(raw, &v); err != nil || v <= 0 {
+		return nil, errors.New("must be a positive integer or null")
+	}
+	return &v, nil
+}
+
+func patchNonNegativeInt(raw json.RawMessage) (int, error) {
+	if isJSONNull(raw) {
+		return 0, errors.New("cannot be null")
+	}
+	var v int
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0, errors.New("must be an integer")
+	}
+	if v < 0 {
+		return 0, errors.New("cannot be negative")
+	}
+	return v, nil
+}
+
+func patchBool(raw json.RawMessage) (bool, error) {
+	if isJSONNull(raw) {
+		return false, errors.New("cannot be null")
+	}
+	var v bool
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return false, errors.New("must be a boolean")
+	}
+	return v, nil
+}
+
+// patchTime accepts RFC 3339 timestamps or plain YYYY-MM-DD dates.
+func patchTime(raw json.RawMessage) (time.Time, error) {
+	v, err := patchRequiredString(raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.New("must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+}
+
+// updateColumnsQuery builds an UPDATE that sets only the given columns, bumps
+// the row version and returns the row's columns. The id is the last argument.
+func updateColumnsQuery(table string, columns []string, returning string) string {
+	sets := make([]string, 0, len(columns)+2)
+	for i, column := range columns {
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, i+1))
+	}
+	sets = append(sets, "version = version + 1", "updated_at = CURRENT_TIMESTAMP")
+
+	return fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d RETURNING %s",
+		table, strings.Join(sets, ", "), len(columns)+1, returning)
+}
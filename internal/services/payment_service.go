@@ -0,0 +1,470 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/internal/payments"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// ErrPaymentDeclined is returned when the provider turns a payment down.
+var ErrPaymentDeclined = errors.New("payment declined")
+
+// paymentColumns lists the payments columns in the order scanPayment reads them.
+const paymentColumns = `id, order_id, provider, COALESCE(provider_reference, ''), status, amount,
+	captured_amount, refunded_amount, COALESCE(decline_reason, ''), created_at, updated_at`
+
+func scanPayment(row rowScanner, payment *models.Payment) error {
+	return row.Scan(
+		&payment.ID, &payment.OrderID, &payment.Provider, &payment.ProviderReference, &payment.Status, &payment.Amount,
+		&payment.CapturedAmount, &payment.RefundedAmount, &payment.DeclineReason, &payment.CreatedAt, &payment.UpdatedAt,
+	)
+}
+
+// PaymentService takes payment for orders through a payments.Provider and
+// keeps a record of each payment. Orders it confirms are published to
+// Events.
+type PaymentService struct {
+	DB       *sql.DB
+	Provider payments.Provider
+	Events   *OrderEventBroker
+}
+
+func NewPaymentService(db *sql.DB, provider payments.Provider, events *OrderEventBroker) *PaymentService {
+	return &PaymentService{DB: db, Provider: provider, Events: events}
+}
+
+// AuthorizeOrder asks the provider to hold a pending order's total and tip
+// on the customer's payment method. A successful authorization confirms the
+// order. If the provider answers later, the payment stays pending until its
+// webhook arrives. A declined payment is recorded and ErrPaymentDeclined returned
+// with it, so the customer can try again with another method. A hold taken
+// after the order was cancelled is voided again.
+func (s *PaymentService) AuthorizeOrder(orderID, actorID int64, role, token string) (*models.Payment, error) {
+	// Record the attempt first so two attempts cannot both reach the provider
+	payment := &models.Payment{OrderID: orderID, Provider: s.Provider.Name(), Status: models.PaymentPending}
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	var status string
+	query := `SELECT user_id, status, total_amount + tip_amount FROM orders WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRow(query, orderID).Scan(&userID, &status, &payment.Amount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("order")
+		}
+		return nil, err
+	}
+	// Only staff and admins may pay for someone else's order
+	if role != models.RoleStaff && role != models.RoleAdmin && userID != actorID {
+		return nil, notFound("order")
+	}
+	if status != models.OrderPending {
+		return nil, fmt.Errorf("%w: order is %s", ErrInvalidTransition, status)
+	}
+
+	var live bool
+	query = `SELECT EXISTS (SELECT 1 FROM payments WHERE order_id = $1 AND status IN ('pending', 'authorized', 'captured'))`
+	if err := tx.QueryRow(query, orderID).Scan(&live); err != nil {
+		return nil, err
+	}
+	if live {
+		return nil, fmt.Errorf("%w: order already has a payment", ErrInvalidTransition)
+	}
+
+	query = `
+		INSERT INTO payments (order_id, provider, status, amount)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRow(query, orderID, payment.Provider, payment.Status, payment.Amount).
+		Scan(&payment.ID, &payment.CreatedAt, &payment.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	result, err := s.Provider.Authorize(payments.AuthorizeRequest{OrderID: orderID, Amount: payment.Amount, Token: token})
+	if err != nil {
+		// The provider never took the request, so there is nothing to keep
+		if _, delErr := s.DB.Exec(`DELETE FROM payments WHERE id = $1`, payment.ID); delErr != nil {
+			return nil, delErr
+		}
+		return nil, err
+	}
+
+	if err := s.applyResult(payment, result); err != nil {
+		return nil, err
+	}
+	switch payment.Status {
+	case models.PaymentDeclined:
+		return payment, ErrPaymentDeclined
+	case models.PaymentAuthorized:
+		// The order may have been cancelled while the provider was
+		// answering, in which case the new hold is released straight away
+		if err := s.SettleRefunds(orderID); err != nil {
+			return nil, err
+		}
+		return s.GetPayment(payment.ID)
+	}
+	return payment, nil
+}
+
+// applyResult saves a provider's answer to a pending payment and confirms
+// the order if the payment was authorized.
+func (s *PaymentService) applyResult(payment *models.Payment, result *payments.Result) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE payments
+		SET provider_reference = $1, status = $2, decline_reason = NULLIF($3, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+		RETURNING updated_at
+	`
+	err = tx.QueryRow(query, result.Reference, result.Status, result.DeclineReason, payment.ID).Scan(&payment.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	payment.ProviderReference = result.Reference
+	payment.Status = result.Status
+	payment.DeclineReason = result.DeclineReason
+
+	var event *models.OrderEvent
+	if payment.Status == models.PaymentAuthorized {
+		event, err = confirmPaidOrder(tx, payment.OrderID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.Events.Publish(event)
+	return nil
+}
+
+// confirmPaidOrder moves a pending order to confirmed once its payment has
+// been authorized. The change is recorded without an actor, and returned as
+// an event unless the order was no longer pending.
+func confirmPaidOrder(tx *sql.Tx, orderID int64) (*models.OrderEvent, error) {
+	query := `
+		UPDATE orders SET status = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = $3
+	`
+	result, err := tx.Exec(query, models.OrderConfirmed, orderID, models.OrderPending)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	return recordStatusChange(tx, orderID, models.OrderPending, models.OrderConfirmed, 0, "")
+}
+
+// orderIsPaid reports whether an order has an authorized or captured
+// payment.
+func orderIsPaid(tx *sql.Tx, orderID int64) (bool, error) {
+	var paid bool
+	query := `SELECT EXISTS (SELECT 1 FROM payments WHERE order_id = $1 AND status IN ('authorized', 'captured'))`
+	err := tx.QueryRow(query, orderID).Scan(&paid)
+	return paid, err
+}
+
+func (s *PaymentService) GetPayment(id int64) (*models.Payment, error) {
+	payment := &models.Payment{}
+	err := scanPayment(s.DB.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = $1`, id), payment)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("payment")
+		}
+		return nil, err
+	}
+	return payment, nil
+}
+
+// ListPayments returns every payment attempt for an order, oldest first.
+func (s *PaymentService) ListPayments(orderID int64) ([]*models.Payment, error) {
+	rows, err := s.DB.Query(`SELECT `+paymentColumns+` FROM payments WHERE order_id = $1 ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*models.Payment
+	for rows.Next() {
+		payment := &models.Payment{}
+		if err := scanPayment(rows, payment); err != nil {
+			return nil, err
+		}
+		list = append(list, payment)
+	}
+
+	return list, rows.Err()
+}
+
+// livePayment returns the order's payment that holds or has taken money, or
+// nil if there is none.
+func (s *PaymentService) livePayment(orderID int64) (*models.Payment, error) {
+	payment := &models.Payment{}
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE order_id = $1 AND status IN ('authorized', 'captured')`
+	err := scanPayment(s.DB.QueryRow(query, orderID), payment)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// CaptureOrder takes the money held for an order. It captures the order's
+// current total and tip, which is less than was authorized if lines have been
+// cancelled since; the refunds for those lines need no money moved and are
+// settled by the capture. An order without an authorized payment is left
+// alone.
+func (s *PaymentService) CaptureOrder(orderID int64) (*models.Payment, error) {
+	payment, err := s.livePayment(orderID)
+	if err != nil || payment == nil || payment.Status != models.PaymentAuthorized {
+		return payment, err
+	}
+
+	var total money.Money
+	if err := s.DB.QueryRow(`SELECT total_amount + tip_amount FROM orders WHERE id = $1`, orderID).Scan(&total); err != nil {
+		return nil, err
+	}
+	amount := total.Min(payment.Amount)
+	if !amount.IsPositive() {
+		return payment, nil
+	}
+
+	result, err := s.Provider.Capture(payment.ProviderReference, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE payments SET status = $1, captured_amount = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 RETURNING updated_at
+	`
+	if err := tx.QueryRow(query, result.Status, amount, payment.ID).Scan(&payment.UpdatedAt); err != nil {
+		return nil, err
+	}
+	payment.Status = result.Status
+	payment.CapturedAmount = amount
+
+	query = `
+		UPDATE refunds SET payment_id = $1, settled_at = CURRENT_TIMESTAMP
+		WHERE order_id = $2 AND order_item_id IS NOT NULL AND settled_at IS NULL
+	`
+	if _, err := tx.Exec(query, payment.ID, orderID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// SettleRefunds pays back an order's outstanding refunds through its
+// payment. A cancelled order whose payment was never captured has its hold
+// voided instead. Refunds on an order that was never paid need no money
+// moved and are left as records.
+func (s *PaymentService) SettleRefunds(orderID int64) error {
+	payment, err := s.livePayment(orderID)
+	if err != nil || payment == nil {
+		return err
+	}
+
+	if payment.Status == models.PaymentAuthorized {
+		var status string
+		if err := s.DB.QueryRow(`SELECT status FROM orders WHERE id = $1`, orderID).Scan(&status); err != nil {
+			return err
+		}
+		// Line refunds on a live order are settled by capturing less later
+		if status != models.OrderCancelled {
+			return nil
+		}
+		return s.voidPayment(payment)
+	}
+
+	rows, err := s.DB.Query(`SELECT id, amount FROM refunds WHERE order_id = $1 AND settled_at IS NULL ORDER BY id`, orderID)
+	if err != nil {
+		return err
+	}
+	var refunds []models.Refund
+	for rows.Next() {
+		var r models.Refund
+		if err := rows.Scan(&r.ID, &r.Amount); err != nil {
+			rows.Close()
+			return err
+		}
+		refunds = append(refunds, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, refund := range refunds {
+		amount := refund.Amount.Min(payment.CapturedAmount.Sub(payment.RefundedAmount))
+		var reference string
+		if amount.IsPositive() {
+			result, err := s.Provider.Refund(payment.ProviderReference, amount)
+			if err != nil {
+				return err
+			}
+			reference = result.Reference
+			payment.RefundedAmount = payment.RefundedAmount.Add(amount)
+			if payment.RefundedAmount.Cmp(payment.CapturedAmount) >= 0 {
+				payment.Status = models.PaymentRefunded
+			}
+		}
+
+		if err := s.recordSettlement(payment, refund.ID, reference); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordSettlement saves a settled refund and the payment it came out of.
+func (s *PaymentService) recordSettlement(payment *models.Payment, refundID int64, reference string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE refunds SET payment_id = $1, provider_reference = NULLIF($2, ''), settled_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`
+	if _, err := tx.Exec(query, payment.ID, reference, refundID); err != nil {
+		return err
+	}
+
+	query = `UPDATE payments SET status = $1, refunded_amount = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3`
+	if _, err := tx.Exec(query, payment.Status, payment.RefundedAmount, payment.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// voidPayment releases an uncaptured hold and settles the order's refunds
+// against it, since no money was taken.
+func (s *PaymentService) voidPayment(payment *models.Payment) error {
+	result, err := s.Provider.Void(payment.ProviderReference)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE payments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	if _, err := tx.Exec(query, result.Status, payment.ID); err != nil {
+		return err
+	}
+	query = `UPDATE refunds SET payment_id = $1, settled_at = CURRENT_TIMESTAMP WHERE order_id = $2 AND settled_at IS NULL`
+	if _, err := tx.Exec(query, payment.ID, payment.OrderID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// HandleWebhook applies a webhook delivery from the provider. Deliveries are
+// checked with the provider, and one that has been handled before is
+// ignored. Only the outcome of a pending authorization is acted on; the
+// other changes are made by this service and already recorded.
+func (s *PaymentService) HandleWebhook(r *http.Request) error {
+	event, err := s.Provider.ParseWebhook(r)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO payment_events (provider, event_id, type, provider_reference)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, event_id) DO NOTHING
+	`
+	result, err := tx.Exec(query, s.Provider.Name(), event.ID, event.Status, event.Reference)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	payment := &models.Payment{}
+	query = `SELECT ` + paymentColumns + ` FROM payments WHERE provider = $1 AND provider_reference = $2 FOR UPDATE`
+	if err := scanPayment(tx.QueryRow(query, s.Provider.Name(), event.Reference), payment); err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("payment")
+		}
+		return err
+	}
+
+	var confirmed *models.OrderEvent
+	if payment.Status == models.PaymentPending &&
+		(event.Status == models.PaymentAuthorized || event.Status == models.PaymentDeclined) {
+		query := `
+			UPDATE payments SET status = $1, decline_reason = NULLIF($2, ''), updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3
+		`
+		if _, err := tx.Exec(query, event.Status, event.DeclineReason, payment.ID); err != nil {
+			return err
+		}
+		if event.Status == models.PaymentAuthorized {
+			confirmed, err = confirmPaidOrder(tx, payment.OrderID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.Events.Publish(confirmed)
+
+	// The order may have been cancelled while the payment was pending, in
+	// which case the new hold is released straight away
+	if event.Status == models.PaymentAuthorized {
+		return s.SettleRefunds(payment.OrderID)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"database/sql"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+type PricingService struct {
+	DB               *sql.DB
+	ProductService   *ProductService
+	PromotionService *PromotionService
+}
+
+func NewPricingService(db *sql.DB, productService *ProductService, promotionService *PromotionService) *PricingService {
+	return &PricingService{DB: db, ProductService: productService, PromotionService: promotionService}
+}
+
+// PriceOrder works out what an order costs from the catalog. Each item's
+// unit price is the store price of the product plus its bundle adjustments
+// and modifiers; the order's promotion code, the delivery fee and tax are
+// then applied to the subtotal. Tax is charged per product tax category at
+// the rates of the store and its jurisdiction (see CalculateTax). Delivery
+// orders need an address that contains their postcode, if they give one,
+// and are priced by the store's delivery zone for the postcode and location
+// (see FindZone), whose minimum order must be met. Any prices sent by the
+// client are overwritten, and only the tip is taken from the request.
+// Nothing is saved.
+func (s *PricingService) PriceOrder(order *models.Order) error {
+	if order.StoreID == 0 {
+		return invalidf("store_id is required")
+	}
+	if len(order.Items) == 0 {
+		return invalidf("order must contain at least one item")
+	}
+
+	var deliveryFee money.Money
+	err := s.DB.QueryRow(`SELECT delivery_fee FROM stores WHERE id = $1`, order.StoreID).Scan(&deliveryFee)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("store")
+		}
+		return err
+	}
+
+	taxRates, taxIncluded, err := storeTaxRates(s.DB, order.StoreID)
+	if err != nil {
+		return err
+	}
+	productIDs := make([]int64, len(order.Items))
+	for i, item := range order.Items {
+		productIDs[i] = item.ProductID
+	}
+	taxCategories, err := productTaxCategories(s.DB, productIDs)
+	if err != nil {
+		return err
+	}
+
+	var subtotal money.Money
+	categorySubtotals := make(map[string]money.Money)
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.Quantity <= 0 {
+			return invalidf("quantity must be positive")
+		}
+
+		unitPrice, err := s.ProductService.GetPrice(order.StoreID, item.ProductID)
+		if err != nil {
+			return err
+		}
+
+		item.Components, err = s.ProductService.BundleComponents(*item)
+		if err != nil {
+			return err
+		}
+		for _, c := range item.Components {
+			unitPrice = unitPrice.Add(c.PriceAdjustment)
+		}
+
+		item.Modifiers, err = s.ProductService.resolveModifiers(item.ProductID, item.ModifierIDs)
+		if err != nil {
+			return err
+		}
+		for _, m := range item.Modifiers {
+			unitPrice = unitPrice.Add(m.Price)
+		}
+		// Adjustments and modifiers may be negative, but never so far that
+		// the item costs nothing or less
+		if !unitPrice.IsPositive() {
+			return invalidf("product %d would cost %s; unit prices must be positive", item.ProductID, unitPrice)
+		}
+
+		item.UnitPrice = unitPrice
+		item.TaxCategory = models.NormalizeTaxCategory(taxCategories[item.ProductID])
+		lineAmount := unitPrice.Mul(int64(item.Quantity))
+		subtotal = subtotal.Add(lineAmount)
+		categorySubtotals[item.TaxCategory] = categorySubtotals[item.TaxCategory].Add(lineAmount)
+	}
+
+	pricing := models.OrderPricing{Subtotal: subtotal}
+	if order.PromotionCode != "" {
+		discount, err := s.PromotionService.ApplyPromotion(order.PromotionCode, subtotal)
+		if err != nil {
+			return err
+		}
+		pricing.DiscountAmount = discount.Min(subtotal)
+	}
+	order.DeliveryZoneID, order.DeliveryETAMinutes = nil, nil
+	if order.OrderType == models.OrderTypeDelivery {
+		if err := checkDeliveryAddress(order); err != nil {
+			return err
+		}
+		zone, ok, err := findDeliveryZone(s.DB, order.StoreID, order.DeliveryPostcode, order.DeliveryLocation)
+		if err != nil {
+			return err
+		}
+		pricing.DeliveryFee = deliveryFee
+		if ok {
+			if subtotal.Sub(pricing.DiscountAmount).Cmp(zone.MinimumOrder) < 0 {
+				return invalidf("delivery orders to %s must be at least %s", zone.Name, zone.MinimumOrder)
+			}
+			pricing.DeliveryFee = zone.Fee
+			order.DeliveryZoneID, order.DeliveryETAMinutes = &zone.ID, &zone.ETAMinutes
+		}
+	}
+
+	// Delivery fees are not taxed
+	taxable := subtotal.Sub(pricing.DiscountAmount)
+	pricing.TaxLines, pricing.TaxAmount = CalculateTax(categorySubtotals, pricing.DiscountAmount, taxRates, taxIncluded)
+	pricing.TaxIncluded = taxIncluded
+	pricing.TotalAmount = taxable.Add(pricing.DeliveryFee)
+	if !taxIncluded {
+		pricing.TotalAmount = pricing.TotalAmount.Add(pricing.TaxAmount)
+	}
+
+	// A tip is a preset share of the discounted subtotal or a fixed amount
+	if order.TipPercent != nil {
+		if !order.TipAmount.IsZero() {
+			return invalidf("set tip_amount or tip_percent, not both")
+		}
+		if !models.IsTipPreset(*order.TipPercent) {
+			return invalidf("tip_percent must be one of %v", models.TipPresets)
+		}
+		pricing.TipAmount = taxable.MulRate(int64(*order.TipPercent), 100, taxRounding)
+	} else {
+		if order.TipAmount.IsNegative() {
+			return invalidf("tip_amount cannot be negative")
+		}
+		// Stores charge in DefaultCurrency, and amounts are stored without
+		// their currency, so a tip in another one would be read back wrong
+		if c := order.TipAmount.Currency; c != "" && c != money.DefaultCurrency {
+			return invalidf("tip_amount must be in %s", money.DefaultCurrency)
+		}
+		pricing.TipAmount = order.TipAmount
+	}
+
+	order.OrderPricing = pricing
+	return nil
+}
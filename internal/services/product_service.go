@@ -2,42 +2,65 @@ package services
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
 )
 
 type ProductService struct {
-	DB *sql.DB
+	DB               *sql.DB
+	InventoryService *InventoryService
 }
 
-func NewProductService(db *sql.DB) *ProductService {
-	return &ProductService{DB: db}
+func NewProductService(db *sql.DB, inventoryService *InventoryService) *ProductService {
+	return &ProductService{DB: db, InventoryService: inventoryService}
+}
+
+// productColumns lists the products columns in the order scanProduct reads them.
+// Stock is kept per store, so a product's stock is the total across stores.
+const productColumns = `id, name, description, size, category_id, price,
+	(SELECT COALESCE(SUM(sp.stock_quantity), 0) FROM store_products sp WHERE sp.product_id = products.id),
+	reorder_threshold, is_bundle, tax_category, version, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProduct(row rowScanner, product *models.Product) error {
+	return row.Scan(
+		&product.ID, &product.Name, &product.Description, &product.Size, &product.CategoryID, &product.Price,
+		&product.StockQuantity, &product.ReorderThreshold, &product.IsBundle, &product.TaxCategory, &product.Version,
+		&product.CreatedAt, &product.UpdatedAt,
+	)
 }
 
 func (s *ProductService) CreateProduct(product *models.Product) error {
-	query := `INSERT INTO products (name, description, size, price, stock_quantity) 
-              VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at`
+	product.TaxCategory = models.NormalizeTaxCategory(product.TaxCategory)
+	query := `INSERT INTO products (name, description, size, category_id, price, reorder_threshold, tax_category) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, is_bundle, version, created_at, updated_at`
 
-	err := s.DB.QueryRow(query, product.Name, product.Description, product.Size, product.Price, product.StockQuantity).
-		Scan(&product.ID, &product.CreatedAt, &product.UpdatedAt)
+	// A new product has no stock until a store stocks it
+	product.StockQuantity = 0
+	err := s.DB.QueryRow(query, product.Name, product.Description, product.Size, product.CategoryID, product.Price,
+		product.ReorderThreshold, product.TaxCategory).
+		Scan(&product.ID, &product.IsBundle, &product.Version, &product.CreatedAt, &product.UpdatedAt)
 
 	return err
 }
 
 func (s *ProductService) GetProduct(id int64) (*models.Product, error) {
 	product := &models.Product{}
-	query := `SELECT id, name, description, size, price, stock_quantity, created_at, updated_at 
-              FROM products WHERE id = $1`
+	query := `SELECT ` + productColumns + ` FROM products WHERE id = $1`
 
-	err := s.DB.QueryRow(query, id).Scan(
-		&product.ID, &product.Name, &product.Description, &product.Size,
-		&product.Price, &product.StockQuantity, &product.CreatedAt, &product.UpdatedAt,
-	)
+	err := scanProduct(s.DB.QueryRow(query, id), product)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("product not found")
+			return nil, notFound("product")
 		}
 		return nil, err
 	}
@@ -45,9 +68,25 @@ func (s *ProductService) GetProduct(id int64) (*models.Product, error) {
 	return product, nil
 }
 
-func (s *ProductService) ListProducts() ([]*models.Product, error) {
-	query := `SELECT id, name, description, size, price, stock_quantity, created_at, updated_at 
-              FROM products ORDER BY name`
+// ListProducts returns the catalog. Unless includeUnavailable is set, products
+// outside their availability windows right now are left out, judged in the
+// given store's timezone (UTC when storeID is zero).
+func (s *ProductService) ListProducts(storeID int64, includeUnavailable bool) ([]*models.Product, error) {
+	loc := time.UTC
+	if storeID != 0 {
+		var err error
+		if loc, err = storeLocation(s.DB, storeID); err != nil {
+			return nil, err
+		}
+	}
+
+	windows, err := loadAvailabilityWindows(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().In(loc)
+
+	query := `SELECT ` + productColumns + ` FROM products ORDER BY name`
 
 	rows, err := s.DB.Query(query)
 	if err != nil {
@@ -58,77 +97,246 @@ func (s *ProductService) ListProducts() ([]*models.Product, error) {
 	var products []*models.Product
 	for rows.Next() {
 		product := &models.Product{}
-		err := rows.Scan(
-			&product.ID, &product.Name, &product.Description, &product.Size,
-			&product.Price, &product.StockQuantity, &product.CreatedAt, &product.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanProduct(rows, product); err != nil {
 			return nil, err
 		}
+		if !includeUnavailable && !models.IsAvailableAt(windows[product.ID], now) {
+			continue
+		}
 		products = append(products, product)
 	}
 
 	return products, nil
 }
 
-func (s *ProductService) UpdateProduct(product *models.Product) error {
-	query := `UPDATE products SET name = $1, description = $2, size = $3, price = $4, 
-              stock_quantity = $5, updated_at = CURRENT_TIMESTAMP 
-              WHERE id = $6 RETURNING updated_at`
+// UpdateProduct overwrites a product. If expectedVersion is non-zero the
+// update only applies when it matches the stored version, and
+// ErrVersionConflict is returned otherwise.
+func (s *ProductService) UpdateProduct(product *models.Product, expectedVersion int) error {
+	product.TaxCategory = models.NormalizeTaxCategory(product.TaxCategory)
+	query := `UPDATE products SET name = $1, description = $2, size = $3, category_id = $4, price = $5, 
+              reorder_threshold = $6, tax_category = $7, version = version + 1, updated_at = CURRENT_TIMESTAMP 
+              WHERE id = $8 AND ($9 = 0 OR version = $9) RETURNING ` + productColumns
 
-	err := s.DB.QueryRow(query, product.Name, product.Description, product.Size,
-		product.Price, product.StockQuantity, product.ID).Scan(&product.UpdatedAt)
+	err := scanProduct(s.DB.QueryRow(query, product.Name, product.Description, product.Size, product.CategoryID,
+		product.Price, product.ReorderThreshold, product.TaxCategory, product.ID, expectedVersion), product)
+	if err == sql.ErrNoRows {
+		return checkVersionConflict(s.DB, "products", product.ID, notFound("product"))
+	}
 
 	return err
 }
 
+// PatchProduct applies a JSON merge patch (RFC 7386) to a product, writing
+// only the columns the patch touches. Invalid fields are reported together
+// as FieldErrors. A non-zero expectedVersion must match the stored version.
+func (s *ProductService) PatchProduct(id int64, patch map[string]json.RawMessage, expectedVersion int) (*models.Product, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	product := &models.Product{}
+	err = scanProduct(tx.QueryRow(`SELECT `+productColumns+` FROM products WHERE id = $1 FOR UPDATE`, id), product)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("product")
+		}
+		return nil, err
+	}
+	if expectedVersion != 0 && product.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	columns, values, err := applyMergePatch(patch, map[string]patchField{
+		"name": {"name", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchRequiredString(raw)
+			product.Name = v
+			return v, err
+		}},
+		"description": {"description", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchString(raw, true)
+			product.Description = v
+			return v, err
+		}},
+		"size": {"size", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchRequiredString(raw)
+			product.Size = v
+			return v, err
+		}},
+		"category_id": {"category_id", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchOptionalID(raw)
+			product.CategoryID = v
+			return v, err
+		}},
+		"price": {"price", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchMoney(raw)
+			product.Price = v
+			return v, err
+		}},
+		"reorder_threshold": {"reorder_threshold", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchNonNegativeInt(raw)
+			product.ReorderThreshold = v
+			return v, err
+		}},
+		"tax_category": {"tax_category", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchRequiredString(raw)
+			product.TaxCategory = models.NormalizeTaxCategory(v)
+			return product.TaxCategory, err
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(columns) > 0 {
+		query := updateColumnsQuery("products", columns, productColumns)
+		if err := scanProduct(tx.QueryRow(query, append(values, id)...), product); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// DeleteProduct deletes a product. A product that has been ordered or
+// stocked cannot be deleted, and ErrInUse is returned.
 func (s *ProductService) DeleteProduct(id int64) error {
 	query := `DELETE FROM products WHERE id = $1`
 	_, err := s.DB.Exec(query, id)
-	return err
+	return deleteError(err, "product")
 }
 
-func (s *ProductService) UpdateStock(tx *sql.Tx, productID int64, quantity int) error {
-	query := `
-		UPDATE products
+// UpdateStock takes change.Quantity units of a product out of a store's
+// inventory, records the sale in the ledger and raises a low-stock alert if
+// this drops stock below the reorder threshold. Stock held by other customers'
+// reservations is not available; stock held by change.ReservationID is.
+func (s *ProductService) UpdateStock(tx *sql.Tx, change StockChange) error {
+	if change.Reason == "" {
+		change.Reason = models.MovementSale
+	}
+
+	var onHand int
+	query := `SELECT stock_quantity FROM store_products WHERE store_id = $1 AND product_id = $2 FOR UPDATE`
+	err := tx.QueryRow(query, change.StoreID, change.ProductID).Scan(&onHand)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInsufficientStock
+		}
+		return err
+	}
+
+	var reserved int
+	err = tx.QueryRow(reservedQuantityQuery, change.StoreID, change.ProductID, change.ReservationID).Scan(&reserved)
+	if err != nil {
+		return err
+	}
+	if onHand-reserved < change.Quantity {
+		return ErrInsufficientStock
+	}
+
+	query = `
+		UPDATE store_products
 		SET stock_quantity = stock_quantity - $1,
 			updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2 AND stock_quantity >= $1
+		WHERE store_id = $2 AND product_id = $3
 		RETURNING stock_quantity
 	`
 	var newStockQuantity int
-	err := tx.QueryRow(query, quantity, productID).Scan(&newStockQuantity)
+	err = tx.QueryRow(query, change.Quantity, change.StoreID, change.ProductID).Scan(&newStockQuantity)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return errors.New("insufficient stock")
-		}
 		return err
 	}
-	return nil
+
+	if _, err := recordMovement(tx, change, -change.Quantity, newStockQuantity); err != nil {
+		return err
+	}
+
+	return s.InventoryService.CheckLowStock(tx, change.StoreID, change.ProductID, onHand, newStockQuantity)
 }
 
-func (s *ProductService) GetStockQuantity(productID int64) (int, error) {
-	query := `SELECT stock_quantity FROM products WHERE id = $1`
+func (s *ProductService) GetStockQuantity(storeID, productID int64) (int, error) {
+	query := `SELECT stock_quantity FROM store_products WHERE store_id = $1 AND product_id = $2`
 	var stockQuantity int
-	err := s.DB.QueryRow(query, productID).Scan(&stockQuantity)
+	err := s.DB.QueryRow(query, storeID, productID).Scan(&stockQuantity)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
 		return 0, err
 	}
 	return stockQuantity, nil
 }
 
-func (s *ProductService) RestockProduct(productID int64, quantity int) error {
+// GetAvailableQuantity returns how much of a product a new customer can buy
+// at a store: stock on hand minus what live reservations are holding.
+func (s *ProductService) GetAvailableQuantity(storeID, productID int64) (int, error) {
+	onHand, err := s.GetStockQuantity(storeID, productID)
+	if err != nil {
+		return 0, err
+	}
+
+	var reserved int
+	err = s.DB.QueryRow(reservedQuantityQuery, storeID, productID, 0).Scan(&reserved)
+	if err != nil {
+		return 0, err
+	}
+
+	if onHand < reserved {
+		return 0, nil
+	}
+	return onHand - reserved, nil
+}
+
+// RestockProduct puts change.Quantity units of a product back into a store's
+// inventory, creating the store's stock entry if it does not exist yet, and
+// records the movement in the ledger.
+func (s *ProductService) RestockProduct(tx *sql.Tx, change StockChange) error {
+	if change.Quantity <= 0 {
+		return errors.New("restock quantity must be positive")
+	}
+	if change.Reason == "" {
+		change.Reason = models.MovementRestock
+	}
+
 	query := `
-		UPDATE products
-		SET stock_quantity = stock_quantity + $1,
+		INSERT INTO store_products (store_id, product_id, stock_quantity)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (store_id, product_id) DO UPDATE
+		SET stock_quantity = store_products.stock_quantity + $3,
 			updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2
 		RETURNING stock_quantity
 	`
 	var newStockQuantity int
-	err := s.DB.QueryRow(query, quantity, productID).Scan(&newStockQuantity)
+	err := tx.QueryRow(query, change.StoreID, change.ProductID, change.Quantity).Scan(&newStockQuantity)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	_, err = recordMovement(tx, change, change.Quantity, newStockQuantity)
+	return err
+}
+
+// GetPrice returns the price of a product at a store, using the store's
+// override when one is set and the catalog price otherwise.
+func (s *ProductService) GetPrice(storeID, productID int64) (money.Money, error) {
+	query := `
+		SELECT COALESCE(sp.price, p.price)
+		FROM products p
+		LEFT JOIN store_products sp ON sp.product_id = p.id AND sp.store_id = $1
+		WHERE p.id = $2
+	`
+	var price money.Money
+	err := s.DB.QueryRow(query, storeID, productID).Scan(&price)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return money.Money{}, notFound("product")
+		}
+		return money.Money{}, err
+	}
+	return price, nil
 }
@@ -2,10 +2,11 @@ package services
 
 import (
 	"database/sql"
-	"errors"
+	"encoding/json"
 	"time"
 
 	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
 )
 
 type PromotionService struct {
@@ -16,11 +17,30 @@ func NewPromotionService(db *sql.DB) *PromotionService {
 	return &PromotionService{DB: db}
 }
 
+// promotionColumns lists the promotions columns in the order scanPromotion reads them.
+const promotionColumns = `id, code, description, discount_percent, start_date, end_date, is_active, max_redemptions, version, created_at, updated_at`
+
+func scanPromotion(row rowScanner, promotion *models.Promotion) error {
+	return row.Scan(
+		&promotion.ID,
+		&promotion.Code,
+		&promotion.Description,
+		&promotion.DiscountPercent,
+		&promotion.StartDate,
+		&promotion.EndDate,
+		&promotion.IsActive,
+		&promotion.MaxRedemptions,
+		&promotion.Version,
+		&promotion.CreatedAt,
+		&promotion.UpdatedAt,
+	)
+}
+
 func (s *PromotionService) CreatePromotion(promotion *models.Promotion) error {
 	query := `
-		INSERT INTO promotions (code, description, discount_percent, start_date, end_date, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, updated_at
+		INSERT INTO promotions (code, description, discount_percent, start_date, end_date, is_active, max_redemptions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, version, created_at, updated_at
 	`
 	err := s.DB.QueryRow(
 		query,
@@ -30,7 +50,8 @@ func (s *PromotionService) CreatePromotion(promotion *models.Promotion) error {
 		promotion.StartDate,
 		promotion.EndDate,
 		promotion.IsActive,
-	).Scan(&promotion.ID, &promotion.CreatedAt, &promotion.UpdatedAt)
+		promotion.MaxRedemptions,
+	).Scan(&promotion.ID, &promotion.Version, &promotion.CreatedAt, &promotion.UpdatedAt)
 
 	return err
 }
@@ -38,25 +59,15 @@ func (s *PromotionService) CreatePromotion(promotion *models.Promotion) error {
 func (s *PromotionService) GetPromotion(id int64) (*models.Promotion, error) {
 	promotion := &models.Promotion{}
 	query := `
-		SELECT id, code, description, discount_percent, start_date, end_date, is_active, created_at, updated_at
+		SELECT ` + promotionColumns + `
 		FROM promotions
 		WHERE id = $1
 	`
-	err := s.DB.QueryRow(query, id).Scan(
-		&promotion.ID,
-		&promotion.Code,
-		&promotion.Description,
-		&promotion.DiscountPercent,
-		&promotion.StartDate,
-		&promotion.EndDate,
-		&promotion.IsActive,
-		&promotion.CreatedAt,
-		&promotion.UpdatedAt,
-	)
+	err := scanPromotion(s.DB.QueryRow(query, id), promotion)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("promotion not found")
+			return nil, notFound("promotion")
 		}
 		return nil, err
 	}
@@ -66,7 +77,7 @@ func (s *PromotionService) GetPromotion(id int64) (*models.Promotion, error) {
 
 func (s *PromotionService) ListActivePromotions() ([]*models.Promotion, error) {
 	query := `
-		SELECT id, code, description, discount_percent, start_date, end_date, is_active, created_at, updated_at
+		SELECT ` + promotionColumns + `
 		FROM promotions
 		WHERE is_active = true AND start_date <= $1 AND end_date >= $1
 		ORDER BY created_at DESC
@@ -80,18 +91,7 @@ func (s *PromotionService) ListActivePromotions() ([]*models.Promotion, error) {
 	var promotions []*models.Promotion
 	for rows.Next() {
 		promotion := &models.Promotion{}
-		err := rows.Scan(
-			&promotion.ID,
-			&promotion.Code,
-			&promotion.Description,
-			&promotion.DiscountPercent,
-			&promotion.StartDate,
-			&promotion.EndDate,
-			&promotion.IsActive,
-			&promotion.CreatedAt,
-			&promotion.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanPromotion(rows, promotion); err != nil {
 			return nil, err
 		}
 		promotions = append(promotions, promotion)
@@ -100,12 +100,16 @@ func (s *PromotionService) ListActivePromotions() ([]*models.Promotion, error) {
 	return promotions, nil
 }
 
-func (s *PromotionService) UpdatePromotion(promotion *models.Promotion) error {
+// UpdatePromotion overwrites a promotion. If expectedVersion is non-zero the
+// update only applies when it matches the stored version, and
+// ErrVersionConflict is returned otherwise.
+func (s *PromotionService) UpdatePromotion(promotion *models.Promotion, expectedVersion int) error {
 	query := `
 		UPDATE promotions
-		SET code = $1, description = $2, discount_percent = $3, start_date = $4, end_date = $5, is_active = $6, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $7
-		RETURNING updated_at
+		SET code = $1, description = $2, discount_percent = $3, start_date = $4, end_date = $5, is_active = $6,
+			max_redemptions = $7, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8 AND ($9 = 0 OR version = $9)
+		RETURNING version, created_at, updated_at
 	`
 	err := s.DB.QueryRow(
 		query,
@@ -115,33 +119,175 @@ func (s *PromotionService) UpdatePromotion(promotion *models.Promotion) error {
 		promotion.StartDate,
 		promotion.EndDate,
 		promotion.IsActive,
+		promotion.MaxRedemptions,
 		promotion.ID,
-	).Scan(&promotion.UpdatedAt)
+		expectedVersion,
+	).Scan(&promotion.Version, &promotion.CreatedAt, &promotion.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return checkVersionConflict(s.DB, "promotions", promotion.ID, notFound("promotion"))
+	}
 
 	return err
 }
 
+// PatchPromotion applies a JSON merge patch (RFC 7386) to a promotion,
+// writing only the columns the patch touches. Invalid fields are reported
+// together as FieldErrors. A non-zero expectedVersion must match the stored
+// version.
+func (s *PromotionService) PatchPromotion(id int64, patch map[string]json.RawMessage, expectedVersion int) (*models.Promotion, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	promotion := &models.Promotion{}
+	err = scanPromotion(tx.QueryRow(`SELECT `+promotionColumns+` FROM promotions WHERE id = $1 FOR UPDATE`, id), promotion)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("promotion")
+		}
+		return nil, err
+	}
+	if expectedVersion != 0 && promotion.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	columns, values, err := applyMergePatch(patch, map[string]patchField{
+		"code": {"code", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchRequiredString(raw)
+			promotion.Code = v
+			return v, err
+		}},
+		"description": {"description", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchString(raw, true)
+			promotion.Description = v
+			return v, err
+		}},
+		"discount_percent": {"discount_percent", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchFloat(raw, 0, 100)
+			promotion.DiscountPercent = v
+			return v, err
+		}},
+		"start_date": {"start_date", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchTime(raw)
+			promotion.StartDate = v
+			return v, err
+		}},
+		"end_date": {"end_date", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchTime(raw)
+			promotion.EndDate = v
+			return v, err
+		}},
+		"is_active": {"is_active", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchBool(raw)
+			promotion.IsActive = v
+			return v, err
+		}},
+		"max_redemptions": {"max_redemptions", func(raw json.RawMessage) (interface{}, error) {
+			v, err := patchOptionalLimit(raw)
+			promotion.MaxRedemptions = v
+			return v, err
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if promotion.EndDate.Before(promotion.StartDate) {
+		return nil, FieldErrors{"end_date": "must not be before start_date"}
+	}
+
+	if len(columns) > 0 {
+		query := updateColumnsQuery("promotions", columns, promotionColumns)
+		if err := scanPromotion(tx.QueryRow(query, append(values, id)...), promotion); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return promotion, nil
+}
+
+// DeletePromotion deletes a promotion. A promotion that has been redeemed
+// cannot be deleted, and ErrInUse is returned.
 func (s *PromotionService) DeletePromotion(id int64) error {
 	query := `DELETE FROM promotions WHERE id = $1`
 	_, err := s.DB.Exec(query, id)
-	return err
+	return deleteError(err, "promotion")
 }
 
-func (s *PromotionService) ApplyPromotion(code string, totalAmount float64) (float64, error) {
+// errPromotionUsedUp is returned for codes that have reached their
+// max_redemptions.
+var errPromotionUsedUp = invalidf("promotion code has been fully redeemed")
+
+// activeRedemptions counts the orders currently holding a promotion.
+const activeRedemptions = `(SELECT COUNT(*) FROM promotion_redemptions r WHERE r.promotion_id = promotions.id AND r.released_at IS NULL)`
+
+// ApplyPromotion returns the discount a promotion code gives on totalAmount,
+// rounded down to the cent.
+func (s *PromotionService) ApplyPromotion(code string, totalAmount money.Money) (money.Money, error) {
 	query := `
-		SELECT discount_percent
+		SELECT discount_percent, max_redemptions IS NOT NULL AND ` + activeRedemptions + ` >= max_redemptions
 		FROM promotions
 		WHERE code = $1 AND is_active = true AND start_date <= $2 AND end_date >= $2
 	`
 	var discountPercent float64
-	err := s.DB.QueryRow(query, code, time.Now()).Scan(&discountPercent)
+	var usedUp bool
+	err := s.DB.QueryRow(query, code, time.Now()).Scan(&discountPercent, &usedUp)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return 0, errors.New("invalid or expired promotion code")
+			return money.Money{}, invalidf("invalid or expired promotion code")
 		}
-		return 0, err
+		return money.Money{}, err
+	}
+	if usedUp {
+		return money.Money{}, errPromotionUsedUp
 	}
 
-	discountAmount := totalAmount * (discountPercent / 100)
+	discountAmount := totalAmount.Percent(money.BasisPoints(discountPercent), discountRounding)
 	return discountAmount, nil
 }
+
+// redeemPromotion records that an order used a promotion code, inside the
+// order's transaction. The promotion row is locked so concurrent orders
+// cannot take it past max_redemptions.
+func redeemPromotion(tx *sql.Tx, code string, orderID, userID int64, discount money.Money) error {
+	var promotionID int64
+	var maxRedemptions sql.NullInt64
+	query := `SELECT id, max_redemptions FROM promotions WHERE code = $1 FOR UPDATE`
+	if err := tx.QueryRow(query, code).Scan(&promotionID, &maxRedemptions); err != nil {
+		if err == sql.ErrNoRows {
+			return invalidf("invalid or expired promotion code")
+		}
+		return err
+	}
+
+	if maxRedemptions.Valid {
+		var used int64
+		query := `SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = $1 AND released_at IS NULL`
+		if err := tx.QueryRow(query, promotionID).Scan(&used); err != nil {
+			return err
+		}
+		if used >= maxRedemptions.Int64 {
+			return errPromotionUsedUp
+		}
+	}
+
+	query = `
+		INSERT INTO promotion_redemptions (promotion_id, order_id, user_id, discount_amount)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := tx.Exec(query, promotionID, orderID, userID, discount)
+	return err
+}
+
+// releasePromotionRedemption gives back the use of a promotion code taken by
+// a cancelled order.
+func releasePromotionRedemption(tx *sql.Tx, orderID int64) error {
+	query := `UPDATE promotion_redemptions SET released_at = CURRENT_TIMESTAMP WHERE order_id = $1 AND released_at IS NULL`
+	_, err := tx.Exec(query, orderID)
+	return err
+}
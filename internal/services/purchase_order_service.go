@@ -0,0 +1,313 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+	"github.com/lib/pq"
+)
+
+type PurchaseOrderService struct {
+	DB             *sql.DB
+	ProductService *ProductService
+}
+
+func NewPurchaseOrderService(db *sql.DB, productService *ProductService) *PurchaseOrderService {
+	return &PurchaseOrderService{DB: db, ProductService: productService}
+}
+
+// ReceiveLine is a quantity of one purchase order line that has arrived.
+// UnitCost overrides the line's agreed cost when the invoice differs.
+type ReceiveLine struct {
+	ItemID   int64        `json:"item_id"`
+	Quantity int          `json:"quantity"`
+	UnitCost *money.Money `json:"unit_cost,omitempty"`
+}
+
+// CreatePurchaseOrder saves a new purchase order as a draft, or as ordered
+// when the caller asks for it to be placed straight away.
+func (s *PurchaseOrderService) CreatePurchaseOrder(po *models.PurchaseOrder) error {
+	if po.SupplierID == 0 || po.StoreID == 0 {
+		return errors.New("supplier_id and store_id are required")
+	}
+	if po.Status == "" {
+		po.Status = models.PurchaseOrderDraft
+	}
+	if po.Status != models.PurchaseOrderDraft && po.Status != models.PurchaseOrderOrdered {
+		return errors.New("new purchase orders must be draft or ordered")
+	}
+	if len(po.Items) == 0 {
+		return errors.New("purchase order must contain at least one item")
+	}
+	for _, item := range po.Items {
+		if item.QuantityOrdered <= 0 {
+			return errors.New("quantity_ordered must be positive")
+		}
+		if item.UnitCost.IsNegative() {
+			return errors.New("unit_cost cannot be negative")
+		}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO purchase_orders (supplier_id, store_id, status, expected_date, notes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRow(query, po.SupplierID, po.StoreID, po.Status, po.ExpectedDate, po.Notes, po.CreatedBy).
+		Scan(&po.ID, &po.CreatedAt, &po.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	for i := range po.Items {
+		item := &po.Items[i]
+		item.PurchaseOrderID = po.ID
+		item.QuantityReceived = 0
+		query := `
+			INSERT INTO purchase_order_items (purchase_order_id, product_id, quantity_ordered, unit_cost)
+			VALUES ($1, $2, $3, $4) RETURNING id
+		`
+		err := tx.QueryRow(query, po.ID, item.ProductID, item.QuantityOrdered, item.UnitCost).Scan(&item.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *PurchaseOrderService) GetPurchaseOrder(id int64) (*models.PurchaseOrder, error) {
+	po := &models.PurchaseOrder{}
+	query := `
+		SELECT id, supplier_id, store_id, status, expected_date, COALESCE(notes, ''), COALESCE(created_by, 0), created_at, updated_at
+		FROM purchase_orders WHERE id = $1
+	`
+	err := s.DB.QueryRow(query, id).Scan(
+		&po.ID, &po.SupplierID, &po.StoreID, &po.Status, &po.ExpectedDate,
+		&po.Notes, &po.CreatedBy, &po.CreatedAt, &po.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("purchase order")
+		}
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT id, product_id, quantity_ordered, quantity_received, unit_cost
+		FROM purchase_order_items WHERE purchase_order_id = $1 ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	itemIndex := make(map[int64]int)
+	for rows.Next() {
+		item := models.PurchaseOrderItem{PurchaseOrderID: id}
+		err := rows.Scan(&item.ID, &item.ProductID, &item.QuantityOrdered, &item.QuantityReceived, &item.UnitCost)
+		if err != nil {
+			return nil, err
+		}
+		itemIndex[item.ID] = len(po.Items)
+		po.Items = append(po.Items, item)
+	}
+
+	receipts, err := s.DB.Query(`
+		SELECT r.id, r.purchase_order_item_id, r.quantity, r.unit_cost, COALESCE(r.received_by, 0), r.received_at
+		FROM purchase_order_receipts r
+		JOIN purchase_order_items i ON i.id = r.purchase_order_item_id
+		WHERE i.purchase_order_id = $1
+		ORDER BY r.id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer receipts.Close()
+
+	for receipts.Next() {
+		var receipt models.PurchaseOrderReceipt
+		err := receipts.Scan(&receipt.ID, &receipt.ItemID, &receipt.Quantity, &receipt.UnitCost,
+			&receipt.ReceivedBy, &receipt.ReceivedAt)
+		if err != nil {
+			return nil, err
+		}
+		i := itemIndex[receipt.ItemID]
+		po.Items[i].Receipts = append(po.Items[i].Receipts, receipt)
+	}
+
+	return po, nil
+}
+
+// ListPurchaseOrders returns purchase orders newest first without their
+// items. Zero storeID or supplierID and an empty status match everything.
+func (s *PurchaseOrderService) ListPurchaseOrders(storeID, supplierID int64, status string) ([]*models.PurchaseOrder, error) {
+	query := `
+		SELECT id, supplier_id, store_id, status, expected_date, COALESCE(notes, ''), COALESCE(created_by, 0), created_at, updated_at
+		FROM purchase_orders
+		WHERE ($1 = 0 OR store_id = $1) AND ($2 = 0 OR supplier_id = $2) AND ($3 = '' OR status = $3)
+		ORDER BY created_at DESC
+	`
+	rows, err := s.DB.Query(query, storeID, supplierID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*models.PurchaseOrder
+	for rows.Next() {
+		po := &models.PurchaseOrder{}
+		err := rows.Scan(
+			&po.ID, &po.SupplierID, &po.StoreID, &po.Status, &po.ExpectedDate,
+			&po.Notes, &po.CreatedBy, &po.CreatedAt, &po.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, po)
+	}
+
+	return orders, nil
+}
+
+// UpdatePurchaseOrderStatus places a draft with the supplier or cancels a
+// purchase order that has not started arriving. Receiving goes through
+// ReceivePurchaseOrder instead.
+func (s *PurchaseOrderService) UpdatePurchaseOrderStatus(id int64, status string) error {
+	var allowedFrom []string
+	switch status {
+	case models.PurchaseOrderOrdered:
+		allowedFrom = []string{models.PurchaseOrderDraft}
+	case models.PurchaseOrderCancelled:
+		allowedFrom = []string{models.PurchaseOrderDraft, models.PurchaseOrderOrdered}
+	default:
+		return fmt.Errorf("cannot set purchase order status to %q", status)
+	}
+
+	query := `
+		UPDATE purchase_orders SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = ANY($3)
+	`
+	result, err := s.DB.Exec(query, status, id, pq.Array(allowedFrom))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("purchase order not found or cannot move to %q", status)
+	}
+	return nil
+}
+
+// ReceivePurchaseOrder books delivered quantities against a purchase order.
+// Each line goes into the store's stock through the normal restock path and
+// is recorded as a receipt with its unit cost. Lines may arrive across
+// several deliveries but never exceed what was ordered.
+func (s *PurchaseOrderService) ReceivePurchaseOrder(id int64, lines []ReceiveLine, actorID int64) (*models.PurchaseOrder, error) {
+	if len(lines) == 0 {
+		return nil, errors.New("nothing to receive")
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var storeID int64
+	var status string
+	err = tx.QueryRow(`SELECT store_id, status FROM purchase_orders WHERE id = $1 FOR UPDATE`, id).Scan(&storeID, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("purchase order")
+		}
+		return nil, err
+	}
+	if status != models.PurchaseOrderOrdered && status != models.PurchaseOrderPartiallyReceived {
+		return nil, fmt.Errorf("cannot receive a purchase order that is %s", status)
+	}
+
+	for _, line := range lines {
+		if line.Quantity <= 0 {
+			return nil, errors.New("received quantity must be positive")
+		}
+
+		var productID int64
+		var ordered, received int
+		var unitCost money.Money
+		query := `
+			SELECT product_id, quantity_ordered, quantity_received, unit_cost
+			FROM purchase_order_items WHERE id = $1 AND purchase_order_id = $2
+		`
+		err := tx.QueryRow(query, line.ItemID, id).Scan(&productID, &ordered, &received, &unitCost)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("item %d is not on this purchase order", line.ItemID)
+			}
+			return nil, err
+		}
+		if received+line.Quantity > ordered {
+			return nil, fmt.Errorf("item %d: receiving %d would exceed the %d ordered (%d already received)",
+				line.ItemID, line.Quantity, ordered, received)
+		}
+		if line.UnitCost != nil {
+			if line.UnitCost.IsNegative() {
+				return nil, errors.New("unit_cost cannot be negative")
+			}
+			unitCost = *line.UnitCost
+		}
+
+		err = s.ProductService.RestockProduct(tx, StockChange{
+			StoreID:   storeID,
+			ProductID: productID,
+			Quantity:  line.Quantity,
+			Reason:    models.MovementRestock,
+			ActorID:   actorID,
+			Note:      fmt.Sprintf("Purchase order #%d", id),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`UPDATE purchase_order_items SET quantity_received = quantity_received + $1 WHERE id = $2`,
+			line.Quantity, line.ItemID)
+		if err != nil {
+			return nil, err
+		}
+
+		query = `
+			INSERT INTO purchase_order_receipts (purchase_order_item_id, quantity, unit_cost, received_by)
+			VALUES ($1, $2, $3, $4)
+		`
+		if _, err := tx.Exec(query, line.ItemID, line.Quantity, unitCost, actorID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Mark the order fully received once every line is complete
+	query := `
+		UPDATE purchase_orders
+		SET status = CASE
+				WHEN EXISTS (SELECT 1 FROM purchase_order_items WHERE purchase_order_id = $1 AND quantity_received < quantity_ordered)
+				THEN 'partially_received' ELSE 'received' END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(query, id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetPurchaseOrder(id)
+}
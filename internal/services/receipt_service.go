@@ -0,0 +1,172 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/internal/receipts"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+	"github.com/lib/pq"
+)
+
+type ReceiptService struct {
+	DB     *sql.DB
+	Mailer Mailer
+}
+
+func NewReceiptService(db *sql.DB, mailer Mailer) *ReceiptService {
+	return &ReceiptService{DB: db, Mailer: mailer}
+}
+
+// BuildReceipt works out the receipt for an order as loaded by GetOrder.
+// Cancelled quantities are left off, and refunds and the loyalty points
+// the order still counts for are shown as they stand now.
+func (s *ReceiptService) BuildReceipt(order *models.Order) (*receipts.Receipt, error) {
+	var timezone string
+	receipt := &receipts.Receipt{
+		OrderID:       order.ID,
+		OrderType:     order.OrderType,
+		Status:        order.Status,
+		Subtotal:      order.Subtotal,
+		Discount:      order.DiscountAmount,
+		PromotionCode: order.PromotionCode,
+		DeliveryFee:   order.DeliveryFee,
+		TaxAmount:     order.TaxAmount,
+		TaxIncluded:   order.TaxIncluded,
+		Total:         order.TotalAmount,
+		Tip:           order.TipAmount,
+		Currency:      order.TotalAmount.Currency,
+	}
+	if receipt.Currency == "" {
+		receipt.Currency = money.DefaultCurrency
+	}
+
+	query := `SELECT name, address, timezone FROM stores WHERE id = $1`
+	err := s.DB.QueryRow(query, order.StoreID).Scan(&receipt.StoreName, &receipt.StoreAddress, &timezone)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("store")
+		}
+		return nil, err
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	receipt.PlacedAt = order.CreatedAt.In(loc)
+	if order.ScheduledFor != nil {
+		at := order.ScheduledFor.In(loc)
+		receipt.ScheduledFor = &at
+	}
+
+	productIDs := make([]int64, len(order.Items))
+	for i, item := range order.Items {
+		productIDs[i] = item.ProductID
+	}
+	names, err := productNames(s.DB, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range order.Items {
+		quantity := item.Quantity - item.CancelledQuantity
+		if quantity <= 0 {
+			continue
+		}
+		line := receipts.Item{
+			Name:      names[item.ProductID],
+			Quantity:  quantity,
+			UnitPrice: item.UnitPrice,
+			Total:     item.UnitPrice.Mul(int64(quantity)),
+		}
+		for _, c := range item.Components {
+			line.Extras = append(line.Extras, receipts.Extra{
+				Name:  fmt.Sprintf("%s: %s", c.SlotName, c.ProductName),
+				Price: c.PriceAdjustment,
+			})
+		}
+		for _, m := range item.Modifiers {
+			line.Extras = append(line.Extras, receipts.Extra{Name: m.Name, Price: m.Price})
+		}
+		receipt.Items = append(receipt.Items, line)
+	}
+
+	for _, t := range order.TaxLines {
+		receipt.TaxLines = append(receipt.TaxLines, receipts.TaxLine{Name: t.Name, Rate: t.Rate, Amount: t.TaxAmount})
+	}
+	for _, refund := range order.Refunds {
+		receipt.Refunded = receipt.Refunded.Add(refund.Amount)
+	}
+
+	receipt.LoyaltyPoints, err = orderPointsEarned(s.DB, order.UserID, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// EmailReceipt sends an order's receipt to the customer who placed it, with
+// the PDF attached, and returns the address it went to.
+func (s *ReceiptService) EmailReceipt(order *models.Order) (string, error) {
+	var to string
+	if err := s.DB.QueryRow(`SELECT email FROM users WHERE id = $1`, order.UserID).Scan(&to); err != nil {
+		if err == sql.ErrNoRows {
+			return "", notFound("customer")
+		}
+		return "", err
+	}
+
+	receipt, err := s.BuildReceipt(order)
+	if err != nil {
+		return "", err
+	}
+
+	var text, html, pdf bytes.Buffer
+	if err := receipts.RenderText(&text, receipt); err != nil {
+		return "", err
+	}
+	if err := receipts.RenderHTML(&html, receipt); err != nil {
+		return "", err
+	}
+	if err := receipts.RenderPDF(&pdf, receipt); err != nil {
+		return "", err
+	}
+
+	email := &Email{
+		To:      to,
+		Subject: fmt.Sprintf("Your receipt for order #%d from %s", order.ID, receipt.StoreName),
+		Text:    text.String(),
+		HTML:    html.String(),
+		Attachments: []Attachment{{
+			Filename:    fmt.Sprintf("receipt-%d.pdf", order.ID),
+			ContentType: "application/pdf",
+			Data:        pdf.Bytes(),
+		}},
+	}
+	return to, s.Mailer.Send(email)
+}
+
+// productNames returns the name of each of the products.
+func productNames(db *sql.DB, productIDs []int64) (map[int64]string, error) {
+	rows, err := db.Query(`SELECT id, name FROM products WHERE id = ANY($1)`, pq.Array(productIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+
+	return names, rows.Err()
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+// DefaultReservationTTL is how long stock is held for a customer at checkout.
+const DefaultReservationTTL = 10 * time.Minute
+
+// MaxActiveReservations is how many live reservations one customer may hold
+// at once, so that nobody can take a store's stock off sale.
+const MaxActiveReservations = 3
+
+// ErrTooManyReservations is returned when a customer already holds
+// MaxActiveReservations.
+var ErrTooManyReservations = fmt.Errorf("cannot hold more than %d reservations at once", MaxActiveReservations)
+
+// reservedQuantityQuery sums the stock held by live reservations for a
+// product at a store, excluding reservation $3 (0 excludes nothing).
+const reservedQuantityQuery = `
+	SELECT COALESCE(SUM(ri.quantity), 0)
+	FROM stock_reservation_items ri
+	JOIN stock_reservations r ON r.id = ri.reservation_id
+	WHERE r.store_id = $1 AND ri.product_id = $2 AND r.id <> $3
+		AND r.status = 'active' AND r.expires_at > CURRENT_TIMESTAMP
+`
+
+type ReservationService struct {
+	DB  *sql.DB
+	TTL time.Duration
+}
+
+func NewReservationService(db *sql.DB) *ReservationService {
+	return &ReservationService{DB: db, TTL: DefaultReservationTTL}
+}
+
+// CreateReservation holds the requested items at the store for TTL. Items
+// for the same product are held as one line. It fails if any item is not
+// available after existing reservations are taken out, or if the customer
+// already holds MaxActiveReservations.
+func (s *ReservationService) CreateReservation(reservation *models.Reservation) error {
+	if reservation.StoreID == 0 {
+		return invalidf("store_id is required")
+	}
+	if len(reservation.Items) == 0 {
+		return invalidf("reservation must contain at least one item")
+	}
+	items, err := mergeReservationItems(reservation.Items)
+	if err != nil {
+		return err
+	}
+	reservation.Items = items
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the customer so concurrent requests cannot both pass the cap
+	var userID int64
+	err = tx.QueryRow(`SELECT id FROM users WHERE id = $1 FOR NO KEY UPDATE`, reservation.UserID).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("user")
+		}
+		return err
+	}
+	var active int
+	query := `
+		SELECT COUNT(*) FROM stock_reservations
+		WHERE user_id = $1 AND status = 'active' AND expires_at > CURRENT_TIMESTAMP
+	`
+	if err := tx.QueryRow(query, reservation.UserID).Scan(&active); err != nil {
+		return err
+	}
+	if active >= MaxActiveReservations {
+		return ErrTooManyReservations
+	}
+
+	for _, item := range reservation.Items {
+
+		// Lock the stock row so concurrent reservations and sales queue up
+		var onHand int
+		query := `SELECT stock_quantity FROM store_products WHERE store_id = $1 AND product_id = $2 FOR UPDATE`
+		err := tx.QueryRow(query, reservation.StoreID, item.ProductID).Scan(&onHand)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		var reserved int
+		err = tx.QueryRow(reservedQuantityQuery, reservation.StoreID, item.ProductID, 0).Scan(&reserved)
+		if err != nil {
+			return err
+		}
+
+		if onHand-reserved < item.Quantity {
+			return fmt.Errorf("%w for product %d", ErrInsufficientStock, item.ProductID)
+		}
+	}
+
+	query = `
+		INSERT INTO stock_reservations (user_id, store_id, status, expires_at)
+		VALUES ($1, $2, 'active', CURRENT_TIMESTAMP + $3 * INTERVAL '1 second')
+		RETURNING id, status, expires_at, created_at, updated_at
+	`
+	err = tx.QueryRow(query, reservation.UserID, reservation.StoreID, int(s.TTL.Seconds())).Scan(
+		&reservation.ID, &reservation.Status, &reservation.ExpiresAt, &reservation.CreatedAt, &reservation.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range reservation.Items {
+		query := `INSERT INTO stock_reservation_items (reservation_id, product_id, quantity) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(query, reservation.ID, item.ProductID, item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// mergeReservationItems adds up the quantities of items for the same
+// product, keeping the order in which products first appear.
+func mergeReservationItems(items []models.ReservationItem) ([]models.ReservationItem, error) {
+	merged := make([]models.ReservationItem, 0, len(items))
+	index := map[int64]int{}
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, invalidf("quantity must be positive")
+		}
+		if i, ok := index[item.ProductID]; ok {
+			merged[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(merged)
+		merged = append(merged, item)
+	}
+	return merged, nil
+}
+
+func (s *ReservationService) GetReservation(id int64) (*models.Reservation, error) {
+	reservation := &models.Reservation{}
+	query := `
+		SELECT id, user_id, store_id, status, expires_at, order_id, created_at, updated_at
+		FROM stock_reservations WHERE id = $1
+	`
+	err := s.DB.QueryRow(query, id).Scan(
+		&reservation.ID, &reservation.UserID, &reservation.StoreID, &reservation.Status,
+		&reservation.ExpiresAt, &reservation.OrderID, &reservation.CreatedAt, &reservation.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("reservation")
+		}
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(`SELECT product_id, quantity FROM stock_reservation_items WHERE reservation_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.ReservationItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		reservation.Items = append(reservation.Items, item)
+	}
+
+	return reservation, nil
+}
+
+// ReleaseReservation gives a customer's held stock back before it expires.
+func (s *ReservationService) ReleaseReservation(id, userID int64) error {
+	query := `
+		UPDATE stock_reservations
+		SET status = 'released', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND status = 'active'
+	`
+	result, err := s.DB.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return notFound("active reservation")
+	}
+	return nil
+}
+
+// ConvertReservation marks a live reservation as used by an order. It runs in
+// the order's transaction so the reservation is only consumed if the order is.
+func (s *ReservationService) ConvertReservation(tx *sql.Tx, id, userID, storeID, orderID int64) error {
+	var ownerID, reservationStoreID int64
+	var status string
+	var expired bool
+	query := `
+		SELECT user_id, store_id, status, expires_at <= CURRENT_TIMESTAMP
+		FROM stock_reservations WHERE id = $1 FOR UPDATE
+	`
+	err := tx.QueryRow(query, id).Scan(&ownerID, &reservationStoreID, &status, &expired)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("reservation")
+		}
+		return err
+	}
+
+	if ownerID != userID || reservationStoreID != storeID {
+		return invalidf("reservation does not match this order")
+	}
+	if status != models.ReservationActive || expired {
+		return invalidf("reservation has expired or was already used")
+	}
+
+	query = `
+		UPDATE stock_reservations
+		SET status = 'converted', order_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	_, err = tx.Exec(query, id, orderID)
+	return err
+}
+
+// ReleaseExpired marks reservations past their expiry as released. Expired
+// reservations already stop holding stock; this keeps their status honest.
+func (s *ReservationService) ReleaseExpired() (int64, error) {
+	query := `
+		UPDATE stock_reservations
+		SET status = 'released', updated_at = CURRENT_TIMESTAMP
+		WHERE status = 'active' AND expires_at <= CURRENT_TIMESTAMP
+	`
+	result, err := s.DB.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RunExpiryLoop releases expired reservations every interval. It never
+// returns and is meant to be started in its own goroutine.
+func (s *ReservationService) RunExpiryLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := s.ReleaseExpired(); err != nil {
+			log.Printf("Failed to release expired reservations: %v", err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+)
+
+// Rounding rules for money. Percentage discounts round down so a promotion
+// never gives away more than it advertises. Tax rounds half up on each line,
+// which is what receipts and tax authorities expect.
+const (
+	discountRounding = money.RoundDown
+	taxRounding      = money.RoundHalfUp
+)
+
+// loyaltyPointsFor returns the points earned on an amount: one per whole
+// currency unit, with any cents left over earning nothing.
+func loyaltyPointsFor(amount money.Money) int {
+	if amount.IsNegative() {
+		return 0
+	}
+	return int(amount.WholeUnits())
+}
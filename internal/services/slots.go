@@ -0,0 +1,209 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+// ErrSlotFull is returned when an order asks for a time slot that already
+// has as many orders as the store can take.
+var ErrSlotFull = errors.New("time slot is full")
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// storeSchedule is what slot checks need to know about a store.
+type storeSchedule struct {
+	loc      *time.Location
+	hours    []models.StoreHours
+	length   time.Duration
+	capacity int
+	prep     time.Duration
+}
+
+// loadStoreSchedule reads a store's scheduling settings. With lock set the
+// store row is held until the transaction ends, so that concurrent orders
+// for the same store take slots one at a time.
+func loadStoreSchedule(q queryer, storeID int64, lock bool) (*storeSchedule, error) {
+	query := `SELECT timezone, slot_minutes, slot_capacity, prep_minutes FROM stores WHERE id = $1`
+	if lock {
+		query += ` FOR NO KEY UPDATE`
+	}
+
+	var timezone string
+	var slotMinutes, prepMinutes int
+	sched := &storeSchedule{}
+	err := q.QueryRow(query, storeID).Scan(&timezone, &slotMinutes, &sched.capacity, &prepMinutes)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("store")
+		}
+		return nil, err
+	}
+	sched.length = time.Duration(slotMinutes) * time.Minute
+	sched.prep = time.Duration(prepMinutes) * time.Minute
+
+	sched.loc, err = time.LoadLocation(timezone)
+	if err != nil {
+		sched.loc = time.UTC
+	}
+
+	rows, err := q.Query(`SELECT day_of_week, open_time, close_time FROM store_hours WHERE store_id = $1`, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h models.StoreHours
+		if err := rows.Scan(&h.DayOfWeek, &h.OpenTime, &h.CloseTime); err != nil {
+			return nil, err
+		}
+		sched.hours = append(sched.hours, h)
+	}
+
+	return sched, rows.Err()
+}
+
+// bookedSlots counts the live orders scheduled between from and until,
+// keyed by their scheduled time in Unix seconds.
+func bookedSlots(q queryer, storeID int64, from, until time.Time) (map[int64]int, error) {
+	query := `
+		SELECT scheduled_for, COUNT(*)
+		FROM orders
+		WHERE store_id = $1 AND scheduled_for >= $2 AND scheduled_for < $3
+			AND status NOT IN ('cancelled', 'refunded')
+		GROUP BY scheduled_for
+	`
+	rows, err := q.Query(query, storeID, from, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	booked := make(map[int64]int)
+	for rows.Next() {
+		var start time.Time
+		var count int
+		if err := rows.Scan(&start, &count); err != nil {
+			return nil, err
+		}
+		booked[start.Unix()] = count
+	}
+
+	return booked, rows.Err()
+}
+
+// slotBookings counts the bookings that fall inside slot. Orders placed
+// before the store changed its slot length may not line up with the
+// current slots, so they are counted by range rather than by start.
+func slotBookings(booked map[int64]int, slot models.TimeSlot) int {
+	n := 0
+	for start, count := range booked {
+		if start >= slot.Start.Unix() && start < slot.End.Unix() {
+			n += count
+		}
+	}
+	return n
+}
+
+// ListSlots returns a store's time slots on date ("YYYY-MM-DD" in the
+// store's timezone, today when empty) with how many orders each has taken.
+// A slot is available if it has room, is at least the store's prep time
+// away and no further ahead than models.MaxScheduleDays.
+func (s *StoreService) ListSlots(storeID int64, date string) ([]models.TimeSlot, error) {
+	sched, err := loadStoreSchedule(s.DB, storeID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(sched.loc)
+	day := now
+	if date != "" {
+		day, err = time.ParseInLocation("2006-01-02", date, sched.loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", date)
+		}
+	}
+
+	slots := models.DaySlots(sched.hours, day, sched.length)
+	if len(slots) == 0 {
+		return []models.TimeSlot{}, nil
+	}
+
+	booked, err := bookedSlots(s.DB, storeID, slots[0].Start, slots[len(slots)-1].End)
+	if err != nil {
+		return nil, err
+	}
+
+	earliest := now.Add(sched.prep)
+	latest := now.AddDate(0, 0, models.MaxScheduleDays)
+	for i := range slots {
+		slot := &slots[i]
+		slot.Capacity = sched.capacity
+		slot.Booked = slotBookings(booked, *slot)
+		slot.Available = slot.Booked < slot.Capacity && !slot.Start.Before(earliest) && slot.Start.Before(latest)
+	}
+
+	return slots, nil
+}
+
+// reserveSlot checks, inside the transaction placing an order, that the
+// order can be scheduled for at: it must be the start of one of the store's
+// slots, far enough ahead for the kitchen and not past
+// models.MaxScheduleDays, and the slot must have room (ErrSlotFull
+// otherwise). The store stays locked until the order is committed so the
+// slot cannot be overbooked.
+func reserveSlot(tx *sql.Tx, storeID int64, at time.Time) error {
+	sched, err := loadStoreSchedule(tx, storeID, true)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	slot, ok := models.FindSlot(sched.hours, at.In(sched.loc), sched.length)
+	if !ok {
+		return invalidf("%s is not the start of a time slot at this store", at.In(sched.loc).Format("Mon 2 Jan 15:04"))
+	}
+	if slot.Start.Before(now.Add(sched.prep)) {
+		return invalidf("time slot is too soon to prepare the order")
+	}
+	if !slot.Start.Before(now.AddDate(0, 0, models.MaxScheduleDays)) {
+		return invalidf("orders can be scheduled at most %d days ahead", models.MaxScheduleDays)
+	}
+
+	booked, err := bookedSlots(tx, storeID, slot.Start, slot.End)
+	if err != nil {
+		return err
+	}
+	if slotBookings(booked, slot) >= sched.capacity {
+		return ErrSlotFull
+	}
+	return nil
+}
+
+// prepStartsAt returns when the kitchen may start on a scheduled order, or
+// nil if the order is wanted as soon as possible.
+func prepStartsAt(tx *sql.Tx, orderID int64) (*time.Time, error) {
+	query := `
+		SELECT o.scheduled_for - s.prep_minutes * INTERVAL '1 minute'
+		FROM orders o
+		JOIN stores s ON s.id = o.store_id
+		WHERE o.id = $1
+	`
+	var startsAt sql.NullTime
+	if err := tx.QueryRow(query, orderID).Scan(&startsAt); err != nil {
+		return nil, err
+	}
+	if !startsAt.Valid {
+		return nil, nil
+	}
+	return &startsAt.Time, nil
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+type StoreService struct {
+	DB *sql.DB
+}
+
+func NewStoreService(db *sql.DB) *StoreService {
+	return &StoreService{DB: db}
+}
+
+func validateStore(store *models.Store) error {
+	if store.Name == "" {
+		return errors.New("store name is required")
+	}
+	if store.Timezone == "" {
+		store.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(store.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", store.Timezone)
+	}
+	if store.DeliveryFee.IsNegative() {
+		return errors.New("delivery_fee cannot be negative")
+	}
+	store.TaxJurisdiction = strings.TrimSpace(store.TaxJurisdiction)
+	if store.SlotMinutes == 0 {
+		store.SlotMinutes = models.DefaultSlotMinutes
+	}
+	if store.SlotCapacity == 0 {
+		store.SlotCapacity = models.DefaultSlotCapacity
+	}
+	if store.PrepMinutes == 0 {
+		store.PrepMinutes = models.DefaultPrepMinutes
+	}
+	if store.SlotMinutes < 5 || store.SlotMinutes > 240 {
+		return errors.New("slot_minutes must be between 5 and 240")
+	}
+	if store.SlotCapacity < 0 {
+		return errors.New("slot_capacity cannot be negative")
+	}
+	if store.PrepMinutes < 0 {
+		return errors.New("prep_minutes cannot be negative")
+	}
+	for _, h := range store.Hours {
+		if h.DayOfWeek < 0 || h.DayOfWeek > 6 {
+			return fmt.Errorf("invalid day of week %d", h.DayOfWeek)
+		}
+		if _, err := time.Parse("15:04", h.OpenTime); err != nil {
+			return fmt.Errorf("invalid open time %q", h.OpenTime)
+		}
+		if _, err := time.Parse("15:04", h.CloseTime); err != nil {
+			return fmt.Errorf("invalid close time %q", h.CloseTime)
+		}
+	}
+	return nil
+}
+
+func (s *StoreService) CreateStore(store *models.Store) error {
+	if err := validateStore(store); err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO stores (name, address, timezone, tax_jurisdiction, prices_include_tax, delivery_fee,
+                  slot_minutes, slot_capacity, prep_minutes)
+              VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9) RETURNING id, created_at, updated_at`
+	err = tx.QueryRow(query, store.Name, store.Address, store.Timezone, store.TaxJurisdiction, store.PricesIncludeTax,
+		store.DeliveryFee, store.SlotMinutes, store.SlotCapacity, store.PrepMinutes).
+		Scan(&store.ID, &store.CreatedAt, &store.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := s.replaceHours(tx, store.ID, store.Hours); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *StoreService) GetStore(id int64) (*models.Store, error) {
+	store := &models.Store{}
+	query := `SELECT id, name, address, timezone, COALESCE(tax_jurisdiction, ''), prices_include_tax, delivery_fee,
+              slot_minutes, slot_capacity, prep_minutes, created_at, updated_at FROM stores WHERE id = $1`
+
+	err := s.DB.QueryRow(query, id).Scan(
+		&store.ID, &store.Name, &store.Address, &store.Timezone, &store.TaxJurisdiction, &store.PricesIncludeTax, &store.DeliveryFee,
+		&store.SlotMinutes, &store.SlotCapacity, &store.PrepMinutes, &store.CreatedAt, &store.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("store")
+		}
+		return nil, err
+	}
+
+	store.Hours, err = s.getHours(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *StoreService) ListStores() ([]*models.Store, error) {
+	query := `SELECT id, name, address, timezone, COALESCE(tax_jurisdiction, ''), prices_include_tax, delivery_fee,
+              slot_minutes, slot_capacity, prep_minutes, created_at, updated_at FROM stores ORDER BY name`
+
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stores []*models.Store
+	for rows.Next() {
+		store := &models.Store{}
+		err := rows.Scan(&store.ID, &store.Name, &store.Address, &store.Timezone, &store.TaxJurisdiction, &store.PricesIncludeTax, &store.DeliveryFee,
+			&store.SlotMinutes, &store.SlotCapacity, &store.PrepMinutes, &store.CreatedAt, &store.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, store := range stores {
+		store.Hours, err = s.getHours(store.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stores, nil
+}
+
+func (s *StoreService) UpdateStore(store *models.Store) error {
+	if err := validateStore(store); err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE stores SET name = $1, address = $2, timezone = $3, tax_jurisdiction = NULLIF($4, ''),
+              prices_include_tax = $5, delivery_fee = $6, slot_minutes = $7, slot_capacity = $8, prep_minutes = $9,
+              updated_at = CURRENT_TIMESTAMP
+              WHERE id = $10 RETURNING created_at, updated_at`
+	err = tx.QueryRow(query, store.Name, store.Address, store.Timezone, store.TaxJurisdiction, store.PricesIncludeTax,
+		store.DeliveryFee, store.SlotMinutes, store.SlotCapacity, store.PrepMinutes, store.ID).
+		Scan(&store.CreatedAt, &store.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("store")
+		}
+		return err
+	}
+
+	if err := s.replaceHours(tx, store.ID, store.Hours); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteStore deletes a store. A store that has taken orders or stocked
+// products cannot be deleted, and ErrInUse is returned.
+func (s *StoreService) DeleteStore(id int64) error {
+	query := `DELETE FROM stores WHERE id = $1`
+	_, err := s.DB.Exec(query, id)
+	return deleteError(err, "store")
+}
+
+// Location returns the store's timezone, falling back to UTC if the stored
+// value can no longer be loaded.
+func (s *StoreService) Location(storeID int64) (*time.Location, error) {
+	return storeLocation(s.DB, storeID)
+}
+
+func storeLocation(db *sql.DB, storeID int64) (*time.Location, error) {
+	var timezone string
+	err := db.QueryRow(`SELECT timezone FROM stores WHERE id = $1`, storeID).Scan(&timezone)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("store")
+		}
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+func (s *StoreService) getHours(storeID int64) ([]models.StoreHours, error) {
+	query := `SELECT day_of_week, open_time, close_time FROM store_hours WHERE store_id = $1 ORDER BY day_of_week`
+	rows, err := s.DB.Query(query, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hours := []models.StoreHours{}
+	for rows.Next() {
+		var h models.StoreHours
+		if err := rows.Scan(&h.DayOfWeek, &h.OpenTime, &h.CloseTime); err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+
+	return hours, rows.Err()
+}
+
+func (s *StoreService) replaceHours(tx *sql.Tx, storeID int64, hours []models.StoreHours) error {
+	_, err := tx.Exec(`DELETE FROM store_hours WHERE store_id = $1`, storeID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO store_hours (store_id, day_of_week, open_time, close_time) VALUES ($1, $2, $3, $4)`
+	for _, h := range hours {
+		_, err = tx.Exec(query, storeID, h.DayOfWeek, h.OpenTime, h.CloseTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetStoreProduct sets a store's stock level for a product and its optional
+// price override. A nil Price clears the override. Any change in stock is
+// recorded in the inventory ledger as an adjustment by actorID.
+func (s *StoreService) SetStoreProduct(sp *models.StoreProduct, actorID int64) error {
+	if sp.StockQuantity < 0 {
+		return errors.New("stock quantity cannot be negative")
+	}
+	if sp.Price != nil && sp.Price.IsNegative() {
+		return errors.New("price cannot be negative")
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldQuantity int
+	query := `SELECT stock_quantity FROM store_products WHERE store_id = $1 AND product_id = $2 FOR UPDATE`
+	err = tx.QueryRow(query, sp.StoreID, sp.ProductID).Scan(&oldQuantity)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	query = `
+		INSERT INTO store_products (store_id, product_id, stock_quantity, price)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (store_id, product_id) DO UPDATE
+		SET stock_quantity = $3,
+			price = $4,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`
+	err = tx.QueryRow(query, sp.StoreID, sp.ProductID, sp.StockQuantity, sp.Price).Scan(&sp.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if delta := sp.StockQuantity - oldQuantity; delta != 0 {
+		change := StockChange{
+			StoreID:   sp.StoreID,
+			ProductID: sp.ProductID,
+			Reason:    models.MovementAdjustment,
+			ActorID:   actorID,
+			Note:      "Stock level set",
+		}
+		if _, err := recordMovement(tx, change, delta, sp.StockQuantity); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListStoreProducts returns the catalog as seen from one store: stock is the
+// store's own stock, available quantity discounts live reservations, and
+// price is the store override when one is set. Unless includeUnavailable is
+// set, products outside their availability windows are left out. Names and
+// descriptions are translated into the first of langs that has them.
+func (s *StoreService) ListStoreProducts(storeID int64, includeUnavailable bool, langs []string) ([]*models.Product, error) {
+	loc, err := storeLocation(s.DB, storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	windows, err := loadAvailabilityWindows(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().In(loc)
+
+	query := `
+		SELECT p.id, p.name, p.description, p.size, p.category_id, COALESCE(sp.price, p.price), sp.stock_quantity, p.reorder_threshold,
+			p.is_bundle, p.tax_category, p.version, p.created_at, p.updated_at, GREATEST(sp.stock_quantity - COALESCE(res.quantity, 0), 0)
+		FROM store_products sp
+		JOIN products p ON p.id = sp.product_id
+		LEFT JOIN (
+			SELECT ri.product_id, SUM(ri.quantity) AS quantity
+			FROM stock_reservation_items ri
+			JOIN stock_reservations r ON r.id = ri.reservation_id
+			WHERE r.store_id = $1 AND r.status = 'active' AND r.expires_at > CURRENT_TIMESTAMP
+			GROUP BY ri.product_id
+		) res ON res.product_id = p.id
+		WHERE sp.store_id = $1
+		ORDER BY p.name
+	`
+	rows, err := s.DB.Query(query, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []*models.Product
+	for rows.Next() {
+		product := &models.Product{}
+		var available int
+		err := rows.Scan(
+			&product.ID, &product.Name, &product.Description, &product.Size, &product.CategoryID,
+			&product.Price, &product.StockQuantity, &product.ReorderThreshold, &product.IsBundle, &product.TaxCategory,
+			&product.Version, &product.CreatedAt, &product.UpdatedAt, &available,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if !includeUnavailable && !models.IsAvailableAt(windows[product.ID], now) {
+			continue
+		}
+		product.AvailableQuantity = &available
+		products = append(products, product)
+	}
+
+	if err := localizeProducts(s.DB, products, langs); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
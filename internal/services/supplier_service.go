@@ -0,0 +1,95 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+)
+
+type SupplierService struct {
+	DB *sql.DB
+}
+
+func NewSupplierService(db *sql.DB) *SupplierService {
+	return &SupplierService{DB: db}
+}
+
+func (s *SupplierService) CreateSupplier(supplier *models.Supplier) error {
+	if supplier.Name == "" {
+		return errors.New("supplier name is required")
+	}
+
+	query := `INSERT INTO suppliers (name, contact_name, email, phone, address)
+              VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at`
+
+	return s.DB.QueryRow(query, supplier.Name, supplier.ContactName, supplier.Email, supplier.Phone, supplier.Address).
+		Scan(&supplier.ID, &supplier.CreatedAt, &supplier.UpdatedAt)
+}
+
+func (s *SupplierService) GetSupplier(id int64) (*models.Supplier, error) {
+	supplier := &models.Supplier{}
+	query := `SELECT id, name, COALESCE(contact_name, ''), COALESCE(email, ''), COALESCE(phone, ''), COALESCE(address, ''),
+              created_at, updated_at FROM suppliers WHERE id = $1`
+
+	err := s.DB.QueryRow(query, id).Scan(
+		&supplier.ID, &supplier.Name, &supplier.ContactName, &supplier.Email,
+		&supplier.Phone, &supplier.Address, &supplier.CreatedAt, &supplier.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("supplier")
+		}
+		return nil, err
+	}
+
+	return supplier, nil
+}
+
+func (s *SupplierService) ListSuppliers() ([]*models.Supplier, error) {
+	query := `SELECT id, name, COALESCE(contact_name, ''), COALESCE(email, ''), COALESCE(phone, ''), COALESCE(address, ''),
+              created_at, updated_at FROM suppliers ORDER BY name`
+
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suppliers []*models.Supplier
+	for rows.Next() {
+		supplier := &models.Supplier{}
+		err := rows.Scan(
+			&supplier.ID, &supplier.Name, &supplier.ContactName, &supplier.Email,
+			&supplier.Phone, &supplier.Address, &supplier.CreatedAt, &supplier.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, supplier)
+	}
+
+	return suppliers, nil
+}
+
+func (s *SupplierService) UpdateSupplier(supplier *models.Supplier) error {
+	if supplier.Name == "" {
+		return errors.New("supplier name is required")
+	}
+
+	query := `UPDATE suppliers SET name = $1, contact_name = $2, email = $3, phone = $4, address = $5,
+              updated_at = CURRENT_TIMESTAMP WHERE id = $6 RETURNING created_at, updated_at`
+
+	err := s.DB.QueryRow(query, supplier.Name, supplier.ContactName, supplier.Email, supplier.Phone,
+		supplier.Address, supplier.ID).Scan(&supplier.CreatedAt, &supplier.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return notFound("supplier")
+	}
+	return err
+}
+
+func (s *SupplierService) DeleteSupplier(id int64) error {
+	query := `DELETE FROM suppliers WHERE id = $1`
+	_, err := s.DB.Exec(query, id)
+	return err
+}
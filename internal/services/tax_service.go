@@ -0,0 +1,309 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/hratsch/zesty-sips-api/pkg/money"
+	"github.com/lib/pq"
+)
+
+type TaxService struct {
+	DB *sql.DB
+}
+
+func NewTaxService(db *sql.DB) *TaxService {
+	return &TaxService{DB: db}
+}
+
+// taxRateColumns lists the tax_rates columns in the order scanTaxRate reads
+// them.
+const taxRateColumns = `id, COALESCE(jurisdiction, ''), store_id, tax_category, name, rate, created_at, updated_at`
+
+func scanTaxRate(row rowScanner, rate *models.TaxRate) error {
+	return row.Scan(
+		&rate.ID, &rate.Jurisdiction, &rate.StoreID, &rate.TaxCategory, &rate.Name, &rate.Rate,
+		&rate.CreatedAt, &rate.UpdatedAt,
+	)
+}
+
+func validateTaxRate(rate *models.TaxRate) error {
+	rate.Jurisdiction = strings.TrimSpace(rate.Jurisdiction)
+	if (rate.Jurisdiction == "") == (rate.StoreID == nil) {
+		return errors.New("a tax rate needs either a jurisdiction or a store_id")
+	}
+	if rate.Name == "" {
+		return errors.New("tax rate name is required")
+	}
+	if rate.Rate < 0 || rate.Rate > 100 {
+		return errors.New("rate must be between 0 and 100")
+	}
+	rate.TaxCategory = models.NormalizeTaxCategory(rate.TaxCategory)
+	return nil
+}
+
+func (s *TaxService) CreateRate(rate *models.TaxRate) error {
+	if err := validateTaxRate(rate); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO tax_rates (jurisdiction, store_id, tax_category, name, rate)
+              VALUES (NULLIF($1, ''), $2, $3, $4, $5) RETURNING id, created_at, updated_at`
+	return s.DB.QueryRow(query, rate.Jurisdiction, rate.StoreID, rate.TaxCategory, rate.Name, rate.Rate).
+		Scan(&rate.ID, &rate.CreatedAt, &rate.UpdatedAt)
+}
+
+// ListRates returns tax rates, optionally only those of one jurisdiction.
+func (s *TaxService) ListRates(jurisdiction string) ([]*models.TaxRate, error) {
+	query := `SELECT ` + taxRateColumns + ` FROM tax_rates
+              WHERE $1 = '' OR jurisdiction = $1
+              ORDER BY jurisdiction NULLS LAST, store_id, tax_category, name`
+	rows, err := s.DB.Query(query, jurisdiction)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []*models.TaxRate{}
+	for rows.Next() {
+		rate := &models.TaxRate{}
+		if err := scanTaxRate(rows, rate); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func (s *TaxService) UpdateRate(rate *models.TaxRate) error {
+	if err := validateTaxRate(rate); err != nil {
+		return err
+	}
+
+	query := `UPDATE tax_rates SET jurisdiction = NULLIF($1, ''), store_id = $2, tax_category = $3, name = $4, rate = $5,
+              updated_at = CURRENT_TIMESTAMP
+              WHERE id = $6 RETURNING created_at, updated_at`
+	err := s.DB.QueryRow(query, rate.Jurisdiction, rate.StoreID, rate.TaxCategory, rate.Name, rate.Rate, rate.ID).
+		Scan(&rate.CreatedAt, &rate.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return notFound("tax rate")
+	}
+	return err
+}
+
+func (s *TaxService) DeleteRate(id int64) error {
+	_, err := s.DB.Exec(`DELETE FROM tax_rates WHERE id = $1`, id)
+	return err
+}
+
+// storeTaxRates returns the rates a store charges, from its jurisdiction
+// and its own, and whether its prices include tax.
+func storeTaxRates(db *sql.DB, storeID int64) ([]models.TaxRate, bool, error) {
+	var jurisdiction string
+	var inclusive bool
+	query := `SELECT COALESCE(tax_jurisdiction, ''), prices_include_tax FROM stores WHERE id = $1`
+	if err := db.QueryRow(query, storeID).Scan(&jurisdiction, &inclusive); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, notFound("store")
+		}
+		return nil, false, err
+	}
+
+	query = `SELECT ` + taxRateColumns + ` FROM tax_rates
+             WHERE store_id = $1 OR ($2 <> '' AND jurisdiction = $2)
+             ORDER BY store_id NULLS FIRST, id`
+	rows, err := db.Query(query, storeID, jurisdiction)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var rates []models.TaxRate
+	for rows.Next() {
+		var rate models.TaxRate
+		if err := scanTaxRate(rows, &rate); err != nil {
+			return nil, false, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, inclusive, rows.Err()
+}
+
+// productTaxCategories returns the tax category of each of the products.
+func productTaxCategories(db *sql.DB, productIDs []int64) (map[int64]string, error) {
+	rows, err := db.Query(`SELECT id, tax_category FROM products WHERE id = ANY($1)`, pq.Array(productIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var category string
+		if err := rows.Scan(&id, &category); err != nil {
+			return nil, err
+		}
+		categories[id] = category
+	}
+
+	return categories, rows.Err()
+}
+
+// rateScale turns a percentage with three decimals into an integer share of
+// 100000.
+func rateScale(rate float64) int64 {
+	return int64(math.Round(rate * 1000))
+}
+
+// CalculateTax works out an order's tax lines from the subtotal of each tax
+// category. The discount is shared between categories in proportion to
+// their subtotals, and each rate for a category is charged on what is left.
+// With inclusive set the subtotals already contain tax, so each rate's part
+// is worked out of them instead of added on top. It returns the lines and
+// their total.
+func CalculateTax(subtotals map[string]money.Money, discount money.Money, rates []models.TaxRate, inclusive bool) ([]models.TaxLine, money.Money) {
+	var subtotal money.Money
+	categories := make([]string, 0, len(subtotals))
+	for category, amount := range subtotals {
+		categories = append(categories, category)
+		subtotal = subtotal.Add(amount)
+	}
+	sort.Strings(categories)
+
+	var lines []models.TaxLine
+	var total money.Money
+	remaining := discount
+	for i, category := range categories {
+		share := remaining
+		if i < len(categories)-1 && subtotal.IsPositive() {
+			share = discount.MulRate(subtotals[category].Minor, subtotal.Minor, discountRounding)
+		}
+		remaining = remaining.Sub(share)
+		taxable := subtotals[category].Sub(share)
+		if !taxable.IsPositive() {
+			continue
+		}
+
+		var combined int64
+		for _, rate := range rates {
+			if rate.TaxCategory == category {
+				combined += rateScale(rate.Rate)
+			}
+		}
+
+		for _, rate := range rates {
+			if rate.TaxCategory != category {
+				continue
+			}
+			var amount money.Money
+			if inclusive {
+				amount = taxable.MulRate(rateScale(rate.Rate), 100000+combined, taxRounding)
+			} else {
+				amount = taxable.MulRate(rateScale(rate.Rate), 100000, taxRounding)
+			}
+
+			id := rate.ID
+			lines = append(lines, models.TaxLine{
+				TaxRateID:     &id,
+				Name:          rate.Name,
+				Jurisdiction:  rate.Jurisdiction,
+				TaxCategory:   category,
+				Rate:          rate.Rate,
+				TaxableAmount: taxable,
+				TaxAmount:     amount,
+			})
+			total = total.Add(amount)
+		}
+	}
+
+	return lines, total
+}
+
+func saveTaxLines(tx *sql.Tx, orderID int64, lines []models.TaxLine) error {
+	query := `INSERT INTO order_tax_lines (order_id, tax_rate_id, name, jurisdiction, tax_category, rate, taxable_amount, tax_amount)
+              VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8) RETURNING id`
+	for i := range lines {
+		l := &lines[i]
+		err := tx.QueryRow(query, orderID, l.TaxRateID, l.Name, l.Jurisdiction, l.TaxCategory, l.Rate,
+			l.TaxableAmount, l.TaxAmount).Scan(&l.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getTaxLines(db *sql.DB, orderID int64) ([]models.TaxLine, error) {
+	query := `
+		SELECT id, tax_rate_id, name, COALESCE(jurisdiction, ''), tax_category, rate, taxable_amount, tax_amount
+		FROM order_tax_lines WHERE order_id = $1 ORDER BY id
+	`
+	rows, err := db.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []models.TaxLine
+	for rows.Next() {
+		var l models.TaxLine
+		err := rows.Scan(&l.ID, &l.TaxRateID, &l.Name, &l.Jurisdiction, &l.TaxCategory, &l.Rate, &l.TaxableAmount, &l.TaxAmount)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+
+	return lines, rows.Err()
+}
+
+// cancelTaxableAmount takes taxable off an order's tax lines for category
+// when items are cancelled, with each line's tax in proportion, and returns
+// the tax removed.
+func cancelTaxableAmount(tx *sql.Tx, orderID int64, category string, taxable money.Money) (money.Money, error) {
+	query := `SELECT id, taxable_amount, tax_amount FROM order_tax_lines WHERE order_id = $1 AND tax_category = $2 FOR UPDATE`
+	rows, err := tx.Query(query, orderID, category)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	type taxLineShare struct {
+		id     int64
+		amount money.Money
+	}
+	var shares []taxLineShare
+	for rows.Next() {
+		var id int64
+		var lineTaxable, lineTax money.Money
+		if err := rows.Scan(&id, &lineTaxable, &lineTax); err != nil {
+			rows.Close()
+			return money.Money{}, err
+		}
+		if !lineTaxable.IsPositive() {
+			continue
+		}
+		share := lineTax.MulRate(taxable.Min(lineTaxable).Minor, lineTaxable.Minor, taxRounding)
+		shares = append(shares, taxLineShare{id: id, amount: share})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return money.Money{}, err
+	}
+
+	var total money.Money
+	for _, share := range shares {
+		query := `UPDATE order_tax_lines SET taxable_amount = GREATEST(taxable_amount - $1, 0), tax_amount = tax_amount - $2 WHERE id = $3`
+		if _, err := tx.Exec(query, taxable, share.amount, share.id); err != nil {
+			return money.Money{}, err
+		}
+		total = total.Add(share.amount)
+	}
+	return total, nil
+}
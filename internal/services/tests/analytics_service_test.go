@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"zesty-sips-api/internal/services"
+)
+
+func TestTipReportUsesStoreDay(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	analytics := services.NewAnalyticsService(db)
+
+	// created_at is a UTC timestamp without a zone, as lib/pq returns it
+	stamp := func(value string) time.Time {
+		at, err := time.Parse("2006-01-02 15:04", value)
+		require.NoError(t, err)
+		return at
+	}
+	rows := sqlmock.NewRows([]string{"id", "name", "timezone", "created_at", "tip_amount"}).
+		// 22:00 on the 18th in New York
+		AddRow(1, "Uptown", "America/New_York", stamp("2026-03-19 02:00"), "2.00").
+		AddRow(1, "Uptown", "America/New_York", stamp("2026-03-18 15:00"), "0.00").
+		// 00:30 on the 19th in London
+		AddRow(2, "Soho", "Europe/London", stamp("2026-03-19 00:30"), "1.50")
+	mock.ExpectQuery(`FROM orders o`).WillReturnRows(rows)
+
+	lines, err := analytics.GetTipReport(stamp("2026-03-18 00:00"), stamp("2026-03-20 00:00"), 0)
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+
+	assert.Equal(t, "2026-03-18", lines[0].Date)
+	assert.Equal(t, "Uptown", lines[0].StoreName)
+	assert.Equal(t, "2.00", lines[0].TipAmount.String())
+	assert.Equal(t, 1, lines[0].TippedOrders)
+	assert.Equal(t, 2, lines[0].OrderCount)
+
+	assert.Equal(t, "2026-03-19", lines[1].Date)
+	assert.Equal(t, "Soho", lines[1].StoreName)
+	assert.Equal(t, "1.50", lines[1].TipAmount.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/models"
+	"zesty-sips-api/internal/services"
+)
+
+func TestOrderEventBrokerFiltersByStore(t *testing.T) {
+	broker := services.NewOrderEventBroker()
+	events, unsubscribe := broker.Subscribe(1)
+	defer unsubscribe()
+
+	broker.Publish(
+		&models.OrderEvent{ID: 1, StoreID: 2},
+		nil,
+		&models.OrderEvent{ID: 2, StoreID: 1, Type: models.OrderEventCreated},
+	)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, int64(2), event.ID)
+		assert.Equal(t, models.OrderEventCreated, event.Type)
+	default:
+		t.Fatal("expected an event for store 1")
+	}
+	assert.Len(t, events, 0)
+}
+
+func TestOrderEventBrokerDropsSlowSubscribers(t *testing.T) {
+	broker := services.NewOrderEventBroker()
+	events, unsubscribe := broker.Subscribe(1)
+
+	for i := int64(1); i <= 100; i++ {
+		broker.Publish(&models.OrderEvent{ID: i, StoreID: 1})
+	}
+
+	var received int
+	for range events {
+		received++
+	}
+	assert.Less(t, received, 100)
+
+	// Ending a subscription that was already dropped is harmless
+	unsubscribe()
+}
+
+func TestOrderEventBrokerUnsubscribe(t *testing.T) {
+	broker := services.NewOrderEventBroker()
+	events, unsubscribe := broker.Subscribe(1)
+	unsubscribe()
+
+	broker.Publish(&models.OrderEvent{ID: 1, StoreID: 1})
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestOrderEventType(t *testing.T) {
+	assert.Equal(t, models.OrderEventCreated, models.OrderEventType(""))
+	assert.Equal(t, models.OrderEventStatusChanged, models.OrderEventType(models.OrderPending))
+}
+
+func TestOrderEventBrokerSubscribeOrder(t *testing.T) {
+	broker := services.NewOrderEventBroker()
+	events, unsubscribe := broker.SubscribeOrder(7)
+	defer unsubscribe()
+
+	broker.Publish(&models.OrderEvent{ID: 1, OrderID: 8, StoreID: 1}, &models.OrderEvent{ID: 2, OrderID: 7, StoreID: 1})
+
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, int64(2), (<-events).ID)
+	}
+}
+
+func TestOrderEventBrokerHooks(t *testing.T) {
+	broker := services.NewOrderEventBroker()
+	seen := make(chan int64, 2)
+	broker.OnPublish(func(event models.OrderEvent) { seen <- event.ID })
+
+	broker.Publish(&models.OrderEvent{ID: 1, StoreID: 1}, nil, &models.OrderEvent{ID: 2, StoreID: 2})
+	for _, want := range []int64{1, 2} {
+		select {
+		case id := <-seen:
+			assert.Equal(t, want, id)
+		case <-time.After(time.Second):
+			t.Fatalf("hook did not see event %d", want)
+		}
+	}
+}
+
+func TestOrderEventBrokerHooksDoNotBlockPublish(t *testing.T) {
+	broker := services.NewOrderEventBroker()
+	release := make(chan struct{})
+	defer close(release)
+	broker.OnPublish(func(models.OrderEvent) { <-release })
+
+	// Far more events than the hooks' queue holds
+	events := make([]*models.OrderEvent, 300)
+	for i := range events {
+		events[i] = &models.OrderEvent{ID: int64(i + 1), StoreID: 1}
+	}
+	published := make(chan struct{})
+	go func() {
+		broker.Publish(events...)
+		close(published)
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish waited for a slow hook")
+	}
+	// The queue holds 256 and the blocked hook may have taken one more
+	assert.GreaterOrEqual(t, broker.DroppedHookEvents(), uint64(300-257))
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"zesty-sips-api/internal/models"
+	"zesty-sips-api/internal/services"
+)
+
+var orderListingColumns = []string{
+	"id", "user_id", "store_id", "status", "order_type", "delivery_address", "delivery_postcode",
+	"delivery_latitude", "delivery_longitude", "delivery_zone_id", "delivery_eta_minutes", "promotion_code",
+	"scheduled_for", "subtotal", "discount_amount", "delivery_fee", "tax_amount", "tax_included", "total_amount",
+	"tip_amount", "tip_percent", "version", "created_at", "updated_at", "items",
+}
+
+func newListingService(t *testing.T) (*services.OrderService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return services.NewOrderService(db, nil, nil, nil, nil, nil, nil), mock
+}
+
+// addOrderRow adds an order with the given items JSON to rows.
+func addOrderRow(rows *sqlmock.Rows, id int64, items string) *sqlmock.Rows {
+	at := time.Date(2026, 3, 18, 12, 0, 0, 0, time.UTC)
+	return rows.AddRow(id, 7, 1, models.OrderPending, "pickup", "", "",
+		nil, nil, nil, nil, "",
+		nil, "4.00", "0.00", "0.00", "0.00", false, "4.00",
+		"0.00", nil, 1, at, at, []byte(items))
+}
+
+func TestListAllOrdersPassesFilters(t *testing.T) {
+	orders, mock := newListingService(t)
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`FROM orders o`).
+		WithArgs(`{"pending","ready"}`, "delivery", int64(3), int64(7), from, to, int64(90), 26).
+		WillReturnRows(sqlmock.NewRows(orderListingColumns))
+
+	page, err := orders.ListAllOrders(services.OrderFilter{
+		Statuses:  []string{models.OrderPending, models.OrderReady},
+		OrderType: "delivery",
+		StoreID:   3,
+		UserID:    7,
+		From:      &from,
+		To:        &to,
+		Cursor:    90,
+		Limit:     25,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, page.Orders)
+	assert.Zero(t, page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAllOrdersPageSize(t *testing.T) {
+	orders, mock := newListingService(t)
+
+	mock.ExpectQuery(`FROM orders o`).
+		WithArgs(sqlmock.AnyArg(), "", int64(0), int64(0), nil, nil, int64(0), services.DefaultOrderPageSize+1).
+		WillReturnRows(sqlmock.NewRows(orderListingColumns))
+	_, err := orders.ListAllOrders(services.OrderFilter{})
+	require.NoError(t, err)
+
+	mock.ExpectQuery(`FROM orders o`).
+		WithArgs(sqlmock.AnyArg(), "", int64(0), int64(0), nil, nil, int64(0), services.MaxOrderPageSize+1).
+		WillReturnRows(sqlmock.NewRows(orderListingColumns))
+	_, err = orders.ListAllOrders(services.OrderFilter{Limit: 1000})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAllOrdersCursor(t *testing.T) {
+	orders, mock := newListingService(t)
+
+	// The extra row only signals another page
+	rows := sqlmock.NewRows(orderListingColumns)
+	for _, id := range []int64{30, 20, 10} {
+		addOrderRow(rows, id, `[]`)
+	}
+	mock.ExpectQuery(`FROM orders o`).WillReturnRows(rows)
+
+	page, err := orders.ListAllOrders(services.OrderFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 2)
+	assert.Equal(t, int64(30), page.Orders[0].ID)
+	assert.Equal(t, int64(20), page.Orders[1].ID)
+	assert.Equal(t, int64(20), page.NextCursor)
+
+	rows = sqlmock.NewRows(orderListingColumns)
+	addOrderRow(rows, 10, `[]`)
+	mock.ExpectQuery(`FROM orders o`).WithArgs(sqlmock.AnyArg(), "", int64(0), int64(0), nil, nil, int64(20), 3).
+		WillReturnRows(rows)
+
+	page, err = orders.ListAllOrders(services.OrderFilter{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	assert.Zero(t, page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAllOrdersDecodesItems(t *testing.T) {
+	orders, mock := newListingService(t)
+
+	// Postgres builds DECIMAL columns into JSON numbers
+	items := `[{"id": 5, "order_id": 1, "product_id": 10, "quantity": 2, "unit_price": 4.5,
+		"tax_category": "food", "cancelled_quantity": 1,
+		"components": [{"id": 8, "slot_id": 3, "slot_name": "Drink", "product_id": 21,
+			"product_name": "Smoothie", "quantity": 2, "price_adjustment": 1.50}],
+		"modifiers": [{"id": 9, "modifier_id": 4, "name": "Extra shot", "price": 0.75}]}]`
+	rows := sqlmock.NewRows(orderListingColumns)
+	addOrderRow(rows, 1, items)
+	mock.ExpectQuery(`FROM orders o`).WillReturnRows(rows)
+
+	page, err := orders.ListAllOrders(services.OrderFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	require.Len(t, page.Orders[0].Items, 1)
+
+	item := page.Orders[0].Items[0]
+	assert.Equal(t, int64(10), item.ProductID)
+	assert.Equal(t, "4.50", item.UnitPrice.String())
+	assert.Equal(t, 1, item.CancelledQuantity)
+	require.Len(t, item.Components, 1)
+	assert.Equal(t, "Smoothie", item.Components[0].ProductName)
+	assert.Equal(t, "1.50", item.Components[0].PriceAdjustment.String())
+	require.Len(t, item.Modifiers, 1)
+	assert.Equal(t, "0.75", item.Modifiers[0].Price.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAllOrdersRejectsUnknownStatus(t *testing.T) {
+	orders, mock := newListingService(t)
+
+	_, err := orders.ListAllOrders(services.OrderFilter{Statuses: []string{"lost"}})
+	assert.ErrorIs(t, err, services.ErrInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"zesty-sips-api/internal/models"
+	"zesty-sips-api/internal/services"
+	"zesty-sips-api/pkg/money"
+)
+
+func newPricingService(t *testing.T) (*services.PricingService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	productService := services.NewProductService(db, services.NewInventoryService(db, nil))
+	return services.NewPricingService(db, productService, services.NewPromotionService(db)), mock
+}
+
+// expectStore expects the store and tax lookups at the start of PriceOrder,
+// for a store with no tax rates.
+func expectStore(mock sqlmock.Sqlmock, storeID, productID int64, taxCategory string) {
+	mock.ExpectQuery(`SELECT delivery_fee FROM stores`).WithArgs(storeID).
+		WillReturnRows(sqlmock.NewRows([]string{"delivery_fee"}).AddRow("2.50"))
+	mock.ExpectQuery(`prices_include_tax FROM stores`).WithArgs(storeID).
+		WillReturnRows(sqlmock.NewRows([]string{"jurisdiction", "prices_include_tax"}).AddRow("", false))
+	mock.ExpectQuery(`FROM tax_rates`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "jurisdiction", "store_id", "tax_category", "name", "rate", "created_at", "updated_at"}))
+	mock.ExpectQuery(`SELECT id, tax_category FROM products`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tax_category"}).AddRow(productID, taxCategory))
+}
+
+// expectItem expects the price, bundle and modifier lookups for one item.
+func expectItem(mock sqlmock.Sqlmock, storeID, productID int64, price string, slots, modifiers *sqlmock.Rows) {
+	mock.ExpectQuery(`COALESCE\(sp\.price, p\.price\)`).WithArgs(storeID, productID).
+		WillReturnRows(sqlmock.NewRows([]string{"price"}).AddRow(price))
+	if slots == nil {
+		slots = sqlmock.NewRows([]string{"slot_id", "name", "quantity", "product_id", "product_name", "price_adjustment"})
+	}
+	mock.ExpectQuery(`FROM bundle_slots`).WithArgs(productID).WillReturnRows(slots)
+	if modifiers != nil {
+		mock.ExpectQuery(`FROM product_modifiers`).WillReturnRows(modifiers)
+	}
+}
+
+func TestPriceOrderUsesStorePrice(t *testing.T) {
+	pricing, mock := newPricingService(t)
+	expectStore(mock, 3, 7, "food")
+	// The store's override is what the price lookup returns for store 3
+	expectItem(mock, 3, 7, "4.25", nil, nil)
+
+	order := &models.Order{StoreID: 3, Items: []models.OrderItem{{ProductID: 7, Quantity: 2}}}
+	require.NoError(t, pricing.PriceOrder(order))
+
+	assert.Equal(t, "4.25", order.Items[0].UnitPrice.String())
+	assert.Equal(t, "food", order.Items[0].TaxCategory)
+	assert.Equal(t, "8.50", order.Subtotal.String())
+	assert.Equal(t, "8.50", order.TotalAmount.String())
+	assert.True(t, order.DeliveryFee.IsZero())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPriceOrderAddsBundleAndModifierPrices(t *testing.T) {
+	pricing, mock := newPricingService(t)
+	expectStore(mock, 1, 10, "food")
+	slots := sqlmock.NewRows([]string{"slot_id", "name", "quantity", "product_id", "product_name", "price_adjustment"}).
+		AddRow(1, "Drink", 1, 20, "Lemonade", "0.00").
+		AddRow(1, "Drink", 1, 21, "Smoothie", "1.50").
+		AddRow(2, "Side", 1, 30, "Cookie", "-0.50")
+	modifiers := sqlmock.NewRows([]string{"id", "name", "price"}).
+		AddRow(5, "Extra shot", "0.75")
+	expectItem(mock, 1, 10, "9.00", slots, modifiers)
+
+	order := &models.Order{StoreID: 1, Items: []models.OrderItem{{
+		ProductID:   10,
+		Quantity:    1,
+		Selections:  map[int64]int64{1: 21},
+		ModifierIDs: []int64{5},
+	}}}
+	require.NoError(t, pricing.PriceOrder(order))
+
+	item := order.Items[0]
+	assert.Equal(t, "10.75", item.UnitPrice.String())
+	require.Len(t, item.Components, 2)
+	assert.Equal(t, int64(21), item.Components[0].ProductID)
+	assert.Equal(t, int64(30), item.Components[1].ProductID)
+	require.Len(t, item.Modifiers, 1)
+	assert.Equal(t, "0.75", item.Modifiers[0].Price.String())
+	assert.Equal(t, "10.75", order.Subtotal.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPriceOrderRejectsNonPositiveUnitPrice(t *testing.T) {
+	pricing, mock := newPricingService(t)
+	expectStore(mock, 1, 10, "food")
+	modifiers := sqlmock.NewRows([]string{"id", "name", "price"}).
+		AddRow(5, "No cup", "-3.00")
+	expectItem(mock, 1, 10, "3.00", nil, modifiers)
+
+	order := &models.Order{StoreID: 1, Items: []models.OrderItem{{ProductID: 10, Quantity: 1, ModifierIDs: []int64{5}}}}
+	err := pricing.PriceOrder(order)
+	assert.ErrorIs(t, err, services.ErrInvalid)
+}
+
+func TestPriceOrderCapsDiscountAtSubtotal(t *testing.T) {
+	pricing, mock := newPricingService(t)
+	expectStore(mock, 1, 10, "food")
+	expectItem(mock, 1, 10, "4.00", nil, nil)
+	mock.ExpectQuery(`FROM promotions`).
+		WillReturnRows(sqlmock.NewRows([]string{"discount_percent", "used_up"}).AddRow(150.0, false))
+
+	order := &models.Order{
+		StoreID:       1,
+		PromotionCode: "EVERYTHING",
+		Items:         []models.OrderItem{{ProductID: 10, Quantity: 2}},
+	}
+	require.NoError(t, pricing.PriceOrder(order))
+
+	assert.Equal(t, "8.00", order.DiscountAmount.String())
+	assert.True(t, order.TotalAmount.IsZero())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPriceOrderErrors(t *testing.T) {
+	pricing, mock := newPricingService(t)
+
+	err := pricing.PriceOrder(&models.Order{StoreID: 1})
+	assert.ErrorIs(t, err, services.ErrInvalid)
+
+	expectStore(mock, 1, 10, "food")
+	expectItem(mock, 1, 10, "4.00", nil, sqlmock.NewRows([]string{"id", "name", "price"}))
+	order := &models.Order{StoreID: 1, Items: []models.OrderItem{{ProductID: 10, Quantity: 1, ModifierIDs: []int64{99}}}}
+	err = pricing.PriceOrder(order)
+	assert.ErrorIs(t, err, services.ErrInvalid)
+
+	mock.ExpectQuery(`SELECT delivery_fee FROM stores`).WillReturnError(sql.ErrNoRows)
+	err = pricing.PriceOrder(&models.Order{StoreID: 2, Items: []models.OrderItem{{ProductID: 10, Quantity: 1}}})
+	assert.ErrorIs(t, err, services.ErrNotFound)
+
+	// Driver failures are not the client's fault
+	mock.ExpectQuery(`SELECT delivery_fee FROM stores`).WillReturnError(errors.New("connection reset"))
+	err = pricing.PriceOrder(&models.Order{StoreID: 2, Items: []models.OrderItem{{ProductID: 10, Quantity: 1}}})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, services.ErrInvalid))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPriceOrderChecksDeliveryPostcodeAgainstAddress(t *testing.T) {
+	pricing, mock := newPricingService(t)
+	expectStore(mock, 1, 10, "food")
+	expectItem(mock, 1, 10, "4.00", nil, nil)
+
+	order := &models.Order{
+		StoreID:          1,
+		OrderType:        models.OrderTypeDelivery,
+		DeliveryAddress:  "1 Long Road, Faraway, E1 6AN",
+		DeliveryPostcode: "SW1A 1AA",
+		Items:            []models.OrderItem{{ProductID: 10, Quantity: 1}},
+	}
+	err := pricing.PriceOrder(order)
+	assert.ErrorIs(t, err, services.ErrInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPriceOrderRejectsTipInAnotherCurrency(t *testing.T) {
+	pricing, mock := newPricingService(t)
+	expectStore(mock, 1, 10, "food")
+	expectItem(mock, 1, 10, "4.00", nil, nil)
+
+	order := &models.Order{StoreID: 1, Items: []models.OrderItem{{ProductID: 10, Quantity: 1}}}
+	order.TipAmount = money.New(500, "JPY")
+	err := pricing.PriceOrder(order)
+	assert.ErrorIs(t, err, services.ErrInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPriceOrderMatchesPostcodeAsWholeWords(t *testing.T) {
+	tests := []struct {
+		address  string
+		postcode string
+		ok       bool
+	}{
+		{"Flat 2, 1 Long Road, London E10 7AA", "10", false},
+		{"100 Main Street, Springfield", "10", false},
+		{"Flat 2, 1 Long Road, London E10 7AA", "e10 7aa", true},
+		{"1 Long Road, London, E10-7AA", "E107AA", true},
+		{"5 Elm Street, Springfield 10", "10", true},
+	}
+	for _, tt := range tests {
+		pricing, mock := newPricingService(t)
+		expectStore(mock, 1, 10, "food")
+		expectItem(mock, 1, 10, "4.00", nil, nil)
+		if tt.ok {
+			// No delivery zones, so the store's flat fee applies
+			mock.ExpectQuery(`FROM delivery_zones`).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		}
+
+		order := &models.Order{
+			StoreID:          1,
+			OrderType:        models.OrderTypeDelivery,
+			DeliveryAddress:  tt.address,
+			DeliveryPostcode: tt.postcode,
+			Items:            []models.OrderItem{{ProductID: 10, Quantity: 1}},
+		}
+		err := pricing.PriceOrder(order)
+		if tt.ok {
+			assert.NoError(t, err, tt.address)
+		} else {
+			assert.ErrorIs(t, err, services.ErrInvalid, tt.address)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
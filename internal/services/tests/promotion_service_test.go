@@ -0,0 +1,29 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"zesty-sips-api/internal/services"
+)
+
+func TestDeletePromotionInUse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	promotions := services.NewPromotionService(db)
+
+	// Redemptions keep the promotion they used
+	mock.ExpectExec(`DELETE FROM promotions`).WithArgs(int64(4)).
+		WillReturnError(&pq.Error{Code: "23503"})
+	err = promotions.DeletePromotion(4)
+	assert.ErrorIs(t, err, services.ErrInUse)
+
+	mock.ExpectExec(`DELETE FROM promotions`).WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, promotions.DeletePromotion(5))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"zesty-sips-api/internal/models"
+	"zesty-sips-api/internal/services"
+)
+
+func newReservationService(t *testing.T) (*services.ReservationService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return services.NewReservationService(db), mock
+}
+
+// expectActiveReservations expects the lock on the customer and the count
+// of their live reservations.
+func expectActiveReservations(mock sqlmock.Sqlmock, userID int64, active int) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM users WHERE id = \$1 FOR NO KEY UPDATE`).WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM stock_reservations`).WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(active))
+}
+
+func TestCreateReservationMergesSameProduct(t *testing.T) {
+	reservations, mock := newReservationService(t)
+	expectActiveReservations(mock, 1, 0)
+	mock.ExpectQuery(`SELECT stock_quantity FROM store_products`).WithArgs(int64(2), int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"stock_quantity"}).AddRow(5))
+	mock.ExpectQuery(`SUM\(ri\.quantity\)`).WithArgs(int64(2), int64(7), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(0))
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO stock_reservations`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "expires_at", "created_at", "updated_at"}).
+			AddRow(9, "active", now.Add(10*time.Minute), now, now))
+	// One row for the product, holding both quantities
+	mock.ExpectExec(`INSERT INTO stock_reservation_items`).WithArgs(int64(9), int64(7), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reservation := &models.Reservation{UserID: 1, StoreID: 2, Items: []models.ReservationItem{
+		{ProductID: 7, Quantity: 1},
+		{ProductID: 7, Quantity: 2},
+	}}
+	require.NoError(t, reservations.CreateReservation(reservation))
+	assert.Equal(t, []models.ReservationItem{{ProductID: 7, Quantity: 3}}, reservation.Items)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateReservationLimitsActiveHolds(t *testing.T) {
+	reservations, mock := newReservationService(t)
+	expectActiveReservations(mock, 1, services.MaxActiveReservations)
+	mock.ExpectRollback()
+
+	reservation := &models.Reservation{UserID: 1, StoreID: 2, Items: []models.ReservationItem{{ProductID: 7, Quantity: 1}}}
+	err := reservations.CreateReservation(reservation)
+	assert.ErrorIs(t, err, services.ErrTooManyReservations)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateReservationRejectsBadItems(t *testing.T) {
+	reservations, _ := newReservationService(t)
+
+	err := reservations.CreateReservation(&models.Reservation{UserID: 1, StoreID: 2})
+	assert.ErrorIs(t, err, services.ErrInvalid)
+
+	err = reservations.CreateReservation(&models.Reservation{UserID: 1, StoreID: 2, Items: []models.ReservationItem{
+		{ProductID: 7, Quantity: 2},
+		{ProductID: 7, Quantity: 0},
+	}})
+	assert.ErrorIs(t, err, services.ErrInvalid)
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"zesty-sips-api/internal/models"
+	"zesty-sips-api/internal/services"
+	"zesty-sips-api/pkg/money"
+)
+
+func usd(amount string) money.Money {
+	return money.MustParse(amount, "USD")
+}
+
+func taxRate(id int64, category, name string, rate float64) models.TaxRate {
+	return models.TaxRate{ID: id, TaxCategory: category, Name: name, Rate: rate}
+}
+
+func TestCalculateTax(t *testing.T) {
+	tests := []struct {
+		name      string
+		subtotals map[string]money.Money
+		discount  money.Money
+		rates     []models.TaxRate
+		inclusive bool
+		// taxable and tax are "category name" -> amount for each line
+		taxable map[string]string
+		tax     map[string]string
+		total   string
+	}{
+		{
+			name:      "exclusive rounds half up",
+			subtotals: map[string]money.Money{"standard": usd("10.00")},
+			rates:     []models.TaxRate{taxRate(1, "standard", "State", 8.875)},
+			taxable:   map[string]string{"standard State": "10.00"},
+			tax:       map[string]string{"standard State": "0.89"},
+			total:     "0.89",
+		},
+		{
+			name:      "inclusive takes tax out of the price",
+			subtotals: map[string]money.Money{"standard": usd("10.80")},
+			rates: []models.TaxRate{
+				taxRate(1, "standard", "State", 6),
+				taxRate(2, "standard", "City", 2),
+			},
+			inclusive: true,
+			taxable:   map[string]string{"standard State": "10.80", "standard City": "10.80"},
+			tax:       map[string]string{"standard State": "0.60", "standard City": "0.20"},
+			total:     "0.80",
+		},
+		{
+			name:      "discount is split across categories",
+			subtotals: map[string]money.Money{"food": usd("6.00"), "standard": usd("4.00")},
+			discount:  usd("1.00"),
+			rates: []models.TaxRate{
+				taxRate(1, "food", "Food", 5),
+				taxRate(2, "standard", "State", 10),
+			},
+			taxable: map[string]string{"food Food": "5.40", "standard State": "3.60"},
+			tax:     map[string]string{"food Food": "0.27", "standard State": "0.36"},
+			total:   "0.63",
+		},
+		{
+			name:      "rounding remainder of the discount goes to the last category",
+			subtotals: map[string]money.Money{"a": usd("1.00"), "b": usd("1.00"), "c": usd("1.00")},
+			discount:  usd("0.10"),
+			rates: []models.TaxRate{
+				taxRate(1, "a", "A", 10),
+				taxRate(2, "b", "B", 10),
+				taxRate(3, "c", "C", 10),
+			},
+			taxable: map[string]string{"a A": "0.97", "b B": "0.97", "c C": "0.96"},
+			tax:     map[string]string{"a A": "0.10", "b B": "0.10", "c C": "0.10"},
+			total:   "0.30",
+		},
+		{
+			name:      "category without rates is not taxed",
+			subtotals: map[string]money.Money{"food": usd("5.00"), "standard": usd("5.00")},
+			rates:     []models.TaxRate{taxRate(1, "standard", "State", 10)},
+			taxable:   map[string]string{"standard State": "5.00"},
+			tax:       map[string]string{"standard State": "0.50"},
+			total:     "0.50",
+		},
+		{
+			name:      "store with no rates",
+			subtotals: map[string]money.Money{"standard": usd("12.34")},
+			discount:  usd("2.00"),
+			total:     "0.00",
+		},
+		{
+			name:      "fully discounted order",
+			subtotals: map[string]money.Money{"standard": usd("3.00")},
+			discount:  usd("3.00"),
+			rates:     []models.TaxRate{taxRate(1, "standard", "State", 10)},
+			total:     "0.00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, total := services.CalculateTax(tt.subtotals, tt.discount, tt.rates, tt.inclusive)
+
+			taxable := map[string]string{}
+			tax := map[string]string{}
+			for _, line := range lines {
+				key := line.TaxCategory + " " + line.Name
+				taxable[key] = line.TaxableAmount.String()
+				tax[key] = line.TaxAmount.String()
+			}
+			if tt.taxable == nil {
+				tt.taxable, tt.tax = map[string]string{}, map[string]string{}
+			}
+			assert.Equal(t, tt.taxable, taxable)
+			assert.Equal(t, tt.tax, tax)
+			assert.Equal(t, tt.total, total.String())
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hratsch/zesty-sips-api/internal/models"
+	"github.com/lib/pq"
+)
+
+// translationTable describes where an entity's translations are kept: the
+// translation table, its key column and the table being translated.
+type translationTable struct {
+	table  string
+	key    string
+	parent string
+	noun   string
+}
+
+var (
+	productTranslations  = translationTable{table: "product_translations", key: "product_id", parent: "products", noun: "product"}
+	categoryTranslations = translationTable{table: "category_translations", key: "category_id", parent: "categories", noun: "category"}
+)
+
+// load returns the translations of the given rows in any of the given
+// locales, keyed by row ID and then locale.
+func (t translationTable) load(db *sql.DB, ids []int64, locales []string) (map[int64]map[string]models.Translation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, locale, name, COALESCE(description, ''), updated_at
+		FROM %s
+		WHERE %s = ANY($1) AND locale = ANY($2)
+	`, t.key, t.table, t.key)
+	rows, err := db.Query(query, pq.Array(ids), pq.Array(locales))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]map[string]models.Translation)
+	for rows.Next() {
+		var id int64
+		var tr models.Translation
+		if err := rows.Scan(&id, &tr.Locale, &tr.Name, &tr.Description, &tr.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if byID[id] == nil {
+			byID[id] = make(map[string]models.Translation)
+		}
+		byID[id][tr.Locale] = tr
+	}
+
+	return byID, rows.Err()
+}
+
+func (t translationTable) list(db *sql.DB, id int64) ([]models.Translation, error) {
+	query := fmt.Sprintf(`
+		SELECT locale, name, COALESCE(description, ''), updated_at
+		FROM %s WHERE %s = $1 ORDER BY locale
+	`, t.table, t.key)
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var translations []models.Translation
+	for rows.Next() {
+		var tr models.Translation
+		if err := rows.Scan(&tr.Locale, &tr.Name, &tr.Description, &tr.UpdatedAt); err != nil {
+			return nil, err
+		}
+		translations = append(translations, tr)
+	}
+
+	return translations, rows.Err()
+}
+
+// set creates or replaces the translation for tr.Locale.
+func (t translationTable) set(db *sql.DB, id int64, tr *models.Translation) error {
+	locale := models.NormalizeLocale(tr.Locale)
+	if locale == "" {
+		return fmt.Errorf("invalid locale %q", tr.Locale)
+	}
+	if locale == models.DefaultLanguage {
+		return fmt.Errorf("%q is the default language; update the %s itself", locale, t.noun)
+	}
+	if strings.TrimSpace(tr.Name) == "" {
+		return errors.New("translated name is required")
+	}
+	tr.Locale = locale
+
+	var exists bool
+	err := db.QueryRow(fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)`, t.parent), id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return notFound(t.noun)
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (%s, locale, name, description)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (%s, locale) DO UPDATE
+		SET name = EXCLUDED.name, description = EXCLUDED.description, updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`, t.table, t.key, t.key)
+	return db.QueryRow(query, id, tr.Locale, tr.Name, tr.Description).Scan(&tr.UpdatedAt)
+}
+
+func (t translationTable) delete(db *sql.DB, id int64, locale string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s = $1 AND locale = $2`, t.table, t.key)
+	result, err := db.Exec(query, id, models.NormalizeLocale(locale))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return notFound("translation")
+	}
+	return nil
+}
+
+// localizeProducts replaces product names and descriptions with their
+// translation in the most preferred of langs, falling back to the primary
+// language and then to the untranslated text.
+func localizeProducts(db *sql.DB, products []*models.Product, langs []string) error {
+	if len(langs) == 0 || len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	translations, err := productTranslations.load(db, ids, models.LanguageFallbacks(langs))
+	if err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		p.Locale = models.DefaultLanguage
+		if tr, ok := models.PickTranslation(translations[p.ID], langs); ok {
+			p.Name = tr.Name
+			if tr.Description != "" {
+				p.Description = tr.Description
+			}
+			p.Locale = tr.Locale
+		}
+	}
+	return nil
+}
+
+// LocalizeProducts translates products in place for the preferred languages.
+func (s *ProductService) LocalizeProducts(products []*models.Product, langs []string) error {
+	return localizeProducts(s.DB, products, langs)
+}
+
+func (s *ProductService) ListTranslations(productID int64) ([]models.Translation, error) {
+	return productTranslations.list(s.DB, productID)
+}
+
+func (s *ProductService) SetTranslation(productID int64, translation *models.Translation) error {
+	return productTranslations.set(s.DB, productID, translation)
+}
+
+func (s *ProductService) DeleteTranslation(productID int64, locale string) error {
+	return productTranslations.delete(s.DB, productID, locale)
+}
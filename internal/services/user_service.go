@@ -2,7 +2,6 @@ package services
 
 import (
 	"database/sql"
-	"errors"
 
 	"github.com/hratsch/zesty-sips-api/internal/models"
 )
@@ -15,7 +14,23 @@ func NewUserService(db *sql.DB) *UserService {
 	return &UserService{DB: db}
 }
 
+// CreateUser signs up a customer. Whatever role user names is replaced, so
+// that nobody can give themselves staff or admin rights by registering.
 func (s *UserService) CreateUser(user *models.User) error {
+	user.Role = models.RoleCustomer
+	return s.createUser(user)
+}
+
+// CreateUserWithRole creates an account with the role user names. It is for
+// admins setting up staff, drivers and other admins.
+func (s *UserService) CreateUserWithRole(user *models.User) error {
+	if !models.IsRole(user.Role) {
+		return fmt.Errorf("unknown role %q", user.Role)
+	}
+	return s.createUser(user)
+}
+
+func (s *UserService) createUser(user *models.User) error {
 	if err := validateEmail(user.Email); err != nil {
 		log.WithFields(log.Fields{
 			"email": user.Email,
@@ -67,7 +82,7 @@ func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, notFound("user")
 		}
 		return nil, err
 	}
@@ -88,7 +103,7 @@ func (s *UserService) GetUser(userID int64) (*models.User, error) {
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, notFound("user")
 		}
 		return nil, err
 	}
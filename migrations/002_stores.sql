@@ -0,0 +1,40 @@
+-- Stores table
+CREATE TABLE stores (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    address TEXT NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Store Hours table
+CREATE TABLE store_hours (
+    store_id INTEGER REFERENCES stores(id) ON DELETE CASCADE,
+    day_of_week INTEGER NOT NULL CHECK (day_of_week BETWEEN 0 AND 6),
+    open_time VARCHAR(5) NOT NULL,
+    close_time VARCHAR(5) NOT NULL,
+    PRIMARY KEY (store_id, day_of_week)
+);
+
+-- Store Products table (per-store stock and price overrides)
+CREATE TABLE store_products (
+    store_id INTEGER REFERENCES stores(id) ON DELETE CASCADE,
+    product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
+    stock_quantity INTEGER NOT NULL DEFAULT 0 CHECK (stock_quantity >= 0),
+    price DECIMAL(10, 2),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (store_id, product_id)
+);
+
+ALTER TABLE orders ADD COLUMN store_id INTEGER REFERENCES stores(id);
+
+-- Move the existing single-location stock into a default store
+INSERT INTO stores (id, name, address, timezone) VALUES (1, 'Main Store', '', 'UTC');
+SELECT setval('stores_id_seq', (SELECT MAX(id) FROM stores));
+
+INSERT INTO store_products (store_id, product_id, stock_quantity)
+SELECT 1, id, stock_quantity FROM products;
+
+UPDATE orders SET store_id = 1 WHERE store_id IS NULL;
+ALTER TABLE orders ALTER COLUMN store_id SET NOT NULL;
@@ -0,0 +1,14 @@
+ALTER TABLE products ADD COLUMN reorder_threshold INTEGER NOT NULL DEFAULT 0;
+
+-- Stock Alerts table
+CREATE TABLE stock_alerts (
+    id SERIAL PRIMARY KEY,
+    store_id INTEGER REFERENCES stores(id) ON DELETE CASCADE,
+    product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
+    stock_quantity INTEGER NOT NULL,
+    reorder_threshold INTEGER NOT NULL,
+    notified_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_alerts_pending ON stock_alerts (created_at) WHERE notified_at IS NULL;
@@ -0,0 +1,30 @@
+-- Inventory Movements table (append-only stock ledger)
+CREATE TABLE inventory_movements (
+    id SERIAL PRIMARY KEY,
+    store_id INTEGER NOT NULL REFERENCES stores(id),
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    quantity_change INTEGER NOT NULL,
+    balance_after INTEGER NOT NULL,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('sale', 'cancellation', 'restock', 'adjustment', 'waste')),
+    actor_id INTEGER REFERENCES users(id),
+    order_id INTEGER REFERENCES orders(id),
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_inventory_movements_product ON inventory_movements (product_id, store_id, id);
+
+CREATE FUNCTION inventory_movements_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'inventory_movements is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER inventory_movements_no_update
+    BEFORE UPDATE OR DELETE ON inventory_movements
+    FOR EACH ROW EXECUTE PROCEDURE inventory_movements_append_only();
+
+-- Opening balances so the ledger reconciles with existing stock
+INSERT INTO inventory_movements (store_id, product_id, quantity_change, balance_after, reason, note)
+SELECT store_id, product_id, stock_quantity, stock_quantity, 'adjustment', 'Opening balance'
+FROM store_products;
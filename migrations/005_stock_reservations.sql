@@ -0,0 +1,21 @@
+-- Stock Reservations table
+CREATE TABLE stock_reservations (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    store_id INTEGER NOT NULL REFERENCES stores(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'converted', 'released')),
+    expires_at TIMESTAMP NOT NULL,
+    order_id INTEGER REFERENCES orders(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_reservations_active ON stock_reservations (store_id, expires_at) WHERE status = 'active';
+
+-- Stock Reservation Items table
+CREATE TABLE stock_reservation_items (
+    reservation_id INTEGER REFERENCES stock_reservations(id) ON DELETE CASCADE,
+    product_id INTEGER REFERENCES products(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (reservation_id, product_id)
+);
@@ -0,0 +1,14 @@
+-- Product Availability table
+-- A product with no rows is always available; otherwise it is available
+-- whenever any of its windows matches the store's local time.
+CREATE TABLE product_availability (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    start_date DATE,
+    end_date DATE,
+    days_of_week INTEGER[] NOT NULL DEFAULT '{}',
+    start_time VARCHAR(5),
+    end_time VARCHAR(5)
+);
+
+CREATE INDEX idx_product_availability_product ON product_availability (product_id);
@@ -0,0 +1,41 @@
+-- Bundles
+-- A bundle is a product sold at its own price that is made of other
+-- products. It has no stock of its own; ordering it takes stock from its
+-- components instead.
+ALTER TABLE products ADD COLUMN is_bundle BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Bundle Slots table
+-- A slot with a single option is a fixed component; a slot with several is
+-- a choice the customer makes when ordering.
+CREATE TABLE bundle_slots (
+    id SERIAL PRIMARY KEY,
+    bundle_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    position INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_bundle_slots_bundle ON bundle_slots (bundle_id);
+
+-- Bundle Slot Options table
+CREATE TABLE bundle_slot_options (
+    slot_id INTEGER NOT NULL REFERENCES bundle_slots(id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    price_adjustment DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (slot_id, product_id)
+);
+
+-- Order Item Components table
+-- The products a bundle on an order was made of. The slot name is copied so
+-- the breakdown survives later changes to the bundle.
+CREATE TABLE order_item_components (
+    id SERIAL PRIMARY KEY,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    slot_id INTEGER REFERENCES bundle_slots(id) ON DELETE SET NULL,
+    slot_name VARCHAR(100) NOT NULL,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    quantity INTEGER NOT NULL,
+    price_adjustment DECIMAL(10, 2) NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_order_item_components_item ON order_item_components (order_item_id);
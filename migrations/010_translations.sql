@@ -0,0 +1,32 @@
+-- Categories table
+CREATE TABLE categories (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE products ADD COLUMN category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL;
+
+-- Product Translations table
+-- Products and categories are written in English; these rows hold their text
+-- in other languages, keyed by lowercase language tag ("es", "es-mx").
+CREATE TABLE product_translations (
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    locale VARCHAR(20) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (product_id, locale)
+);
+
+-- Category Translations table
+CREATE TABLE category_translations (
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    locale VARCHAR(20) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (category_id, locale)
+);
@@ -0,0 +1,30 @@
+-- Order Status History table
+-- One row per status change, including the initial "pending", so every
+-- step of an order's lifecycle is timestamped with who made it.
+CREATE TABLE order_status_history (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    actor_id INTEGER REFERENCES users(id),
+    actor_role VARCHAR(20),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_order_status_history_order ON order_status_history (order_id, id);
+
+-- Statuses used to be free text. Orders that were finished under another
+-- name are completed; anything else unknown is closed as cancelled rather
+-- than reopened.
+UPDATE orders SET status = 'completed'
+WHERE LOWER(status) IN ('complete', 'completed', 'delivered', 'done', 'fulfilled', 'picked_up', 'collected');
+
+UPDATE orders SET status = 'cancelled'
+WHERE status NOT IN ('pending', 'confirmed', 'preparing', 'ready', 'out_for_delivery', 'completed', 'cancelled', 'refunded');
+
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (status IN (
+    'pending', 'confirmed', 'preparing', 'ready', 'out_for_delivery', 'completed', 'cancelled', 'refunded'
+));
+
+INSERT INTO order_status_history (order_id, to_status, created_at)
+SELECT id, status, updated_at FROM orders;
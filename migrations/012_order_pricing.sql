@@ -0,0 +1,40 @@
+-- Store pricing settings
+-- tax_rate is a percentage applied to the discounted subtotal; delivery_fee
+-- is charged on delivery orders.
+ALTER TABLE stores ADD COLUMN tax_rate DECIMAL(6, 3) NOT NULL DEFAULT 0 CHECK (tax_rate >= 0 AND tax_rate <= 100);
+ALTER TABLE stores ADD COLUMN delivery_fee DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (delivery_fee >= 0);
+
+-- Product Modifiers table
+-- Paid extras a customer can add to a product, such as an extra shot.
+CREATE TABLE product_modifiers (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    price DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (price >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_product_modifiers_product ON product_modifiers (product_id);
+
+-- Order pricing breakdown
+-- Orders placed before server-side pricing keep their total as the subtotal.
+ALTER TABLE orders ADD COLUMN subtotal DECIMAL(10, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN delivery_fee DECIMAL(10, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN promotion_code VARCHAR(50);
+
+UPDATE orders SET subtotal = total_amount;
+
+-- Order Item Modifiers table
+-- Name and price are copied so the order keeps what was charged.
+CREATE TABLE order_item_modifiers (
+    id SERIAL PRIMARY KEY,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    modifier_id INTEGER REFERENCES product_modifiers(id) ON DELETE SET NULL,
+    name VARCHAR(100) NOT NULL,
+    price DECIMAL(10, 2) NOT NULL
+);
+
+CREATE INDEX idx_order_item_modifiers_item ON order_item_modifiers (order_item_id);
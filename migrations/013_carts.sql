@@ -0,0 +1,32 @@
+-- Carts table
+-- One cart per customer, shared by all of their devices. A cart that is not
+-- touched before expires_at is thrown away.
+CREATE TABLE carts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    store_id INTEGER REFERENCES stores(id) ON DELETE SET NULL,
+    order_type VARCHAR(20),
+    delivery_address TEXT,
+    promotion_code VARCHAR(50),
+    version INTEGER NOT NULL DEFAULT 1,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_carts_expires_at ON carts (expires_at);
+
+-- Cart Items table
+-- selections maps bundle slot IDs to the chosen product, as on order items.
+CREATE TABLE cart_items (
+    id SERIAL PRIMARY KEY,
+    cart_id INTEGER NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    selections JSONB NOT NULL DEFAULT '{}',
+    modifier_ids INTEGER[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_cart_items_cart ON cart_items (cart_id);
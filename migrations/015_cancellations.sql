@@ -0,0 +1,35 @@
+-- Promotion usage limits. NULL means unlimited.
+ALTER TABLE promotions ADD COLUMN max_redemptions INTEGER CHECK (max_redemptions > 0);
+
+-- Promotion Redemptions table
+-- One row per order that used a code. Cancelling the order releases it so
+-- it stops counting against max_redemptions.
+CREATE TABLE promotion_redemptions (
+    id SERIAL PRIMARY KEY,
+    promotion_id INTEGER NOT NULL REFERENCES promotions(id) ON DELETE CASCADE,
+    order_id INTEGER NOT NULL UNIQUE REFERENCES orders(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id),
+    discount_amount DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    released_at TIMESTAMP
+);
+
+CREATE INDEX idx_promotion_redemptions_active ON promotion_redemptions (promotion_id) WHERE released_at IS NULL;
+
+-- Line item cancellations
+ALTER TABLE order_items ADD COLUMN cancelled_quantity INTEGER NOT NULL DEFAULT 0
+    CHECK (cancelled_quantity >= 0 AND cancelled_quantity <= quantity);
+
+-- Refunds table
+-- Money owed back to the customer for a cancelled line or order.
+CREATE TABLE refunds (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    order_item_id INTEGER REFERENCES order_items(id) ON DELETE SET NULL,
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount >= 0),
+    reason VARCHAR(255),
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_refunds_order ON refunds (order_id);
@@ -0,0 +1,41 @@
+-- Payments table
+-- One row per attempt to pay for an order. amount is what was authorized;
+-- captured_amount and refunded_amount track what has actually moved.
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    provider_reference VARCHAR(255),
+    status VARCHAR(20) NOT NULL
+        CHECK (status IN ('pending', 'authorized', 'declined', 'captured', 'voided', 'refunded')),
+    amount DECIMAL(10, 2) NOT NULL,
+    captured_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    refunded_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    decline_reason VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_payments_order ON payments (order_id);
+CREATE UNIQUE INDEX idx_payments_reference ON payments (provider, provider_reference);
+
+-- An order has at most one payment in flight or holding money at a time
+CREATE UNIQUE INDEX idx_payments_live ON payments (order_id) WHERE status IN ('pending', 'authorized', 'captured');
+
+-- Payment Events table
+-- Webhook deliveries already handled, so a redelivered event is ignored.
+CREATE TABLE payment_events (
+    provider VARCHAR(50) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    provider_reference VARCHAR(255),
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, event_id)
+);
+
+-- Refunds are now paid back through the payment they came from.
+-- settled_at is set once the money has been returned, or once it is clear
+-- nothing needs to move (an uncaptured payment is voided or captured short).
+ALTER TABLE refunds ADD COLUMN payment_id INTEGER REFERENCES payments(id) ON DELETE SET NULL;
+ALTER TABLE refunds ADD COLUMN provider_reference VARCHAR(255);
+ALTER TABLE refunds ADD COLUMN settled_at TIMESTAMP;
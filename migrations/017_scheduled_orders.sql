@@ -0,0 +1,15 @@
+-- Store scheduling settings
+-- Scheduled orders are taken for slot_minutes-long slots during opening
+-- hours, at most slot_capacity orders per slot. The kitchen starts on a
+-- scheduled order prep_minutes before its slot.
+ALTER TABLE stores ADD COLUMN slot_minutes INTEGER NOT NULL DEFAULT 15 CHECK (slot_minutes BETWEEN 5 AND 240);
+ALTER TABLE stores ADD COLUMN slot_capacity INTEGER NOT NULL DEFAULT 10 CHECK (slot_capacity > 0);
+ALTER TABLE stores ADD COLUMN prep_minutes INTEGER NOT NULL DEFAULT 15 CHECK (prep_minutes >= 0);
+
+-- Requested pickup or delivery time
+-- NULL means as soon as possible. Kept with its timezone since slots are
+-- worked out in the store's local time.
+ALTER TABLE orders ADD COLUMN scheduled_for TIMESTAMP WITH TIME ZONE;
+ALTER TABLE carts ADD COLUMN scheduled_for TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_orders_store_scheduled_for ON orders (store_id, scheduled_for) WHERE scheduled_for IS NOT NULL;
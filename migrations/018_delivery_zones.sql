@@ -0,0 +1,32 @@
+-- Delivery Zones table
+-- Where a store delivers. A zone matches an address by postcode, by
+-- polygon (a JSON array of {"lat", "lng"} points) or both. Postcodes are
+-- stored upper-case without spaces or dashes.
+CREATE TABLE delivery_zones (
+    id SERIAL PRIMARY KEY,
+    store_id INTEGER NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    postcodes TEXT[] NOT NULL DEFAULT '{}',
+    polygon JSONB,
+    fee DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (fee >= 0),
+    minimum_order DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (minimum_order >= 0),
+    eta_minutes INTEGER NOT NULL DEFAULT 30 CHECK (eta_minutes >= 0),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (cardinality(postcodes) > 0 OR polygon IS NOT NULL)
+);
+
+CREATE INDEX idx_delivery_zones_store ON delivery_zones (store_id);
+
+-- Delivery destination
+-- Where a delivery order goes, and the zone that priced it.
+ALTER TABLE orders ADD COLUMN delivery_postcode VARCHAR(20);
+ALTER TABLE orders ADD COLUMN delivery_latitude DOUBLE PRECISION;
+ALTER TABLE orders ADD COLUMN delivery_longitude DOUBLE PRECISION;
+ALTER TABLE orders ADD COLUMN delivery_zone_id INTEGER REFERENCES delivery_zones(id) ON DELETE SET NULL;
+ALTER TABLE orders ADD COLUMN delivery_eta_minutes INTEGER;
+
+ALTER TABLE carts ADD COLUMN delivery_postcode VARCHAR(20);
+ALTER TABLE carts ADD COLUMN delivery_latitude DOUBLE PRECISION;
+ALTER TABLE carts ADD COLUMN delivery_longitude DOUBLE PRECISION;
@@ -0,0 +1,54 @@
+-- Tax settings
+-- A store charges the tax rates of its jurisdiction plus any rates of its
+-- own. With prices_include_tax, catalog prices already include tax and it
+-- is worked out of them instead of added on top. Products are taxed by
+-- tax category.
+ALTER TABLE stores ADD COLUMN tax_jurisdiction VARCHAR(50);
+ALTER TABLE stores ADD COLUMN prices_include_tax BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE products ADD COLUMN tax_category VARCHAR(50) NOT NULL DEFAULT 'standard';
+
+-- Tax Rates table
+-- A rate applies to one tax category, either in every store of a
+-- jurisdiction or in a single store. All rates that apply to an item stack,
+-- and a category without rates is not taxed.
+CREATE TABLE tax_rates (
+    id SERIAL PRIMARY KEY,
+    jurisdiction VARCHAR(50),
+    store_id INTEGER REFERENCES stores(id) ON DELETE CASCADE,
+    tax_category VARCHAR(50) NOT NULL DEFAULT 'standard',
+    name VARCHAR(100) NOT NULL,
+    rate DECIMAL(6, 3) NOT NULL CHECK (rate >= 0 AND rate <= 100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((jurisdiction IS NULL) <> (store_id IS NULL))
+);
+
+CREATE INDEX idx_tax_rates_jurisdiction ON tax_rates (jurisdiction);
+CREATE INDEX idx_tax_rates_store ON tax_rates (store_id);
+
+-- Carry each store's flat tax rate over as a store rate
+INSERT INTO tax_rates (store_id, tax_category, name, rate)
+SELECT id, 'standard', 'Sales tax', tax_rate FROM stores WHERE tax_rate > 0;
+
+ALTER TABLE stores DROP COLUMN tax_rate;
+
+-- Order Tax Lines table
+-- The tax an order was charged, one line per rate and tax category, kept
+-- as charged so later rate changes do not rewrite history. taxable_amount
+-- is the discounted subtotal of the category's items.
+CREATE TABLE order_tax_lines (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    tax_rate_id INTEGER REFERENCES tax_rates(id) ON DELETE SET NULL,
+    name VARCHAR(100) NOT NULL,
+    jurisdiction VARCHAR(50),
+    tax_category VARCHAR(50) NOT NULL,
+    rate DECIMAL(6, 3) NOT NULL,
+    taxable_amount DECIMAL(10, 2) NOT NULL,
+    tax_amount DECIMAL(10, 2) NOT NULL
+);
+
+CREATE INDEX idx_order_tax_lines_order ON order_tax_lines (order_id);
+
+ALTER TABLE orders ADD COLUMN tax_included BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE order_items ADD COLUMN tax_category VARCHAR(50) NOT NULL DEFAULT 'standard';
@@ -0,0 +1,9 @@
+-- Tips
+-- A tip is kept apart from total_amount so loyalty points, promotions and
+-- tax never apply to it; the customer pays total_amount + tip_amount.
+-- tip_percent records the preset the customer picked, if any.
+ALTER TABLE orders ADD COLUMN tip_amount DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (tip_amount >= 0);
+ALTER TABLE orders ADD COLUMN tip_percent INTEGER;
+
+ALTER TABLE carts ADD COLUMN tip_amount DECIMAL(10, 2) CHECK (tip_amount >= 0);
+ALTER TABLE carts ADD COLUMN tip_percent INTEGER;
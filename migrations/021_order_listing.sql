@@ -0,0 +1,7 @@
+-- Indexes for the staff order listing
+-- Orders are paged newest first by id, usually within one store or status,
+-- and each page's items are read by order.
+CREATE INDEX idx_orders_store_id ON orders (store_id, id DESC);
+CREATE INDEX idx_orders_status_id ON orders (status, id DESC);
+CREATE INDEX idx_orders_user_id ON orders (user_id, id DESC);
+CREATE INDEX idx_order_items_order ON order_items (order_id);
@@ -0,0 +1,5 @@
+-- Drop products.stock_quantity
+-- Stock has been kept per store in store_products since 002_stores, so this
+-- column was no longer written by sales or adjustments. A product's stock is
+-- now reported as the total across its stores.
+ALTER TABLE products DROP COLUMN stock_quantity;
@@ -0,0 +1,14 @@
+-- Loyalty schema repair
+-- The loyalty service has always written to loyalty_transactions and
+-- upserted loyalty_points by user, but the initial schema had neither the
+-- table nor the unique index the upsert needs.
+CREATE TABLE IF NOT EXISTS loyalty_transactions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id),
+    order_id INTEGER REFERENCES orders(id),
+    points INTEGER NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loyalty_points_user ON loyalty_points (user_id);
@@ -0,0 +1,9 @@
+-- Promotion schema repair
+-- The promotion service has always looked promotions up by code and
+-- is_active and created them without a name, but the initial schema had
+-- neither column and required a name. Codes are unique so a lookup finds
+-- one promotion.
+ALTER TABLE promotions ADD COLUMN IF NOT EXISTS code VARCHAR(50);
+ALTER TABLE promotions ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE promotions ALTER COLUMN name DROP NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_promotions_code ON promotions (code);
@@ -0,0 +1,7 @@
+-- Keep redemptions when a promotion is deleted
+-- 015_cancellations cascaded deletes from promotions to their redemptions,
+-- which silently dropped the record of discounts already given. A promotion
+-- that has been redeemed can no longer be deleted.
+ALTER TABLE promotion_redemptions DROP CONSTRAINT promotion_redemptions_promotion_id_fkey;
+ALTER TABLE promotion_redemptions ADD CONSTRAINT promotion_redemptions_promotion_id_fkey
+    FOREIGN KEY (promotion_id) REFERENCES promotions(id);
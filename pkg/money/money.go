@@ -0,0 +1,392 @@
+// Package money represents amounts of money exactly, as an integer number of
+// minor units (cents) of a currency, so that sums and discounts never pick up
+// floating point rounding errors.
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts read from columns and JSON that do not
+// carry a currency of their own.
+var DefaultCurrency = "USD"
+
+// zeroDecimalCurrencies have no minor unit. Every other currency has two.
+var zeroDecimalCurrencies = map[string]bool{"JPY": true, "KRW": true, "VND": true, "CLP": true, "ISK": true}
+
+// RoundingMode decides what happens to a fraction of a minor unit.
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds to the nearest minor unit, halves away from zero.
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds to the nearest minor unit, halves to the even one.
+	RoundHalfEven
+	// RoundDown drops the fraction, rounding towards zero.
+	RoundDown
+	// RoundUp rounds any fraction away from zero.
+	RoundUp
+)
+
+// Money is an exact amount in minor units of Currency. The zero value is
+// zero in no particular currency and takes on the currency of whatever it is
+// added to.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// New returns an amount of minor units in the given currency.
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// FromMinor returns an amount of minor units in DefaultCurrency.
+func FromMinor(minor int64) Money {
+	return New(minor, DefaultCurrency)
+}
+
+func decimals(currency string) int {
+	if zeroDecimalCurrencies[currency] {
+		return 0
+	}
+	return 2
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// Parse reads a decimal string such as "8.99" or "-0.5". It is an error to
+// give more decimal places than the currency has minor units.
+func Parse(s, currency string) (Money, error) {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Money{}, errors.New("money: empty amount")
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" && frac == "" {
+		return Money{}, fmt.Errorf("money: invalid amount %q", s)
+	}
+
+	places := decimals(currency)
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > places {
+		return Money{}, fmt.Errorf("money: %q has more than %d decimal places", s, places)
+	}
+	frac += strings.Repeat("0", places-len(frac))
+
+	digits := whole + frac
+	if digits == "" {
+		digits = "0"
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Money{}, fmt.Errorf("money: invalid amount %q", s)
+		}
+	}
+	minor, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("money: amount %q out of range", s)
+	}
+	if negative {
+		minor = -minor
+	}
+	return New(minor, currency), nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for constants.
+func MustParse(s, currency string) Money {
+	m, err := Parse(s, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// String formats the amount as a plain decimal, e.g. "8.99".
+func (m Money) String() string {
+	places := decimals(m.currency())
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	if places == 0 {
+		return sign + strconv.FormatInt(minor, 10)
+	}
+	unit := int64(math.Pow10(places))
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/unit, places, minor%unit)
+}
+
+func (m Money) sameCurrency(o Money) string {
+	switch {
+	case m.Currency == "":
+		return o.Currency
+	case o.Currency == "" || o.Currency == m.Currency:
+		return m.Currency
+	}
+	panic(fmt.Sprintf("money: cannot combine %s and %s", m.Currency, o.Currency))
+}
+
+// Add returns m + o. Mixing two different currencies is a programming error
+// and panics.
+func (m Money) Add(o Money) Money {
+	return New(m.Minor+o.Minor, m.sameCurrency(o))
+}
+
+// Sub returns m - o.
+func (m Money) Sub(o Money) Money {
+	return New(m.Minor-o.Minor, m.sameCurrency(o))
+}
+
+// Mul returns m multiplied by a whole quantity.
+func (m Money) Mul(quantity int64) Money {
+	return New(m.Minor*quantity, m.Currency)
+}
+
+// Neg returns -m.
+func (m Money) Neg() Money {
+	return New(-m.Minor, m.Currency)
+}
+
+// Cmp returns -1, 0 or +1 as m is less than, equal to or greater than o.
+func (m Money) Cmp(o Money) int {
+	m.sameCurrency(o)
+	switch {
+	case m.Minor < o.Minor:
+		return -1
+	case m.Minor > o.Minor:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) IsZero() bool     { return m.Minor == 0 }
+func (m Money) IsNegative() bool { return m.Minor < 0 }
+func (m Money) IsPositive() bool { return m.Minor > 0 }
+
+// Min returns the smaller of m and o.
+func (m Money) Min(o Money) Money {
+	if m.Cmp(o) <= 0 {
+		return m
+	}
+	return o
+}
+
+// divRound divides n by d (d > 0) rounding the remainder as mode says.
+func divRound(n, d int64, mode RoundingMode) int64 {
+	q, r := n/d, n%d
+	if r == 0 {
+		return q
+	}
+	sign := int64(1)
+	if n < 0 {
+		sign, r = -1, -r
+	}
+
+	var up bool
+	switch mode {
+	case RoundDown:
+		up = false
+	case RoundUp:
+		up = true
+	case RoundHalfEven:
+		up = 2*r > d || (2*r == d && q%2 != 0)
+	default:
+		up = 2*r >= d
+	}
+	if up {
+		q += sign
+	}
+	return q
+}
+
+// MulRate returns m * numerator / denominator rounded to a minor unit with
+// the given mode. It is the building block for percentages and rates.
+func (m Money) MulRate(numerator, denominator int64, mode RoundingMode) Money {
+	if denominator <= 0 {
+		panic("money: rate denominator must be positive")
+	}
+	return New(divRound(m.Minor*numerator, denominator, mode), m.Currency)
+}
+
+// Percent returns basisPoints hundredths of a percent of m (1250 is 12.5%).
+func (m Money) Percent(basisPoints int64, mode RoundingMode) Money {
+	return m.MulRate(basisPoints, 10000, mode)
+}
+
+// Div splits m into n equal parts and returns one part rounded with mode.
+func (m Money) Div(n int64, mode RoundingMode) Money {
+	return m.MulRate(1, n, mode)
+}
+
+// WholeUnits returns the number of whole major units in m, dropping any
+// minor units: $8.99 is 8.
+func (m Money) WholeUnits() int64 {
+	places := decimals(m.currency())
+	return m.Minor / int64(math.Pow10(places))
+}
+
+// BasisPoints converts a percentage such as 12.5 to hundredths of a percent,
+// rounding to the nearest one. Percentages are stored with two decimals so
+// this is exact for values read from the database.
+func BasisPoints(percent float64) int64 {
+	return int64(math.Round(percent * 100))
+}
+
+// Value stores the amount as a decimal string, which Postgres converts
+// exactly into DECIMAL columns.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads a DECIMAL (or integer) column in DefaultCurrency. Values with
+// more decimal places than the currency allows are rounded half up.
+func (m *Money) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		*m = New(v*int64(math.Pow10(decimals(DefaultCurrency))), DefaultCurrency)
+		return nil
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return errors.New("money: cannot scan NULL, use *Money")
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+
+	parsed, err := parseRounded(s, DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// parseRounded parses like Parse but rounds extra decimal places half up, as
+// aggregate columns such as AVG or SUM of products can have them.
+func parseRounded(s, currency string) (Money, error) {
+	places := decimals(currency)
+	if i := strings.IndexByte(s, '.'); i >= 0 && len(s)-i-1 > places {
+		extra := s[i+1+places:]
+		trimmed := s[:i+1+places]
+		m, err := Parse(strings.TrimSuffix(trimmed, "."), currency)
+		if err != nil {
+			return Money{}, err
+		}
+		if extra[0] >= '5' {
+			if strings.HasPrefix(strings.TrimSpace(s), "-") {
+				m.Minor--
+			} else {
+				m.Minor++
+			}
+		}
+		return m, nil
+	}
+	return Parse(s, currency)
+}
+
+type jsonMoney struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes the amount as {"amount":"8.99","currency":"USD"}. The
+// amount is a string so clients never parse it into a float by accident.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{Amount: m.String(), Currency: m.currency()})
+}
+
+// UnmarshalJSON accepts the object form written by MarshalJSON, or a bare
+// number or numeric string in DefaultCurrency. Numbers are read from their
+// JSON text, never through float64.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '{' {
+		var raw struct {
+			Amount   json.RawMessage `json:"amount"`
+			Currency string          `json:"currency"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		amount, err := amountText(raw.Amount)
+		if err != nil {
+			return err
+		}
+		parsed, err := Parse(amount, strings.ToUpper(raw.Currency))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	amount, err := amountText(data)
+	if err != nil {
+		return err
+	}
+	parsed, err := Parse(amount, DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func amountText(data json.RawMessage) (string, error) {
+	if len(data) == 0 {
+		return "", errors.New("money: missing amount")
+	}
+	if data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return "", errors.New("money: amount must be a number or numeric string")
+	}
+	if strings.ContainsAny(n.String(), "eE") {
+		return "", errors.New("money: amount cannot use exponent notation")
+	}
+	return n.String(), nil
+}
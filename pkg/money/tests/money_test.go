@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"zesty-sips-api/pkg/money"
+)
+
+func TestParseAndString(t *testing.T) {
+	m, err := money.Parse("8.99", "USD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(899), m.Minor)
+	assert.Equal(t, "8.99", m.String())
+
+	m, err = money.Parse("-0.5", "USD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-50), m.Minor)
+	assert.Equal(t, "-0.50", m.String())
+
+	_, err = money.Parse("1.005", "USD")
+	assert.Error(t, err)
+
+	_, err = money.Parse("12abc", "USD")
+	assert.Error(t, err)
+
+	yen, err := money.Parse("500", "JPY")
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), yen.Minor)
+	assert.Equal(t, "500", yen.String())
+}
+
+func TestSumsAreExact(t *testing.T) {
+	// 0.1 + 0.2 is not 0.3 in float64
+	total := money.Money{}
+	for i := 0; i < 3; i++ {
+		total = total.Add(money.MustParse("0.10", "USD"))
+	}
+	assert.Equal(t, "0.30", total.String())
+	assert.Equal(t, "USD", total.Currency)
+
+	assert.Panics(t, func() {
+		money.MustParse("1", "USD").Add(money.MustParse("1", "EUR"))
+	})
+}
+
+func TestRounding(t *testing.T) {
+	price := money.MustParse("9.99", "USD")
+
+	// 15% of 9.99 is 1.4985
+	assert.Equal(t, "1.49", price.Percent(1500, money.RoundDown).String())
+	assert.Equal(t, "1.50", price.Percent(1500, money.RoundHalfUp).String())
+	assert.Equal(t, "1.50", price.Percent(1500, money.RoundUp).String())
+
+	// 0.05 / 2 is 0.025, a tie
+	nickel := money.MustParse("0.05", "USD")
+	assert.Equal(t, "0.03", nickel.Div(2, money.RoundHalfUp).String())
+	assert.Equal(t, "0.02", nickel.Div(2, money.RoundHalfEven).String())
+	assert.Equal(t, "-0.03", nickel.Neg().Div(2, money.RoundHalfUp).String())
+
+	assert.Equal(t, int64(1250), money.BasisPoints(12.5))
+	assert.Equal(t, int64(9), price.WholeUnits())
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(money.MustParse("4.50", "USD"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"amount":"4.50","currency":"USD"}`, string(data))
+
+	var m money.Money
+	require.NoError(t, json.Unmarshal([]byte(`{"amount":"3.25","currency":"eur"}`), &m))
+	assert.Equal(t, money.New(325, "EUR"), m)
+
+	require.NoError(t, json.Unmarshal([]byte(`4.1`), &m))
+	assert.Equal(t, money.New(410, "USD"), m)
+
+	require.NoError(t, json.Unmarshal([]byte(`"19.99"`), &m))
+	assert.Equal(t, int64(1999), m.Minor)
+
+	assert.Error(t, json.Unmarshal([]byte(`1e3`), &m))
+	assert.Error(t, json.Unmarshal([]byte(`0.001`), &m))
+}
+
+func TestScan(t *testing.T) {
+	var m money.Money
+	require.NoError(t, m.Scan([]byte("12.30")))
+	assert.Equal(t, money.New(1230, "USD"), m)
+
+	// Aggregates can carry extra decimals
+	require.NoError(t, m.Scan([]byte("3.3333333333333333")))
+	assert.Equal(t, int64(333), m.Minor)
+	require.NoError(t, m.Scan([]byte("-2.675")))
+	assert.Equal(t, int64(-268), m.Minor)
+
+	require.NoError(t, m.Scan(int64(7)))
+	assert.Equal(t, int64(700), m.Minor)
+
+	assert.Error(t, m.Scan(nil))
+
+	v, err := money.MustParse("8.05", "USD").Value()
+	require.NoError(t, err)
+	assert.Equal(t, "8.05", v)
+}